@@ -0,0 +1,197 @@
+// client side search over search-index.json made by "uwp-publisher search --update".
+// Tokens, stop words and russian snowball stemmer mirror publisher/stem.go, index terms are stems made there.
+(function (root) {
+  'use strict';
+
+  var perfectiveGerund = {
+    group1: ['в', 'вши', 'вшись'],
+    group2: ['ив', 'ивши', 'ившись', 'ыв', 'ывши', 'ывшись']
+  };
+  var adjective = {group1: [], group2: ['ее', 'ие', 'ые', 'ое', 'ими', 'ыми', 'ей', 'ий', 'ый', 'ой', 'ем', 'им',
+    'ым', 'ом', 'его', 'ого', 'ему', 'ому', 'их', 'ых', 'ую', 'юю', 'ая', 'яя', 'ою', 'ею']};
+  var participle = {
+    group1: ['ем', 'нн', 'вш', 'ющ', 'щ'],
+    group2: ['ивш', 'ывш', 'ующ']
+  };
+  var reflexive = {group1: [], group2: ['ся', 'сь']};
+  var verb = {
+    group1: ['ла', 'на', 'ете', 'йте', 'ли', 'й', 'л', 'ем', 'н', 'ло', 'но', 'ет', 'ют', 'ны', 'ть', 'ешь', 'нно'],
+    group2: ['ила', 'ыла', 'ена', 'ейте', 'уйте', 'ите', 'или', 'ыли', 'ей', 'уй', 'ил', 'ыл', 'им', 'ым', 'ен',
+      'ило', 'ыло', 'ено', 'ят', 'ует', 'уют', 'ит', 'ыт', 'ены', 'ить', 'ыть', 'ишь', 'ую', 'ю']
+  };
+  var noun = {group1: [], group2: ['а', 'ев', 'ов', 'ие', 'ье', 'е', 'иями', 'ями', 'ами', 'еи', 'ии', 'и', 'ией',
+    'ей', 'ой', 'ий', 'й', 'иям', 'ям', 'ием', 'ем', 'ам', 'ом', 'о', 'у', 'ах', 'иях', 'ях', 'ы', 'ь', 'ию', 'ью', 'ю',
+    'ия', 'ья', 'я']};
+  var superlative = {group1: [], group2: ['ейше', 'ейш']};
+  var derivational = {group1: [], group2: ['ость', 'ост']};
+  var vowels = 'аеиоуыэюя';
+
+  var stopWords = {};
+  ('и в во не что он на я с со как а то все она так его но да ты к у же вы за бы по ' +
+    'только ее мне было вот от меня еще нет о из ему теперь когда даже ну вдруг ли если уже или ни быть был него до вас ' +
+    'нибудь опять уж вам ведь там потом себя ничего ей может они тут где есть надо ней для мы тебя их чем была сам чтоб ' +
+    'без будто чего раз тоже себе под будет ж тогда кто этот того потому этого какой совсем ним здесь этом один почти ' +
+    'мой тем чтобы нее сейчас были куда зачем всех никогда можно при наконец два об другой хоть после над больше тот ' +
+    'через эти нас про всего них какая много разве три эту моя впрочем хорошо свою этой перед иногда лучше чуть том ' +
+    'нельзя такой им более всегда конечно всю между').split(' ').forEach(function (w) { stopWords[w] = true; });
+
+  // tokens splits text to lower case words, ё replaced by е, stop words and single letters skipped
+  function tokens(text) {
+    return text.toLowerCase().replace(/ё/g, 'е').split(/[^\p{L}\p{Nd}]+/u).filter(function (w) {
+      return Array.from(w).length >= 2 && !stopWords[w];
+    });
+  }
+
+  // regions returns start of RV and R2, see stemRegions
+  function regions(w) {
+    var isVowel = function (c) { return vowels.indexOf(c) >= 0; };
+    var rv = w.length, r1 = w.length, r2 = w.length, i;
+    for (i = 0; i < w.length; i++) {
+      if (isVowel(w[i])) { rv = i + 1; break; }
+    }
+    for (i = 1; i < w.length; i++) {
+      if (!isVowel(w[i]) && isVowel(w[i - 1])) { r1 = i + 1; break; }
+    }
+    for (i = r1 + 1; i < w.length; i++) {
+      if (!isVowel(w[i]) && isVowel(w[i - 1])) { r2 = i + 1; break; }
+    }
+    return {rv: rv, r2: r2};
+  }
+
+  // remove returns word without the longest ending found in the region starting at pos, null if nothing removed
+  function remove(w, pos, endings) {
+    var region = w.slice(pos), best = '', group1 = false;
+    endings.group1.forEach(function (e) {
+      if (region.endsWith(e) && e.length > best.length) { best = e; group1 = true; }
+    });
+    endings.group2.forEach(function (e) {
+      if (region.endsWith(e) && e.length > best.length) { best = e; group1 = false; }
+    });
+    if (best === '') {
+      return null;
+    }
+    var n = best.length;
+    if (group1 && (w.length - n - 1 < pos || (w[w.length - n - 1] !== 'а' && w[w.length - n - 1] !== 'я'))) {
+      return null;
+    }
+    return w.slice(0, w.length - n);
+  }
+
+  // stem returns stem of the lower case word, same as stemRussian
+  function stem(word) {
+    var w = word.replace(/ё/g, 'е'), res;
+    var reg = regions(w);
+    if (reg.rv >= w.length) {
+      return w;
+    }
+
+    // step 1
+    if ((res = remove(w, reg.rv, perfectiveGerund)) !== null) {
+      w = res;
+    } else {
+      if ((res = remove(w, reg.rv, reflexive)) !== null) {
+        w = res;
+      }
+      if ((res = remove(w, reg.rv, adjective)) !== null) {
+        w = res;
+        if ((res = remove(w, reg.rv, participle)) !== null) {
+          w = res;
+        }
+      } else if ((res = remove(w, reg.rv, verb)) !== null) {
+        w = res;
+      } else if ((res = remove(w, reg.rv, noun)) !== null) {
+        w = res;
+      }
+    }
+
+    // step 2
+    if (w.length > reg.rv && w[w.length - 1] === 'и') {
+      w = w.slice(0, -1);
+    }
+
+    // step 3
+    if (reg.r2 < w.length && (res = remove(w, reg.r2, derivational)) !== null) {
+      w = res;
+    }
+
+    // step 4
+    if ((res = remove(w, reg.rv, superlative)) !== null) {
+      w = res;
+    }
+    if (w.length - 2 >= reg.rv && w.slice(-2) === 'нн') {
+      w = w.slice(0, -1);
+    } else if (w.length > reg.rv && w[w.length - 1] === 'ь') {
+      w = w.slice(0, -1);
+    }
+    return w;
+  }
+
+  // search returns docs containing all words of the query, in index order
+  function search(index, query) {
+    var words = tokens(query);
+    if (words.length === 0) {
+      return [];
+    }
+    var found = null;
+    words.forEach(function (w) {
+      var docs = index.terms[stem(w)] || [];
+      found = found === null ? docs : found.filter(function (pos) { return docs.indexOf(pos) >= 0; });
+    });
+    return found.map(function (pos) { return index.docs[pos]; });
+  }
+
+  // matchedTopics returns topics of the doc with any of query words
+  function matchedTopics(doc, query) {
+    var stems = tokens(query).map(stem);
+    return (doc.p || []).filter(function (topic) {
+      return tokens(topic).some(function (w) { return stems.indexOf(stem(w)) >= 0; });
+    });
+  }
+
+  function escapeHTML(s) {
+    return s.replace(/[&<>"']/g, function (c) {
+      return {'&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'}[c];
+    });
+  }
+
+  // render loads the index and shows results of the q url parameter in the element
+  function render(el, indexURL) {
+    var query = new URLSearchParams(root.location.search).get('q') || '';
+    var input = root.document.querySelector('.main-header__search-input');
+    if (input) {
+      input.value = query;
+    }
+    if (query.trim() === '') {
+      el.innerHTML = '<p>Введите слова для поиска по темам выпусков</p>';
+      return;
+    }
+    el.innerHTML = '<p>Поиск…</p>';
+    root.fetch(indexURL).then(function (resp) {
+      if (!resp.ok) {
+        throw new Error('status ' + resp.status);
+      }
+      return resp.json();
+    }).then(function (index) {
+      var docs = search(index, query);
+      if (docs.length === 0) {
+        el.innerHTML = '<p>Ничего не найдено по запросу «' + escapeHTML(query) + '»</p>';
+        return;
+      }
+      el.innerHTML = '<p>Найдено выпусков: ' + docs.length + '</p><ul class="search-results">' +
+        docs.map(function (d) {
+          var topics = matchedTopics(d, query).map(function (t) { return '<li>' + escapeHTML(t) + '</li>'; }).join('');
+          return '<li>' + escapeHTML(d.d) + ' <a href="' + escapeHTML(d.u) + '">' + escapeHTML(d.t) + '</a>' +
+            (topics ? '<ul>' + topics + '</ul>' : '') + '</li>';
+        }).join('') + '</ul>';
+    }).catch(function (err) {
+      el.innerHTML = '<p>Не удалось загрузить индекс поиска: ' + escapeHTML(err.message) + '</p>';
+    });
+  }
+
+  var api = {tokens: tokens, stem: stem, search: search, render: render};
+  if (typeof module !== 'undefined' && module.exports) {
+    module.exports = api;
+  } else {
+    root.uwpSearch = api;
+  }
+})(typeof window !== 'undefined' ? window : this);
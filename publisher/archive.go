@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// archivePagesDir is a directory for archive pages in the output directory
+const archivePagesDir = "archives"
+
+// nsHistory is the feed history namespace defined by RFC 5005
+const nsHistory = "http://purl.org/syndication/history/1.0"
+
+// archivePageFile returns path of archive page relative to the site root, pages numbered from 1, the oldest
+func archivePageFile(num int) string {
+	return fmt.Sprintf("%s/archive-%d.rss", archivePagesDir, num)
+}
+
+// writeArchivePages writes RFC 5005 archive documents. Episodes are split into pages of pageSize,
+// starting from the oldest one, and only complete pages are written, so episodes stay on the same page.
+// Pages are rendered from the current posts and rewritten only if changed, e.g. a post was edited or the
+// next-archive link added. Episodes not in complete pages go to the current feed, see archiveHeadSize.
+// Returns the number of pages.
+func writeArchivePages(output string, site siteConfig, spec feedSpec, pageSize int, episodes []Post,
+	media map[string]mediaInfo) (int, error) {
+	if pageSize <= 0 {
+		return 0, nil
+	}
+
+	chrono := make([]Post, len(episodes))
+	for i, ep := range episodes {
+		chrono[len(episodes)-1-i] = ep
+	}
+
+	pages := len(chrono) / pageSize
+	for num := 1; num <= pages; num++ {
+		pageEpisodes := make([]Post, 0, pageSize)
+		for i := num*pageSize - 1; i >= (num-1)*pageSize; i-- {
+			pageEpisodes = append(pageEpisodes, chrono[i]) // newest first, as in all other feeds
+		}
+
+		pageSpec := spec
+		pageSpec.File, pageSpec.Size = archivePageFile(num), 0
+		pageSpec.Title = fmt.Sprintf("%s, страница %d", spec.Title, num)
+		feed := makeFeed(site, pageSpec, pageEpisodes, media)
+
+		// build date is the date of the newest episode, to keep the page content stable between runs
+		feed.Channel.LastBuildDate = pageEpisodes[0].Date.In(siteTZ).Format(time.RFC1123Z)
+		feed.NsHistory = nsHistory
+		feed.Channel.HistoryArchive = &struct{}{}
+		feed.Channel.AtomLinks = append(feed.Channel.AtomLinks,
+			rssAtomLink{Href: site.BaseURL + spec.File, Rel: "current", Type: "application/rss+xml"})
+		var links []rssAtomLink
+		if num > 1 {
+			links = append(links, rssAtomLink{Href: site.BaseURL + archivePageFile(num-1), Rel: "prev-archive",
+				Type: "application/rss+xml"})
+		}
+		if num < pages {
+			links = append(links, rssAtomLink{Href: site.BaseURL + archivePageFile(num+1), Rel: "next-archive",
+				Type: "application/rss+xml"})
+		}
+		feed.Channel.AtomLinks = append(feed.Channel.AtomLinks, links...)
+		feed.Channel.PodcastArchive = links
+
+		if err := writeFeed(filepath.Join(output, filepath.FromSlash(pageSpec.File)), feed); err != nil {
+			return 0, err
+		}
+	}
+	return pages, nil
+}
+
+// archiveHeadSize returns number of episodes in the current feed of paged archive, at least size and all
+// episodes newer than the last complete page, otherwise they would be in no archive document
+func archiveHeadSize(size, pageSize, pages, total int) int {
+	if pageSize <= 0 || size <= 0 {
+		return size
+	}
+	if rest := total - pages*pageSize; rest > size {
+		return rest
+	}
+	return size
+}
+
+// addArchiveLinks links the current feed to the newest archive page
+func addArchiveLinks(feed *rssFeed, site siteConfig, pages int) {
+	if pages == 0 {
+		return
+	}
+	link := rssAtomLink{Href: site.BaseURL + archivePageFile(pages), Rel: "prev-archive", Type: "application/rss+xml"}
+	feed.Channel.AtomLinks = append(feed.Channel.AtomLinks, link)
+	feed.Channel.PodcastArchive = append(feed.Channel.PodcastArchive, link)
+}
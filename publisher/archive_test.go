@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteArchivePages(t *testing.T) {
+	site, err := loadSiteConfig("testdata/hugo/config.toml")
+	require.NoError(t, err)
+
+	var episodes []Post // newest first
+	for i := 5; i >= 1; i-- {
+		episodes = append(episodes, Post{Slug: fmt.Sprintf("podcast-%d", i), Title: fmt.Sprintf("UWP - Выпуск %d", i),
+			Filename: fmt.Sprintf("ump_podcast%d", i), Number: i, Date: time.Date(2023, 1, i, 12, 0, 0, 0, siteTZ)})
+	}
+	spec := feedSpec{File: "podcast-archives-short.rss", Title: "UWP (архив)", MediaURL: "https://archive.rucast.net/uwp/media/",
+		Size: 2, Paged: true}
+	out := t.TempDir()
+
+	pages, err := writeArchivePages(out, site, spec, 2, episodes, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pages, "5th episode is not in a complete page")
+	assert.NoFileExists(t, filepath.Join(out, "archives", "archive-3.rss"))
+
+	data, err := os.ReadFile(filepath.Join(out, "archives", "archive-1.rss"))
+	require.NoError(t, err)
+	page1, err := parseFeed(data)
+	require.NoError(t, err)
+	require.Len(t, page1.Channel.Items, 2)
+	assert.Equal(t, "UWP - Выпуск 2", page1.Channel.Items[0].Title)
+	assert.Equal(t, "UWP - Выпуск 1", page1.Channel.Items[1].Title)
+	assert.Contains(t, string(data), `xmlns:fh="http://purl.org/syndication/history/1.0"`)
+	assert.Contains(t, string(data), "<fh:archive></fh:archive>")
+	assert.Contains(t, string(data), "<lastBuildDate>Mon, 02 Jan 2023 12:00:00 -0600</lastBuildDate>")
+	assert.Equal(t, []rssAtomLink{
+		{Href: "https://podcast.umputun.com/archives/archive-1.rss", Rel: "self", Type: "application/rss+xml"},
+		{Href: "https://podcast.umputun.com/podcast-archives-short.rss", Rel: "current", Type: "application/rss+xml"},
+		{Href: "https://podcast.umputun.com/archives/archive-2.rss", Rel: "next-archive", Type: "application/rss+xml"},
+	}, page1.Channel.AtomLinks)
+	assert.Contains(t, string(data), `<podcast:archive href="https://podcast.umputun.com/archives/archive-2.rss" rel="next-archive"`)
+
+	data, err = os.ReadFile(filepath.Join(out, "archives", "archive-2.rss"))
+	require.NoError(t, err)
+	page2, err := parseFeed(data)
+	require.NoError(t, err)
+	assert.Equal(t, "UWP - Выпуск 4", page2.Channel.Items[0].Title)
+	assert.Equal(t, "https://podcast.umputun.com/archives/archive-1.rss", page2.Channel.AtomLinks[2].Href)
+	assert.Equal(t, "prev-archive", page2.Channel.AtomLinks[2].Rel)
+
+	// pages are not rewritten if not changed
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(out, "archives", "archive-1.rss"), old, old))
+	_, err = writeArchivePages(out, site, spec, 2, episodes, nil)
+	require.NoError(t, err)
+	fi, err := os.Stat(filepath.Join(out, "archives", "archive-1.rss"))
+	require.NoError(t, err)
+	assert.Equal(t, old, fi.ModTime().UTC())
+
+	feed := makeFeed(site, spec, episodes, nil)
+	addArchiveLinks(&feed, site, pages)
+	assert.Equal(t, rssAtomLink{Href: "https://podcast.umputun.com/archives/archive-2.rss", Rel: "prev-archive",
+		Type: "application/rss+xml"}, feed.Channel.AtomLinks[1])
+}
+
+func TestArchivePagesCoverAllEpisodes(t *testing.T) {
+	site, err := loadSiteConfig("testdata/hugo/config.toml")
+	require.NoError(t, err)
+
+	var episodes []Post // newest first
+	for i := 5; i >= 1; i-- {
+		episodes = append(episodes, Post{Slug: fmt.Sprintf("podcast-%d", i), Title: fmt.Sprintf("UWP - Выпуск %d", i),
+			Filename: fmt.Sprintf("ump_podcast%d", i), Number: i, Date: time.Date(2023, 1, i, 12, 0, 0, 0, siteTZ)})
+	}
+	spec := feedSpec{File: "podcast-archives-short.rss", Title: "UWP (архив)", MediaURL: "https://archive.rucast.net/uwp/media/",
+		Size: 1, Paged: true}
+	out := t.TempDir()
+
+	pages, err := writeArchivePages(out, site, spec, 3, episodes, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, pages)
+	spec.Size = archiveHeadSize(spec.Size, 3, pages, len(episodes))
+	assert.Equal(t, 2, spec.Size, "episodes 4 and 5 are not in a complete page")
+
+	seen := map[string]int{}
+	for _, item := range makeFeed(site, spec, episodes, nil).Channel.Items {
+		seen[item.Title]++
+	}
+	data, err := os.ReadFile(filepath.Join(out, "archives", "archive-1.rss"))
+	require.NoError(t, err)
+	page, err := parseFeed(data)
+	require.NoError(t, err)
+	for _, item := range page.Channel.Items {
+		seen[item.Title]++
+	}
+	for _, ep := range episodes {
+		assert.Equal(t, 1, seen[ep.Title], ep.Title)
+	}
+	assert.Len(t, seen, len(episodes))
+
+	assert.Equal(t, 25, archiveHeadSize(25, 100, 5, 520), "head is bigger than the rest")
+	assert.Equal(t, 71, archiveHeadSize(25, 100, 5, 571))
+	assert.Equal(t, 25, archiveHeadSize(25, 0, 0, 571), "no pages")
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// ArchiveZip builds zip bundles of episodes ranges, uploads them to archive host and updates archives-zip page.
+// Bundles already listed on the page are published and kept, new ones start after the last of them.
+type ArchiveZip struct {
+	HugoLocation    string   `long:"hugo" env:"HUGO_LOCATION" default:"/srv/podcast-uwp/hugo" description:"hugo site location"`
+	MediaLocation   []string `long:"media" env:"MEDIA_LOCATION" env-delim:"," default:"/srv/podcast-uwp/var/media" description:"local media location(s)"`
+	MediaURL        string   `long:"media-url" default:"https://archive.rucast.net/uwp/media/" description:"media url for files not found locally, bundles url"`
+	Output          string   `long:"output" default:"/srv/podcast-uwp/var/zip" description:"bundles directory"`
+	Size            int      `long:"size" default:"10" description:"episodes per bundle"`
+	From            int      `long:"from" description:"first episode of new bundles, after the last bundle on the page by default"`
+	Force           bool     `long:"force" description:"rebuild existing bundles"`
+	Upload          bool     `long:"upload" description:"upload new bundles to archive host"`
+	User            string   `long:"user" default:"umputun" description:"remote user"`
+	ArchiveHost     string   `long:"archive-host"  default:"archive.rucast.net" description:"archive host"`
+	ArchiveLocation string   `long:"archive-location"  default:"/data/archive/uwp/media/" description:"archive location"`
+	PrivateKeyPath  string   `long:"key"  default:"/Users/umputun/.ssh/id_rsa" description:"private key path"`
+}
+
+// zipManifest is the list of bundles checksums, uploaded along with bundles
+const zipManifest = "archives-zip.sha256"
+
+// zipBundle is a range of episodes in a single zip file
+type zipBundle struct {
+	From, To int
+	Files    []string // media files of existing episodes in the range
+}
+
+var reZipBundleLink = regexp.MustCompile(`\]\([^)]*ump_podcast(\d+)-(\d+)\.zip\)`)
+
+// Name returns bundle file name, like ump_podcast1-10.zip
+func (b zipBundle) Name() string {
+	return fmt.Sprintf("ump_podcast%d-%d.zip", b.From, b.To)
+}
+
+// archiveZipCmd makes missing bundles of published episodes after the already published bundles, writes manifest,
+// uploads new bundles and regenerates the page
+func archiveZipCmd(req ArchiveZip) error {
+	if req.Size <= 0 {
+		return fmt.Errorf("invalid bundle size %d", req.Size)
+	}
+	posts, err := loadPosts(filepath.Join(req.HugoLocation, "content", "posts"))
+	if err != nil {
+		return fmt.Errorf("error loading posts: %w", err)
+	}
+	pageFile := filepath.Join(req.HugoLocation, "content", "pages", "archives-zip.md")
+	published, lines, err := publishedZipBundles(pageFile)
+	if err != nil {
+		return err
+	}
+	from := req.From
+	if from <= 0 {
+		from = 1
+		if len(published) > 0 {
+			from = published[len(published)-1].To + 1
+		}
+	}
+	// published bundles overlapping with the requested range are replaced by new ones
+	for i, b := range published {
+		if b.To >= from {
+			published, lines = published[:i], lines[:i]
+			break
+		}
+	}
+	bundles := zipBundles(publishedEpisodes(posts, nowFn()), from, req.Size)
+	log.Printf("[INFO] %d published bundles, %d bundles from episode %d", len(published), len(bundles), from)
+
+	if err = os.MkdirAll(req.Output, 0o750); err != nil {
+		return fmt.Errorf("error creating output dir %s: %w", req.Output, err)
+	}
+	built := []string{}
+	for _, b := range bundles {
+		file := filepath.Join(req.Output, b.Name())
+		if _, err = os.Stat(file); err == nil && !req.Force {
+			continue
+		}
+		if err = buildZipBundle(file, b, req.MediaLocation, req.MediaURL); err != nil {
+			return err
+		}
+		built = append(built, file)
+	}
+	log.Printf("[INFO] %d bundles built", len(built))
+
+	if err = writeZipManifest(req.Output, append(published, bundles...)); err != nil {
+		return err
+	}
+
+	if req.Upload && len(built) > 0 {
+		files := append(built, filepath.Join(req.Output, zipManifest))
+		if err = uploadArchive(req.User, req.PrivateKeyPath, req.ArchiveHost, req.ArchiveLocation, files...); err != nil {
+			return err
+		}
+	}
+
+	return writeArchivesZipPage(pageFile, lines, bundles, req.MediaURL)
+}
+
+// uploadArchive is used to upload files to archive host, replaced in tests
+var uploadArchive = uploadArchiveFiles
+
+// uploadArchiveFiles uploads files to the archive host location, it is created if missing
+func uploadArchiveFiles(user, keyPath, host, location string, files ...string) error {
+	sshConfig, err := makeSSHConfig(user, keyPath)
+	if err != nil {
+		return err
+	}
+	if err = sshRun(sshConfig, host, fmt.Sprintf("mkdir -p %s", location)); err != nil {
+		return fmt.Errorf("error creating archive directory on archive server: %v", err)
+	}
+	for _, file := range files {
+		if err = scpUpload(sshConfig, file, host, location, keyPath); err != nil {
+			return fmt.Errorf("error copying %s to archive server: %v", file, err)
+		}
+	}
+	return nil
+}
+
+// zipBundles returns complete bundles of size existing episodes starting from the episode number. Missing
+// episode numbers are skipped, the next bundle starts right after the previous one, so ranges have no holes.
+// Episodes sharing media file are bundled once.
+func zipBundles(episodes []Post, from, size int) []zipBundle {
+	sorted := make([]Post, 0, len(episodes))
+	seen := map[string]bool{}
+	for _, ep := range episodes {
+		if ep.Number < from || seen[ep.Filename] {
+			continue
+		}
+		seen[ep.Filename] = true
+		sorted = append(sorted, ep)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Number < sorted[j].Number })
+
+	res := []zipBundle{}
+	for i := 0; i+size <= len(sorted); i += size {
+		b := zipBundle{From: from, To: sorted[i+size-1].Number}
+		for _, ep := range sorted[i : i+size] {
+			b.Files = append(b.Files, ep.Filename+".mp3")
+		}
+		res = append(res, b)
+		from = b.To + 1
+	}
+	return res
+}
+
+// publishedZipBundles returns bundles listed on the page, in page order, and their lines.
+// Missing page has no bundles.
+func publishedZipBundles(file string) (bundles []zipBundle, lines []string, err error) {
+	data, err := os.ReadFile(file) //nolint:gosec
+	if os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't read page %s: %w", file, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		m := reZipBundleLink.FindStringSubmatch(line)
+		if m == nil || !strings.HasPrefix(line, "- ") {
+			continue
+		}
+		b := zipBundle{}
+		b.From, _ = strconv.Atoi(m[1]) // regex guarantees digits
+		b.To, _ = strconv.Atoi(m[2])
+		bundles = append(bundles, b)
+		lines = append(lines, line)
+	}
+	return bundles, lines, nil
+}
+
+// buildZipBundle writes zip with episodes mp3 files stored without compression and SHA256SUMS of them.
+// Files not found locally are downloaded from mediaURL.
+func buildZipBundle(file string, b zipBundle, locations []string, mediaURL string) error {
+	log.Printf("[INFO] build %s", file)
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return fmt.Errorf("error creating temp file for %s: %w", file, err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // removes temp file if rename failed
+
+	zw := zip.NewWriter(tmp)
+	var sums strings.Builder
+	for _, name := range b.Files {
+		src, cleanup, err := bundleMediaFile(name, locations, mediaURL, filepath.Dir(file))
+		if err != nil {
+			_ = tmp.Close()
+			return err
+		}
+		sum, err := addStoredZipEntry(zw, src, name)
+		cleanup()
+		if err != nil {
+			_ = tmp.Close()
+			return fmt.Errorf("error adding %s to %s: %w", name, file, err)
+		}
+		sums.WriteString(sum + "  " + name + "\n")
+	}
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "SHA256SUMS", Method: zip.Deflate, Modified: nowFn()})
+	if err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error adding manifest to %s: %w", file, err)
+	}
+	if _, err = io.WriteString(w, sums.String()); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing manifest to %s: %w", file, err)
+	}
+	if err = zw.Close(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error closing zip %s: %w", file, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("error closing %s: %w", tmp.Name(), err)
+	}
+	if err = os.Chmod(tmp.Name(), 0o644); err != nil { //nolint:gosec // bundles are public
+		return fmt.Errorf("error setting permissions of %s: %w", tmp.Name(), err)
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// bundleMediaFile returns local path of the media file, downloads it to tmpDir if not found locally.
+// cleanup removes downloaded file.
+func bundleMediaFile(name string, locations []string, mediaURL, tmpDir string) (path string, cleanup func(), err error) {
+	for _, loc := range locations {
+		if fi, e := os.Stat(filepath.Join(loc, name)); e == nil && !fi.IsDir() {
+			return filepath.Join(loc, name), func() {}, nil
+		}
+	}
+
+	link := strings.TrimSuffix(mediaURL, "/") + "/" + name
+	log.Printf("[DEBUG] download %s", link)
+	client := http.Client{Timeout: time.Minute * 10}
+	resp, err := client.Get(link)
+	if err != nil {
+		return "", nil, fmt.Errorf("error downloading %s: %w", link, err)
+	}
+	defer resp.Body.Close() //nolint:gosec
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("error downloading %s: status %d", link, resp.StatusCode)
+	}
+
+	tmp, err := os.CreateTemp(tmpDir, "."+name+".*")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating temp file for %s: %w", name, err)
+	}
+	cleanup = func() { _ = os.Remove(tmp.Name()) }
+	if _, err = io.Copy(tmp, resp.Body); err != nil {
+		_ = tmp.Close()
+		cleanup()
+		return "", nil, fmt.Errorf("error downloading %s: %w", link, err)
+	}
+	if err = tmp.Close(); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("error closing %s: %w", tmp.Name(), err)
+	}
+	if lm, e := http.ParseTime(resp.Header.Get("Last-Modified")); e == nil {
+		_ = os.Chtimes(tmp.Name(), lm, lm)
+	}
+	return tmp.Name(), cleanup, nil
+}
+
+// addStoredZipEntry adds file without compression. Crc and size are calculated first, so the entry
+// has no data descriptor and is readable by any unzip. Returns sha256 of the file.
+func addStoredZipEntry(zw *zip.Writer, file, name string) (string, error) {
+	fh, err := os.Open(file) //nolint:gosec
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close() //nolint:errcheck // read only
+
+	crc, sha := crc32.NewIEEE(), sha256.New()
+	size, err := io.Copy(io.MultiWriter(crc, sha), fh)
+	if err != nil {
+		return "", err
+	}
+	fi, err := fh.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	hdr := &zip.FileHeader{Name: name, Method: zip.Store, CRC32: crc.Sum32(),
+		CompressedSize64: uint64(size), UncompressedSize64: uint64(size)}
+	hdr.SetMode(0o644)
+	hdr.SetModTime(fi.ModTime()) //nolint:staticcheck // CreateRaw doesn't convert Modified to msdos time
+	w, err := zw.CreateRaw(hdr)
+	if err != nil {
+		return "", err
+	}
+	if _, err = fh.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(w, fh); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sha.Sum(nil)), nil
+}
+
+// writeZipManifest writes sha256sum compatible list of bundles checksums. Checksums of bundles not kept
+// locally are taken from the previous manifest, bundles unknown to both are skipped.
+func writeZipManifest(dir string, bundles []zipBundle) error {
+	prev := map[string]string{}
+	if data, err := os.ReadFile(filepath.Join(dir, zipManifest)); err == nil { //nolint:gosec
+		for _, line := range strings.Split(string(data), "\n") {
+			if sum, name, ok := strings.Cut(line, "  "); ok {
+				prev[name] = sum
+			}
+		}
+	}
+	var sb strings.Builder
+	for _, b := range bundles {
+		sum, err := fileSHA256(filepath.Join(dir, b.Name()))
+		if err != nil && prev[b.Name()] == "" {
+			log.Printf("[DEBUG] no checksum of %s", b.Name())
+			continue
+		}
+		if err != nil {
+			sum = prev[b.Name()]
+		}
+		sb.WriteString(sum + "  " + b.Name() + "\n")
+	}
+	return writeFileAtomic(filepath.Join(dir, zipManifest), []byte(sb.String()))
+}
+
+func fileSHA256(file string) (string, error) {
+	fh, err := os.Open(file) //nolint:gosec
+	if err != nil {
+		return "", fmt.Errorf("error opening %s: %w", file, err)
+	}
+	defer fh.Close() //nolint:errcheck // read only
+	h := sha256.New()
+	if _, err = io.Copy(h, fh); err != nil {
+		return "", fmt.Errorf("error reading %s: %w", file, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeArchivesZipPage generates the list of bundles after lines of published ones,
+// front matter of existing page is kept as is
+func writeArchivesZipPage(file string, published []string, bundles []zipBundle, mediaURL string) error {
+	frontMatter := "title = \"Архивы подкастов в zip\"\nurl = \"/archives-zip\"\n"
+	if data, err := os.ReadFile(file); err == nil { //nolint:gosec
+		fm, _, e := splitFrontMatter(string(data))
+		if e != nil {
+			return fmt.Errorf("can't parse existing page %s: %w", file, e)
+		}
+		frontMatter = fm
+	}
+
+	var sb strings.Builder
+	sb.WriteString("+++\n" + frontMatter + "+++\n\n")
+	sb.WriteString("<!-- generated by uwp-publisher archive-zip, do not edit -->\n\n")
+	for _, line := range published {
+		sb.WriteString(line + "\n")
+	}
+	for _, b := range bundles {
+		sb.WriteString(fmt.Sprintf("- [Выпуски с %d по %d одним файлом](%s/%s)\n", b.From, b.To,
+			strings.TrimSuffix(mediaURL, "/"), b.Name()))
+	}
+	sb.WriteString(fmt.Sprintf("\nКонтрольные суммы архивов: [%s](%s/%s)\n", zipManifest, strings.TrimSuffix(mediaURL, "/"), zipManifest))
+
+	if err := os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return fmt.Errorf("error creating dir for %s: %w", file, err)
+	}
+	return writeFileAtomic(file, []byte(sb.String()))
+}
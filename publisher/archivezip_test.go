@@ -0,0 +1,185 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveZipCmd(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/media/ump_podcast21.mp3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("remote mp3 21"))
+	}))
+	defer srv.Close()
+
+	// episodes 1-25 without 5 and 17, media of 21 is on remote only
+	hugo := t.TempDir()
+	media := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(hugo, "content", "posts"), 0o700))
+	require.NoError(t, os.MkdirAll(filepath.Join(hugo, "content", "pages"), 0o700))
+	for i := 1; i <= 25; i++ {
+		if i == 5 || i == 17 {
+			continue
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(hugo, "content", "posts", fmt.Sprintf("podcast-%d.md", i)),
+			[]byte(fmt.Sprintf("+++\ntitle = \"UWP - Выпуск %d\"\ndate = \"2010-01-%02dT10:00:00\"\n"+
+				"categories = [\"podcast\"]\nfilename = \"ump_podcast%d\"\n+++\n", i, i, i)), 0o600))
+		if i != 21 {
+			require.NoError(t, os.WriteFile(filepath.Join(media, fmt.Sprintf("ump_podcast%d.mp3", i)),
+				[]byte(fmt.Sprintf("mp3 %d", i)), 0o600))
+		}
+	}
+	publishedLine := "- [Выпуски с 1 по 10 одним файлом](http://archive.rucast.net/uwp/media/ump_podcast1-10.zip)"
+	require.NoError(t, os.WriteFile(filepath.Join(hugo, "content", "pages", "archives-zip.md"),
+		[]byte("+++\ntitle = \"Архивы\"\nurl = \"/archives-zip\"\n+++\n\n"+publishedLine+"\n- old list\n"), 0o600))
+	req := ArchiveZip{HugoLocation: hugo, MediaLocation: []string{media}, MediaURL: srv.URL + "/media/",
+		Output: filepath.Join(t.TempDir(), "zip"), Size: 5}
+	require.NoError(t, os.MkdirAll(req.Output, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(req.Output, zipManifest), []byte("abc  ump_podcast1-10.zip\n"), 0o600))
+
+	require.NoError(t, archiveZipCmd(req))
+	_, err := os.Stat(filepath.Join(req.Output, "ump_podcast1-10.zip"))
+	assert.True(t, os.IsNotExist(err), "published bundle not rebuilt")
+	_, err = os.Stat(filepath.Join(req.Output, "ump_podcast22-25.zip"))
+	assert.True(t, os.IsNotExist(err), "incomplete range not bundled")
+
+	zr, err := zip.OpenReader(filepath.Join(req.Output, "ump_podcast16-21.zip"))
+	require.NoError(t, err)
+	defer zr.Close()
+	require.Len(t, zr.File, 6)
+	names := []string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"ump_podcast16.mp3", "ump_podcast18.mp3", "ump_podcast19.mp3", "ump_podcast20.mp3",
+		"ump_podcast21.mp3", "SHA256SUMS"}, names, "missing 17 skipped")
+	assert.Equal(t, zip.Store, zr.File[0].Method)
+	assert.Equal(t, "remote mp3 21", readZipEntry(t, zr.File[4]))
+	sums := readZipEntry(t, zr.File[5])
+	assert.Contains(t, sums, sha256Hex("mp3 16")+"  ump_podcast16.mp3\n")
+	assert.Contains(t, sums, sha256Hex("remote mp3 21")+"  ump_podcast21.mp3\n")
+
+	manifest, err := os.ReadFile(filepath.Join(req.Output, zipManifest))
+	require.NoError(t, err)
+	sum1, err := fileSHA256(filepath.Join(req.Output, "ump_podcast11-15.zip"))
+	require.NoError(t, err)
+	sum2, err := fileSHA256(filepath.Join(req.Output, "ump_podcast16-21.zip"))
+	require.NoError(t, err)
+	assert.Equal(t, "abc  ump_podcast1-10.zip\n"+sum1+"  ump_podcast11-15.zip\n"+sum2+"  ump_podcast16-21.zip\n",
+		string(manifest), "checksum of published bundle kept")
+
+	page, err := os.ReadFile(filepath.Join(hugo, "content", "pages", "archives-zip.md"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(page), "+++\ntitle = \"Архивы\"\nurl = \"/archives-zip\"\n+++\n\n"))
+	assert.Contains(t, string(page), publishedLine+"\n- [Выпуски с 11 по 15 одним файлом]("+srv.URL+
+		"/media/ump_podcast11-15.zip)\n- [Выпуски с 16 по 21 одним файлом]("+srv.URL+"/media/ump_podcast16-21.zip)\n")
+	assert.NotContains(t, string(page), "old list")
+
+	// second run starts after the last bundle on the page, nothing to build
+	require.NoError(t, os.Remove(filepath.Join(media, "ump_podcast11.mp3")))
+	require.NoError(t, archiveZipCmd(req))
+
+	// existing bundles of the range kept without force
+	fi, err := os.Stat(filepath.Join(req.Output, "ump_podcast11-15.zip"))
+	require.NoError(t, err)
+	req.From = 11
+	require.NoError(t, archiveZipCmd(req))
+	fi2, err := os.Stat(filepath.Join(req.Output, "ump_podcast11-15.zip"))
+	require.NoError(t, err)
+	assert.Equal(t, fi.ModTime(), fi2.ModTime())
+	require.NoError(t, os.WriteFile(filepath.Join(media, "ump_podcast11.mp3"), []byte("mp3 11"), 0o600))
+
+	// explicit start replaces published bundles of the range
+	req.From = 1
+	require.NoError(t, archiveZipCmd(req))
+	zr2, err := zip.OpenReader(filepath.Join(req.Output, "ump_podcast1-6.zip"))
+	require.NoError(t, err)
+	defer zr2.Close()
+	assert.Len(t, zr2.File, 6, "5 episodes without missing 5 and SHA256SUMS")
+	page, err = os.ReadFile(filepath.Join(hugo, "content", "pages", "archives-zip.md"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(page), publishedLine)
+	assert.Contains(t, string(page), "- [Выпуски с 1 по 6 одним файлом]")
+
+	require.NoError(t, os.Remove(filepath.Join(media, "ump_podcast16.mp3")))
+	req.Force = true
+	assert.ErrorContains(t, archiveZipCmd(req), "ump_podcast16.mp3: status 404")
+}
+
+func TestZipBundles(t *testing.T) {
+	eps := []Post{}
+	for _, n := range []int{1, 2, 3, 4, 6, 7, 8, 9, 10, 11, 12, 13, 14} {
+		eps = append(eps, Post{Number: n, Filename: fmt.Sprintf("ump_podcast%d", n)})
+	}
+	eps = append(eps, Post{Number: 13, Filename: "ump_podcast13"}) // duplicate media, like podcast-312
+
+	assert.Equal(t, []zipBundle{}, zipBundles(eps, 1, 20))
+	assert.Equal(t, []zipBundle{
+		{From: 1, To: 6, Files: []string{"ump_podcast1.mp3", "ump_podcast2.mp3", "ump_podcast3.mp3", "ump_podcast4.mp3",
+			"ump_podcast6.mp3"}},
+		{From: 7, To: 11, Files: []string{"ump_podcast7.mp3", "ump_podcast8.mp3", "ump_podcast9.mp3", "ump_podcast10.mp3",
+			"ump_podcast11.mp3"}},
+	}, zipBundles(eps, 1, 5))
+	assert.Equal(t, []zipBundle{{From: 10, To: 14, Files: []string{"ump_podcast10.mp3", "ump_podcast11.mp3",
+		"ump_podcast12.mp3", "ump_podcast13.mp3", "ump_podcast14.mp3"}}}, zipBundles(eps, 10, 5))
+	assert.Equal(t, "ump_podcast11-20.zip", zipBundle{From: 11, To: 20}.Name())
+}
+
+func TestAddStoredZipEntry(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src.mp3")
+	require.NoError(t, os.WriteFile(src, []byte(strings.Repeat("a", 1000)), 0o600))
+	mtime := time.Date(2020, 5, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(src, mtime, mtime))
+
+	file := filepath.Join(t.TempDir(), "test.zip")
+	fh, err := os.Create(file) //nolint:gosec
+	require.NoError(t, err)
+	zw := zip.NewWriter(fh)
+	sum, err := addStoredZipEntry(zw, src, "ump_podcast1.mp3")
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, fh.Close())
+	assert.Equal(t, sha256Hex(strings.Repeat("a", 1000)), sum)
+
+	zr, err := zip.OpenReader(file)
+	require.NoError(t, err)
+	defer zr.Close()
+	require.Len(t, zr.File, 1)
+	f := zr.File[0]
+	assert.Equal(t, zip.Store, f.Method)
+	assert.Equal(t, uint64(1000), f.CompressedSize64, "stored as is")
+	assert.Equal(t, uint16(0), f.Flags&0x8, "no data descriptor")
+	assert.True(t, mtime.Equal(f.Modified.UTC()), f.Modified)
+	assert.Equal(t, strings.Repeat("a", 1000), readZipEntry(t, f))
+}
+
+func readZipEntry(t *testing.T, f *zip.File) string {
+	t.Helper()
+	rc, err := f.Open()
+	require.NoError(t, err)
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func sha256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
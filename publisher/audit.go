@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"golang.org/x/crypto/ssh"
+)
+
+// Audit compares media files on primary and archive hosts with episode posts
+type Audit struct {
+	PostsLocation   string `long:"location" env:"POSTS_LOCATION" default:"/Users/umputun/dev.umputun/podcast-uwp/hugo/content/posts" description:"posts location"`
+	Host            string `long:"host" default:"podcast.umputun.com" description:"primary remote host"`
+	User            string `long:"user" default:"umputun" description:"remote user"`
+	Location        string `long:"media-location" default:"/srv/podcast-uwp/var/media" description:"media location on primary host"`
+	DaysKeep        int    `long:"days-keep" default:"700" description:"days primary host keeps files"`
+	ArchiveHost     string `long:"archive-host" default:"archive.rucast.net" description:"archive host"`
+	ArchiveLocation string `long:"archive-location" default:"/data/archive/uwp/media/" description:"archive location"`
+	PrivateKeyPath  string `long:"key" default:"/Users/umputun/.ssh/id_rsa" description:"private key path"`
+	Format          string `long:"format" choice:"table" choice:"json" default:"table" description:"output format"`
+}
+
+// remoteFile is a media file listed on the host
+type remoteFile struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// auditIssue is a problem with the media file, Episode is 0 for files without a post
+type auditIssue struct {
+	Episode int    `json:"episode,omitempty"`
+	File    string `json:"file"`
+	Host    string `json:"host"` // primary or archive
+	Issue   string `json:"issue"`
+	Details string `json:"details,omitempty"`
+}
+
+// issues reported by audit
+const (
+	auditMissing      = "missing"
+	auditSizeMismatch = "size mismatch"
+	auditNoPost       = "no post"
+	auditNotArchived  = "past retention, not archived"
+	auditHostPrimary  = "primary"
+	auditHostArchive  = "archive"
+)
+
+// auditListing is find -printf format of remote media list, name, size and mtime
+const auditListing = "%f %s %T@\\n"
+
+// auditCmd lists mp3 files on both hosts and reports issues as table or json
+func auditCmd(req Audit) error {
+	posts, err := loadPosts(req.PostsLocation)
+	if err != nil {
+		return fmt.Errorf("error loading posts: %w", err)
+	}
+	sshConfig, err := makeSSHConfig(req.User, req.PrivateKeyPath)
+	if err != nil {
+		return err
+	}
+
+	primary, err := listRemoteMedia(sshConfig, req.Host, req.Location)
+	if err != nil {
+		return err
+	}
+	archive, err := listRemoteMedia(sshConfig, req.ArchiveHost, req.ArchiveLocation)
+	if err != nil {
+		return err
+	}
+
+	issues := auditMedia(posts, primary, archive, nowFn(), req.DaysKeep)
+	if err = writeAuditIssues(os.Stdout, issues, req.Format); err != nil {
+		return err
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("%d media issues found", len(issues))
+	}
+	return nil
+}
+
+// listRemoteMedia lists mp3 files in the location on the host
+func listRemoteMedia(sshConfig *ssh.ClientConfig, host, location string) (map[string]remoteFile, error) {
+	var out bytes.Buffer
+	cmd := fmt.Sprintf("find %s -maxdepth 1 -type f -name '*.mp3' -printf '%s'", strings.TrimSuffix(location, "/"), auditListing)
+	if err := sshExec(sshConfig, host, cmd, &out); err != nil {
+		return nil, fmt.Errorf("error listing media on %s: %v", host, err)
+	}
+	res, err := parseRemoteListing(out.String())
+	if err != nil {
+		return nil, fmt.Errorf("error parsing media list of %s: %w", host, err)
+	}
+	log.Printf("[DEBUG] %d files on %s", len(res), host)
+	return res, nil
+}
+
+// parseRemoteListing parses "name size mtime" lines of find -printf
+func parseRemoteListing(s string) (map[string]remoteFile, error) {
+	res := map[string]remoteFile{}
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		n := len(fields)
+		size, err := strconv.ParseInt(fields[n-2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size in %q: %w", line, err)
+		}
+		mtime, err := strconv.ParseFloat(fields[n-1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mtime in %q: %w", line, err)
+		}
+		name := strings.Join(fields[:n-2], " ")
+		res[name] = remoteFile{Size: size, ModTime: time.Unix(int64(mtime), 0)}
+	}
+	return res, nil
+}
+
+// auditMedia compares files with published episodes. Primary host is expected to keep episodes of the last
+// daysKeep days, archive all of them.
+func auditMedia(posts []Post, primary, archive map[string]remoteFile, now time.Time, daysKeep int) []auditIssue {
+	var res []auditIssue
+	retention := now.AddDate(0, 0, -daysKeep)
+	known := map[string]bool{}
+	for _, ep := range publishedEpisodes(posts, now) {
+		name := ep.Filename + ".mp3"
+		known[name] = true
+		p, onPrimary := primary[name]
+		a, onArchive := archive[name]
+		if !onArchive {
+			res = append(res, auditIssue{Episode: ep.Number, File: name, Host: auditHostArchive, Issue: auditMissing})
+		}
+		if !onPrimary && ep.Date.After(retention) {
+			res = append(res, auditIssue{Episode: ep.Number, File: name, Host: auditHostPrimary, Issue: auditMissing})
+		}
+		if onPrimary && onArchive && p.Size != a.Size {
+			res = append(res, auditIssue{Episode: ep.Number, File: name, Host: auditHostArchive, Issue: auditSizeMismatch,
+				Details: fmt.Sprintf("%d on primary, %d on archive", p.Size, a.Size)})
+		}
+	}
+	for _, p := range posts { // files of drafts and scheduled posts are not orphans
+		if p.Filename != "" {
+			known[p.Filename+".mp3"] = true
+		}
+	}
+
+	for _, dest := range []struct {
+		name  string
+		files map[string]remoteFile
+	}{{auditHostPrimary, primary}, {auditHostArchive, archive}} {
+		for name, f := range dest.files {
+			if !known[name] {
+				res = append(res, auditIssue{Episode: episodeNumber(name), File: name, Host: dest.name, Issue: auditNoPost})
+			}
+			if _, archived := archive[name]; dest.name == auditHostPrimary && !archived && f.ModTime.Before(retention) {
+				res = append(res, auditIssue{Episode: episodeNumber(name), File: name, Host: dest.name, Issue: auditNotArchived,
+					Details: "modified " + f.ModTime.In(siteTZ).Format("2006-01-02")})
+			}
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Episode != res[j].Episode {
+			return res[i].Episode > res[j].Episode
+		}
+		if res[i].File != res[j].File {
+			return res[i].File < res[j].File
+		}
+		if res[i].Host != res[j].Host {
+			return res[i].Host > res[j].Host // primary first
+		}
+		return res[i].Issue < res[j].Issue
+	})
+	return res
+}
+
+// episodeNumber extracts episode number from the file name, 0 if not an episode file
+func episodeNumber(name string) int {
+	m := reEpisodeFile.FindStringSubmatch(name)
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1]) // regex guarantees digits
+	return n
+}
+
+// writeAuditIssues writes issues as table or json
+func writeAuditIssues(w io.Writer, issues []auditIssue, format string) error {
+	switch format {
+	case "json":
+		if issues == nil {
+			issues = []auditIssue{}
+		}
+		data, err := json.MarshalIndent(issues, "", "  ")
+		if err != nil {
+			return fmt.Errorf("can't marshal audit issues: %w", err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NUM\tFILE\tHOST\tISSUE\tDETAILS") //nolint:errcheck
+		for _, issue := range issues {
+			num := "-"
+			if issue.Episode > 0 {
+				num = strconv.Itoa(issue.Episode)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", num, issue.File, issue.Host, issue.Issue, issue.Details) //nolint:errcheck
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRemoteListing(t *testing.T) {
+	res, err := parseRemoteListing("ump_podcast571.mp3 12345 1680000000.1234567890\nump podcast.mp3 10 1600000000.0\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]remoteFile{
+		"ump_podcast571.mp3": {Size: 12345, ModTime: time.Unix(1680000000, 0)},
+		"ump podcast.mp3":    {Size: 10, ModTime: time.Unix(1600000000, 0)},
+	}, res)
+
+	_, err = parseRemoteListing("ump_podcast571.mp3 big 1680000000.0\n")
+	assert.Error(t, err)
+	_, err = parseRemoteListing("ump_podcast571.mp3\n")
+	assert.EqualError(t, err, `invalid line "ump_podcast571.mp3"`)
+}
+
+func TestAuditMedia(t *testing.T) {
+	now := time.Date(2023, 4, 10, 12, 0, 0, 0, siteTZ)
+	posts := []Post{
+		{Filename: "ump_podcast572", Number: 572, Date: now.Add(time.Hour)}, // scheduled
+		{Filename: "ump_podcast571", Number: 571, Date: now.AddDate(0, 0, -5)},
+		{Filename: "ump_podcast570", Number: 570, Date: now.AddDate(0, 0, -12)},
+		{Filename: "ump_podcast400", Number: 400, Date: now.AddDate(-3, 0, 0)},
+		{Filename: "ump_podcast399", Number: 399, Date: now.AddDate(-3, 0, -7)},
+		{Title: "we moved", Date: now.AddDate(0, 0, -1)},
+	}
+	recent, old := now.AddDate(0, 0, -5), now.AddDate(-3, 0, 0)
+	primary := map[string]remoteFile{
+		"ump_podcast572.mp3": {Size: 100, ModTime: recent},
+		"ump_podcast571.mp3": {Size: 100, ModTime: recent},
+		"ump_podcast570.mp3": {Size: 200, ModTime: recent},
+		"ump_podcast300.mp3": {Size: 300, ModTime: old},
+		"test.mp3":           {Size: 1, ModTime: recent},
+	}
+	archive := map[string]remoteFile{
+		"ump_podcast570.mp3": {Size: 201, ModTime: recent},
+		"ump_podcast400.mp3": {Size: 400, ModTime: old},
+		"ump_podcast399.mp3": {Size: 399, ModTime: old},
+		"ump_podcast1.mp3":   {Size: 1, ModTime: old},
+	}
+
+	issues := auditMedia(posts, primary, archive, now, 700)
+	assert.Equal(t, []auditIssue{
+		{Episode: 571, File: "ump_podcast571.mp3", Host: "archive", Issue: "missing"},
+		{Episode: 570, File: "ump_podcast570.mp3", Host: "archive", Issue: "size mismatch", Details: "200 on primary, 201 on archive"},
+		{Episode: 300, File: "ump_podcast300.mp3", Host: "primary", Issue: "no post"},
+		{Episode: 300, File: "ump_podcast300.mp3", Host: "primary", Issue: "past retention, not archived", Details: "modified 2020-04-10"},
+		{Episode: 1, File: "ump_podcast1.mp3", Host: "archive", Issue: "no post"},
+		{File: "test.mp3", Host: "primary", Issue: "no post"},
+	}, issues)
+
+	assert.Empty(t, auditMedia(posts[:1], nil, nil, now, 700), "scheduled episode not expected on hosts")
+	assert.Equal(t, []auditIssue{{Episode: 400, File: "ump_podcast400.mp3", Host: "primary", Issue: "missing"}},
+		auditMedia(posts[3:4], nil, map[string]remoteFile{"ump_podcast400.mp3": {Size: 400}}, now, 1500), "primary keeps episode with longer retention")
+}
+
+func TestWriteAuditIssues(t *testing.T) {
+	issues := []auditIssue{
+		{Episode: 570, File: "ump_podcast570.mp3", Host: "archive", Issue: "size mismatch", Details: "200 on primary, 201 on archive"},
+		{File: "test.mp3", Host: "primary", Issue: "no post"},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, writeAuditIssues(&buf, issues, "table"))
+	assert.Equal(t, "NUM  FILE                HOST     ISSUE          DETAILS\n"+
+		"570  ump_podcast570.mp3  archive  size mismatch  200 on primary, 201 on archive\n"+
+		"-    test.mp3            primary  no post        \n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeAuditIssues(&buf, issues[1:], "json"))
+	assert.JSONEq(t, `[{"file":"test.mp3","host":"primary","issue":"no post"}]`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeAuditIssues(&buf, nil, "json"))
+	assert.Equal(t, "[]\n", buf.String())
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Build renders the site with hugo into a new build directory, generates and validates feeds and the search
+// index there and switches the current symlink served by nginx to it, only if all steps succeeded. Previous builds
+// are kept for rollback. Output of feed options is ignored, feeds are written to the build directory.
+type Build struct {
+	Feed    Feed   `group:"feed options"`
+	HugoCmd string `long:"hugo-cmd" default:"hugo" description:"hugo command, --source and --destination added"`
+	Builds  string `long:"builds" default:"/srv/podcast-uwp/var/site" description:"site builds directory, nginx serves its current symlink"`
+	Keep    int    `long:"keep" default:"5" description:"builds to keep, including the current one"`
+	Lock    string `long:"lock" default:"/srv/podcast-uwp/var/build.lock" description:"build lock file"`
+}
+
+const (
+	siteCurrent   = "current"     // symlink to the served build, relative to builds directory
+	buildManifest = ".build.json" // siteBuild of the build directory
+	buildTmp      = ".tmp-"       // prefix of builds in progress
+	// buildLockEnv is set for commands run by watch, the build lock is held by watch already
+	buildLockEnv = "UWP_BUILD_LOCK_HELD"
+)
+
+// siteBuild describes a build, stored in its directory
+type siteBuild struct {
+	ID        string    `json:"id"`
+	Commit    string    `json:"commit"`
+	Time      time.Time `json:"time"`
+	Episodes  int       `json:"episodes"`
+	FeedItems int       `json:"feed_items"`
+	Current   bool      `json:"-"`
+}
+
+// buildCmd builds the site under the build lock, the lock is skipped if held by the parent watch
+func buildCmd(req Build) error {
+	if os.Getenv(buildLockEnv) == "" {
+		unlock, err := acquireLock(req.Lock)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+	b, err := buildSite(context.Background(), req, shellRunner)
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] site build %s of %s is live, %d episodes, %d feed items", b.ID, shortCommit(b.Commit), b.Episodes, b.FeedItems)
+	return nil
+}
+
+// buildSite makes a new build in temp directory, moves it to builds directory and switches current symlink to it.
+// Temp directory removed on failure, the current build stays untouched.
+func buildSite(ctx context.Context, req Build, run cmdRunner) (siteBuild, error) {
+	hugoDir, err := filepath.Abs(req.Feed.HugoLocation)
+	if err != nil {
+		return siteBuild{}, fmt.Errorf("can't get hugo location: %w", err)
+	}
+	if err = os.MkdirAll(req.Builds, 0o750); err != nil {
+		return siteBuild{}, fmt.Errorf("error creating dir %s: %w", req.Builds, err)
+	}
+	b := siteBuild{Commit: "unknown", Time: nowFn()}
+	if out, e := run(ctx, hugoDir, "git rev-parse HEAD"); e == nil && strings.TrimSpace(out) != "" {
+		b.Commit = strings.TrimSpace(out)
+	}
+	b.ID = b.Time.In(siteTZ).Format("20060102-150405") + "-" + shortCommit(b.Commit)
+
+	tmp, err := os.MkdirTemp(req.Builds, buildTmp)
+	if err != nil {
+		return siteBuild{}, fmt.Errorf("can't make temp build dir: %w", err)
+	}
+	defer os.RemoveAll(tmp) //nolint:errcheck // no-op after successful rename
+
+	log.Printf("[INFO] build %s in %s", b.ID, tmp)
+	hugoCmd := fmt.Sprintf("%s --source %s --destination %s", req.HugoCmd, shellQuote(hugoDir), shellQuote(tmp))
+	if out, e := run(ctx, hugoDir, hugoCmd); e != nil {
+		return siteBuild{}, fmt.Errorf("hugo failed: %v %s", e, strings.TrimSpace(out))
+	}
+
+	feedReq := req.Feed
+	feedReq.HugoLocation, feedReq.Output = hugoDir, tmp
+	if err = feedCmd(feedReq); err != nil {
+		return siteBuild{}, fmt.Errorf("feeds failed: %w", err)
+	}
+	for _, spec := range feedReq.specs(siteConfig{}) {
+		data, e := os.ReadFile(filepath.Join(tmp, spec.File)) //nolint:gosec
+		if e != nil {
+			return siteBuild{}, fmt.Errorf("feed %s is missing: %w", spec.File, e)
+		}
+		if rep := validateFeed(data, nil); len(rep.Errors) > 0 {
+			return siteBuild{}, fmt.Errorf("feed %s is invalid: %s", spec.File, strings.Join(rep.Errors, "; "))
+		}
+	}
+
+	posts, err := loadPosts(filepath.Join(hugoDir, "content", "posts"))
+	if err != nil {
+		return siteBuild{}, fmt.Errorf("error loading posts: %w", err)
+	}
+	b.Episodes = len(publishedEpisodes(posts, nowFn()))
+	site, err := loadSiteConfig(filepath.Join(hugoDir, "config.toml"))
+	if err != nil {
+		return siteBuild{}, err
+	}
+	if err = writeSearchIndex(filepath.Join(tmp, searchIndexFile), makeSearchIndex(posts, site)); err != nil {
+		return siteBuild{}, fmt.Errorf("search index failed: %w", err)
+	}
+	if b.FeedItems, err = countFeedItems(filepath.Join(tmp, "podcast.rss")); err != nil {
+		return siteBuild{}, err
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return siteBuild{}, fmt.Errorf("can't marshal build manifest: %w", err)
+	}
+	if err = os.WriteFile(filepath.Join(tmp, buildManifest), data, 0o644); err != nil { //nolint:gosec // served by nginx
+		return siteBuild{}, fmt.Errorf("can't write build manifest: %w", err)
+	}
+	if err = os.Chmod(tmp, 0o755); err != nil { //nolint:gosec // served by nginx, temp dir made 0700
+		return siteBuild{}, fmt.Errorf("can't set build dir mode: %w", err)
+	}
+
+	// builds run under the lock one by one, but two of them can start in the same second
+	for n, id := 2, b.ID; ; n++ {
+		if _, e := os.Lstat(filepath.Join(req.Builds, b.ID)); os.IsNotExist(e) {
+			break
+		}
+		b.ID = fmt.Sprintf("%s-%d", id, n)
+	}
+	if err = os.Rename(tmp, filepath.Join(req.Builds, b.ID)); err != nil {
+		return siteBuild{}, fmt.Errorf("can't move build %s: %w", b.ID, err)
+	}
+	if err = switchBuild(req.Builds, b.ID); err != nil {
+		return siteBuild{}, err
+	}
+	b.Current = true
+	if err = pruneBuilds(req.Builds, req.Keep); err != nil {
+		log.Printf("[WARN] %v", err)
+	}
+	return b, nil
+}
+
+// shellQuote quotes string for sh, commands of cmdRunner run with sh -c
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// countFeedItems returns number of items in rss feed file
+func countFeedItems(file string) (int, error) {
+	data, err := os.ReadFile(file) //nolint:gosec
+	if err != nil {
+		return 0, fmt.Errorf("can't read feed: %w", err)
+	}
+	var doc feedDoc
+	if err = xml.Unmarshal(data, &doc); err != nil {
+		return 0, fmt.Errorf("can't parse feed %s: %w", file, err)
+	}
+	return len(doc.Channel.Items), nil
+}
+
+// switchBuild points current symlink to the build. New symlink is renamed over the old one, so nginx
+// sees either the old build or the new one.
+func switchBuild(dir, id string) error {
+	if _, err := os.Stat(filepath.Join(dir, id, buildManifest)); err != nil {
+		return fmt.Errorf("build %s not found: %w", id, err)
+	}
+	tmpLink := filepath.Join(dir, buildTmp+siteCurrent)
+	_ = os.Remove(tmpLink)
+	if err := os.Symlink(id, tmpLink); err != nil {
+		return fmt.Errorf("can't make symlink to %s: %w", id, err)
+	}
+	if err := os.Rename(tmpLink, filepath.Join(dir, siteCurrent)); err != nil {
+		_ = os.Remove(tmpLink)
+		return fmt.Errorf("can't switch current build to %s: %w", id, err)
+	}
+	return nil
+}
+
+// listBuilds returns builds of the directory, newest first
+func listBuilds(dir string) ([]siteBuild, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("can't read builds dir %s: %w", dir, err)
+	}
+	current, _ := os.Readlink(filepath.Join(dir, siteCurrent)) // no current build is fine
+	res := []siteBuild{}
+	for _, e := range entries {
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name(), buildManifest)) //nolint:gosec
+		if err != nil {
+			continue // not a build
+		}
+		var b siteBuild
+		if err = json.Unmarshal(data, &b); err != nil {
+			return nil, fmt.Errorf("can't parse manifest of %s: %w", e.Name(), err)
+		}
+		b.ID, b.Current = e.Name(), e.Name() == current
+		res = append(res, b)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID > res[j].ID })
+	return res, nil
+}
+
+// pruneBuilds removes builds beyond keep newest ones, the current build is never removed.
+// Leftovers of interrupted builds removed as well, it runs under the build lock.
+func pruneBuilds(dir string, keep int) error {
+	builds, err := listBuilds(dir)
+	if err != nil {
+		return err
+	}
+	for i, b := range builds {
+		if i < keep || b.Current {
+			continue
+		}
+		log.Printf("[DEBUG] remove old build %s", b.ID)
+		if err = os.RemoveAll(filepath.Join(dir, b.ID)); err != nil {
+			return fmt.Errorf("can't remove old build %s: %w", b.ID, err)
+		}
+	}
+	tmps, err := filepath.Glob(filepath.Join(dir, buildTmp+"*"))
+	if err != nil {
+		return fmt.Errorf("can't list temp builds: %w", err)
+	}
+	for _, t := range tmps {
+		if err = os.RemoveAll(t); err != nil {
+			return fmt.Errorf("can't remove temp build %s: %w", t, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHugo is a cmdRunner making index.html in the destination instead of hugo
+func fakeHugo(t *testing.T, hugoErr error) cmdRunner {
+	return func(_ context.Context, _, command string) (string, error) {
+		if command == "git rev-parse HEAD" {
+			return "0123456789abcdef\n", nil
+		}
+		fields := strings.Fields(command)
+		require.Equal(t, "hugo", fields[0], command)
+		if hugoErr != nil {
+			return "Error: template failed", hugoErr
+		}
+		dest := strings.Trim(fields[len(fields)-1], "'")
+		return "", os.WriteFile(filepath.Join(dest, "index.html"), []byte("site"), 0o600)
+	}
+}
+
+func testBuild(t *testing.T) Build {
+	mediaDir := t.TempDir()
+	mp3 := append([]byte{0xFF, 0xFB, 0x90, 0x00}, make([]byte, 159996)...)
+	require.NoError(t, os.WriteFile(filepath.Join(mediaDir, "ump_podcast571.mp3"), mp3, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(mediaDir, "ump_podcast570.mp3"), mp3, 0o600))
+	return Build{
+		Feed: Feed{HugoLocation: "testdata/hugo", MediaLocation: []string{mediaDir}, MediaURL: "https://podcast.umputun.com/media/",
+			FailbackMediaURL: "http://podcast-failback.umputun.com/media/", ArchiveMediaURL: "https://archive.rucast.net/uwp/media/",
+			Size: 20, ShortArchiveSize: 100, ArchivePageSize: 100},
+		HugoCmd: "hugo", Builds: filepath.Join(t.TempDir(), "site"), Keep: 2,
+	}
+}
+
+func TestBuildSite(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2023, 4, 10, 12, 0, 0, 0, siteTZ) }
+	defer func() { nowFn = time.Now }()
+	req := testBuild(t)
+
+	b, err := buildSite(context.Background(), req, fakeHugo(t, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "20230410-120000-0123456", b.ID)
+	assert.Equal(t, "0123456789abcdef", b.Commit)
+	assert.Equal(t, 2, b.Episodes)
+	assert.Equal(t, 2, b.FeedItems)
+
+	current, err := os.Readlink(filepath.Join(req.Builds, siteCurrent))
+	require.NoError(t, err)
+	assert.Equal(t, b.ID, current)
+	for _, f := range []string{"index.html", "podcast.rss", "podcast-failback.rss", "archives.rss", searchIndexFile, buildManifest} {
+		assert.FileExists(t, filepath.Join(req.Builds, siteCurrent, f))
+	}
+	fi, err := os.Stat(filepath.Join(req.Builds, b.ID))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), fi.Mode().Perm())
+
+	// failed build keeps the current one
+	nowFn = func() time.Time { return time.Date(2023, 4, 10, 13, 0, 0, 0, siteTZ) }
+	_, err = buildSite(context.Background(), req, fakeHugo(t, errors.New("exit status 255")))
+	assert.EqualError(t, err, "hugo failed: exit status 255 Error: template failed")
+	current, err = os.Readlink(filepath.Join(req.Builds, siteCurrent))
+	require.NoError(t, err)
+	assert.Equal(t, b.ID, current)
+	entries, err := os.ReadDir(req.Builds)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "build and current symlink, no temp leftovers")
+
+	// build in the same second gets a suffix
+	b2, err := buildSite(context.Background(), req, fakeHugo(t, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "20230410-130000-0123456", b2.ID)
+	b3, err := buildSite(context.Background(), req, fakeHugo(t, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "20230410-130000-0123456-2", b3.ID)
+	current, err = os.Readlink(filepath.Join(req.Builds, siteCurrent))
+	require.NoError(t, err)
+	assert.Equal(t, b3.ID, current)
+
+	// only last builds kept
+	for h := 14; h <= 16; h++ {
+		hour := h
+		nowFn = func() time.Time { return time.Date(2023, 4, 10, hour, 0, 0, 0, siteTZ) }
+		_, err = buildSite(context.Background(), req, fakeHugo(t, nil))
+		require.NoError(t, err)
+	}
+	builds, err := listBuilds(req.Builds)
+	require.NoError(t, err)
+	require.Len(t, builds, 2)
+	assert.Equal(t, "20230410-160000-0123456", builds[0].ID)
+	assert.True(t, builds[0].Current)
+	assert.Equal(t, "20230410-150000-0123456", builds[1].ID)
+	assert.False(t, builds[1].Current)
+	assert.True(t, time.Date(2023, 4, 10, 15, 0, 0, 0, siteTZ).Equal(builds[1].Time))
+}
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, `'/srv/podcast uwp/hugo'`, shellQuote("/srv/podcast uwp/hugo"))
+	assert.Equal(t, `'it'\''s; rm -rf /'`, shellQuote("it's; rm -rf /"))
+	out, err := shellRunner(context.Background(), t.TempDir(), "printf %s "+shellQuote("a 'b' $HOME;c"))
+	require.NoError(t, err)
+	assert.Equal(t, "a 'b' $HOME;c", out)
+}
+
+func TestBuildSiteInvalidFeed(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, siteTZ) } // before all episodes
+	defer func() { nowFn = time.Now }()
+	req := testBuild(t)
+	_, err := buildSite(context.Background(), req, fakeHugo(t, nil))
+	assert.EqualError(t, err, "feed podcast.rss is invalid: channel: no items")
+	_, err = os.Lstat(filepath.Join(req.Builds, siteCurrent))
+	assert.True(t, os.IsNotExist(err), "nothing switched")
+}
+
+func TestSwitchAndPruneBuilds(t *testing.T) {
+	dir := t.TempDir()
+	for _, id := range []string{"20230401-000000-aaa", "20230402-000000-bbb", "20230403-000000-ccc"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, id), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, id, buildManifest), []byte(`{"commit": "`+id[16:]+`"}`), 0o600))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, buildTmp+"123"), 0o700))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "not-a-build"), 0o700))
+
+	assert.Error(t, switchBuild(dir, "20230404-000000-ddd"))
+	require.NoError(t, switchBuild(dir, "20230401-000000-aaa"))
+	require.NoError(t, pruneBuilds(dir, 1))
+
+	builds, err := listBuilds(dir)
+	require.NoError(t, err)
+	require.Len(t, builds, 2, "newest and current kept")
+	assert.Equal(t, "20230403-000000-ccc", builds[0].ID)
+	assert.Equal(t, "aaa", builds[1].Commit)
+	assert.True(t, builds[1].Current)
+	assert.NoDirExists(t, filepath.Join(dir, buildTmp+"123"))
+	assert.DirExists(t, filepath.Join(dir, "not-a-build"))
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Chapters makes Podcasting 2.0 json chapters from timestamped topics of the episode post
+type Chapters struct {
+	Episode       int         `short:"e" long:"episode" required:"true" description:"episode number"`
+	PostsLocation string      `long:"location" env:"POSTS_LOCATION" default:"/Users/umputun/dev.umputun/podcast-uwp/hugo/content/posts" description:"posts location"`
+	Output        string      `short:"o" long:"output" env:"MEDIA_LOCATION" default:"/srv/podcast-uwp/var/media" description:"local media location, chapters written there before upload"`
+	MediaURL      string      `long:"media-url" default:"https://podcast.umputun.com/media/" description:"media url, chapters uploaded next to mp3"`
+	Upload        MediaUpload `group:"upload options"`
+}
+
+// chaptersDoc is a json chapters document, see https://github.com/Podcastindex-org/podcast-namespace/blob/main/chapters/jsonChapters.md
+type chaptersDoc struct {
+	Version  string    `json:"version"`
+	Title    string    `json:"title,omitempty"`
+	Chapters []chapter `json:"chapters"`
+}
+
+type chapter struct {
+	StartTime float64 `json:"startTime"`
+	Title     string  `json:"title"`
+	URL       string  `json:"url,omitempty"`
+	Img       string  `json:"img,omitempty"`
+}
+
+// reChapterTopic matches topic bullet starting with timestamp, like "- 01:02:03 topic" or "- [12:30] topic"
+var reChapterTopic = regexp.MustCompile(`^\s*[-*+]\s+[\[(]?((?:\d{1,2}:)?\d{1,2}:\d{2})[\])]?\s*[-–—]?\s*(.+)$`)
+
+// chaptersCmd makes chaptersN.json for the episode in media location, uploads it next to mp3 and records its url
+// in the post. The post is not changed if upload failed, feeds would point to a missing file.
+func chaptersCmd(req Chapters) error {
+	post, err := findEpisodePost(req.PostsLocation, req.Episode)
+	if err != nil {
+		return err
+	}
+
+	doc, err := makeChapters(post)
+	if err != nil {
+		return fmt.Errorf("error making chapters for %s: %w", post.Path, err)
+	}
+	log.Printf("[INFO] %d chapters found in %s", len(doc.Chapters), post.Path)
+
+	name := fmt.Sprintf("chapters%d.json", req.Episode)
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling chapters: %w", err)
+	}
+	if err = os.MkdirAll(req.Output, 0o750); err != nil {
+		return fmt.Errorf("error creating dir %s: %w", req.Output, err)
+	}
+	file := filepath.Join(req.Output, name)
+	if err = writeFileAtomic(file, data); err != nil {
+		return err
+	}
+	log.Printf("[INFO] chapters saved to %s", file)
+
+	if err = uploadMedia(req.Upload, file); err != nil {
+		return fmt.Errorf("chapters not uploaded, post not changed: %w", err)
+	}
+	return updatePostFrontMatter(post.Path, "chapters", strings.TrimSuffix(req.MediaURL, "/")+"/"+name)
+}
+
+// makeChapters extracts chapters from topic bullets with timestamps. Link in the topic is used as chapter url
+// and image as chapter image.
+func makeChapters(post Post) (chaptersDoc, error) {
+	res := chaptersDoc{Version: "1.2.0", Title: post.Title}
+	for _, line := range strings.Split(post.Body, "\n") {
+		m := reChapterTopic.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		start, err := parseTimestamp(m[1])
+		if err != nil {
+			return chaptersDoc{}, err
+		}
+		ch := chapter{StartTime: start.Seconds()}
+		text := m[2]
+		if img := reMdImage.FindStringSubmatch(text); img != nil {
+			ch.Img = img[2]
+			text = reMdImage.ReplaceAllString(text, "")
+		}
+		if link := reMdLink.FindStringSubmatch(text); link != nil {
+			ch.URL = link[2]
+		}
+		ch.Title = strings.TrimSpace(reMdBold.ReplaceAllString(reMdLink.ReplaceAllString(text, "$1"), "$1"))
+
+		if n := len(res.Chapters); n > 0 && ch.StartTime <= res.Chapters[n-1].StartTime {
+			return chaptersDoc{}, fmt.Errorf("chapter %q at %s is not after the previous one", ch.Title, m[1])
+		}
+		res.Chapters = append(res.Chapters, ch)
+	}
+	if len(res.Chapters) == 0 {
+		return chaptersDoc{}, fmt.Errorf("no timestamped topics found")
+	}
+	return res, nil
+}
+
+// parseTimestamp parses [HH:]MM:SS
+func parseTimestamp(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	var res time.Duration
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q: %w", s, err)
+		}
+		if i > 0 && v >= 60 {
+			return 0, fmt.Errorf("invalid timestamp %q", s)
+		}
+		res = res*60 + time.Duration(v)
+	}
+	return res * time.Second, nil
+}
+
+// findEpisodePost returns post of the episode by number
+func findEpisodePost(location string, num int) (Post, error) {
+	posts, err := loadPosts(location)
+	if err != nil {
+		return Post{}, fmt.Errorf("error loading posts: %w", err)
+	}
+	for _, p := range posts {
+		if p.Number == num {
+			return p, nil
+		}
+	}
+	return Post{}, fmt.Errorf("post for episode %d not found in %s", num, location)
+}
+
+// updatePostFrontMatter sets front matter key in the post file
+func updatePostFrontMatter(file, key string, value interface{}) error {
+	data, err := os.ReadFile(file) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("error reading post %s: %w", file, err)
+	}
+	content, err := setFrontMatterValue(string(data), key, value)
+	if err != nil {
+		return fmt.Errorf("error updating post %s: %w", file, err)
+	}
+	if err = writeFileAtomic(file, []byte(content)); err != nil {
+		return err
+	}
+	log.Printf("[INFO] post %s updated, %s = %v", file, key, value)
+	return nil
+}
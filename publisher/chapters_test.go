@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeChapters(t *testing.T) {
+	post := Post{Title: "UWP - Выпуск 5", Body: `![](https://podcast.umputun.com/images/uwp/uwp5.jpg)
+
+- 00:00 Вступление
+- [03:15] Новый **MacBook** и [обзор](https://example.com/mb)
+- 12:40 - Электромобили ![](https://example.com/ev.jpg)
+- (01:05:02) Вопросы и ответы
+- тема без времени
+`}
+	doc, err := makeChapters(post)
+	require.NoError(t, err)
+	assert.Equal(t, chaptersDoc{Version: "1.2.0", Title: "UWP - Выпуск 5", Chapters: []chapter{
+		{StartTime: 0, Title: "Вступление"},
+		{StartTime: 195, Title: "Новый MacBook и обзор", URL: "https://example.com/mb"},
+		{StartTime: 760, Title: "Электромобили", Img: "https://example.com/ev.jpg"},
+		{StartTime: 3902, Title: "Вопросы и ответы"},
+	}}, doc)
+
+	_, err = makeChapters(Post{Body: "- 10:00 one\n- 05:00 two\n"})
+	assert.EqualError(t, err, `chapter "two" at 05:00 is not after the previous one`)
+
+	_, err = makeChapters(Post{Body: "- 10:75 one\n"})
+	assert.EqualError(t, err, `invalid timestamp "10:75"`)
+
+	_, err = makeChapters(Post{Body: "- one\n- two\n"})
+	assert.EqualError(t, err, "no timestamped topics found")
+}
+
+func TestChaptersCmd(t *testing.T) {
+	postsDir, outDir := copyTestPosts(t), t.TempDir()
+	postFile := filepath.Join(postsDir, "podcast-571.md")
+	data, err := os.ReadFile(postFile)
+	require.NoError(t, err)
+	data = []byte(replaceAll(string(data), map[string]string{"- Облачные": "- 00:00:10 Облачные",
+		"- Электромобили": "- 00:20:00 Электромобили"}))
+	require.NoError(t, os.WriteFile(postFile, data, 0o600))
+
+	var uploaded []string
+	uploadErr := errors.New("scp failed")
+	defer func(f func(MediaUpload, ...string) error) { uploadMedia = f }(uploadMedia)
+	uploadMedia = func(_ MediaUpload, files ...string) error {
+		if uploadErr != nil {
+			return uploadErr
+		}
+		uploaded = append(uploaded, files...)
+		return nil
+	}
+
+	// post is not changed if upload failed
+	req := Chapters{Episode: 571, PostsLocation: postsDir, Output: outDir, MediaURL: "https://podcast.umputun.com/media"}
+	assert.EqualError(t, chaptersCmd(req), "chapters not uploaded, post not changed: scp failed")
+	post, err := readPost(postFile)
+	require.NoError(t, err)
+	assert.Equal(t, "", tomlString(post.Params, "chapters"))
+
+	uploadErr = nil
+	require.NoError(t, chaptersCmd(req))
+	assert.Equal(t, []string{filepath.Join(outDir, "chapters571.json")}, uploaded)
+
+	data, err = os.ReadFile(filepath.Join(outDir, "chapters571.json"))
+	require.NoError(t, err)
+	var doc chaptersDoc
+	require.NoError(t, json.Unmarshal(data, &doc))
+	assert.Equal(t, []chapter{{StartTime: 10, Title: "Облачные счета за месяц"}, {StartTime: 1200, Title: "Электромобили и зима"}},
+		doc.Chapters)
+
+	post, err = readPost(postFile)
+	require.NoError(t, err)
+	assert.Equal(t, "https://podcast.umputun.com/media/chapters571.json", tomlString(post.Params, "chapters"))
+
+	site, err := loadSiteConfig("testdata/hugo/config.toml")
+	require.NoError(t, err)
+	item := makeFeedItem(site, feedSpec{MediaURL: "https://podcast.umputun.com/media/"}, post, mediaInfo{})
+	assert.Equal(t, &rssMediaRef{URL: "https://podcast.umputun.com/media/chapters571.json", Type: "application/json+chapters"},
+		item.PodcastChapters)
+
+	err = chaptersCmd(Chapters{Episode: 999, PostsLocation: postsDir, Output: outDir})
+	assert.EqualError(t, err, "post for episode 999 not found in "+postsDir)
+}
+
+func replaceAll(s string, pairs map[string]string) string {
+	for k, v := range pairs {
+		s = strings.ReplaceAll(s, k, v)
+	}
+	return s
+}
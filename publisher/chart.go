@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+)
+
+// chartSeries is a named line of the chart, one value per label
+type chartSeries struct {
+	Name   string
+	Values []float64
+}
+
+var chartColors = []string{"#333333", "#6a9fd4", "#d46a6a", "#6ad48a", "#d4b26a", "#9a6ad4", "#6ad4d0", "#d46ab8"}
+
+// svgLineChart renders series as lines over labels on x axis, with legend and a few y grid lines.
+// Labels are thinned out to fit the width.
+func svgLineChart(title string, labels []string, series []chartSeries, width, height int) []byte {
+	c := newChartFrame(title, labels, series, width, height)
+	x := func(i int) float64 {
+		if len(labels) <= 1 {
+			return c.left + c.plotW/2
+		}
+		return c.left + c.plotW*float64(i)/float64(len(labels)-1)
+	}
+	c.axes(x)
+	for si, s := range series {
+		var points bytes.Buffer
+		for i, v := range s.Values {
+			if i >= len(labels) {
+				break
+			}
+			if i > 0 {
+				points.WriteByte(' ')
+			}
+			fmt.Fprintf(&points, "%.1f,%.1f", x(i), c.y(v))
+		}
+		fmt.Fprintf(&c.buf, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`+"\n", c.color(si), points.String())
+		c.legend(si, s.Name)
+	}
+	return c.done()
+}
+
+// svgBarChart renders series as grouped bars, a group per label, with legend and a few y grid lines
+func svgBarChart(title string, labels []string, series []chartSeries, width, height int) []byte {
+	c := newChartFrame(title, labels, series, width, height)
+	slot := c.plotW
+	if len(labels) > 0 {
+		slot = c.plotW / float64(len(labels))
+	}
+	x := func(i int) float64 { return c.left + slot*(float64(i)+0.5) }
+	c.axes(x)
+	barW := slot * 0.8
+	if len(series) > 0 {
+		barW /= float64(len(series))
+	}
+	for si, s := range series {
+		for i, v := range s.Values {
+			if i >= len(labels) {
+				break
+			}
+			bx := c.left + slot*float64(i) + slot*0.1 + barW*float64(si)
+			fmt.Fprintf(&c.buf, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s %s: %s</title></rect>`+"\n",
+				bx, c.y(v), barW, c.top+c.plotH-c.y(v), c.color(si), html.EscapeString(labels[i]), html.EscapeString(s.Name), chartNum(v))
+		}
+		c.legend(si, s.Name)
+	}
+	return c.done()
+}
+
+// chartFrame is a chart in progress, with plot area and y scale set by the max value of all series
+type chartFrame struct {
+	buf                     bytes.Buffer
+	left, top, plotW, plotH float64
+	maxVal                  float64
+	labels                  []string
+}
+
+func newChartFrame(title string, labels []string, series []chartSeries, width, height int) *chartFrame {
+	const left, right, top, bottom = 60, 150, 30, 40
+	c := &chartFrame{left: left, top: top, plotW: float64(width - left - right), plotH: float64(height - top - bottom),
+		labels: labels}
+	for _, s := range series {
+		for _, v := range s.Values {
+			c.maxVal = math.Max(c.maxVal, v)
+		}
+	}
+	c.maxVal = chartNiceMax(c.maxVal)
+
+	fmt.Fprintf(&c.buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(&c.buf, `<rect width="%d" height="%d" fill="#ffffff"/>`+"\n", width, height)
+	fmt.Fprintf(&c.buf, `<text x="%d" y="18" font-size="13" fill="#333">%s</text>`+"\n", left, html.EscapeString(title))
+	return c
+}
+
+func (c *chartFrame) y(v float64) float64 { return c.top + c.plotH - c.plotH*v/c.maxVal }
+
+func (c *chartFrame) color(i int) string { return chartColors[i%len(chartColors)] }
+
+// axes renders y grid lines with values and x labels at positions of x func
+func (c *chartFrame) axes(x func(i int) float64) {
+	for i := 0; i <= 4; i++ {
+		v := c.maxVal * float64(i) / 4
+		fmt.Fprintf(&c.buf, `<line x1="%.0f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#e4e4e4"/>`+"\n", c.left, c.y(v), c.left+c.plotW, c.y(v))
+		fmt.Fprintf(&c.buf, `<text x="%.0f" y="%.1f" text-anchor="end" fill="#999">%s</text>`+"\n", c.left-6, c.y(v)+4, chartNum(v))
+	}
+	step := 1
+	if maxLabels := int(c.plotW / 70); maxLabels > 0 && len(c.labels) > maxLabels {
+		step = (len(c.labels) + maxLabels - 1) / maxLabels
+	}
+	for i := 0; i < len(c.labels); i += step {
+		fmt.Fprintf(&c.buf, `<text x="%.1f" y="%.1f" text-anchor="middle" fill="#999">%s</text>`+"\n",
+			x(i), c.top+c.plotH+16, html.EscapeString(c.labels[i]))
+	}
+}
+
+// legend renders color box and name of the series on the right side
+func (c *chartFrame) legend(i int, name string) {
+	ly := c.top + 14*float64(i)
+	fmt.Fprintf(&c.buf, `<rect x="%.1f" y="%.0f" width="10" height="10" fill="%s"/>`+"\n", c.left+c.plotW+12, ly, c.color(i))
+	fmt.Fprintf(&c.buf, `<text x="%.1f" y="%.0f" fill="#333">%s</text>`+"\n", c.left+c.plotW+26, ly+9, html.EscapeString(name))
+}
+
+func (c *chartFrame) done() []byte {
+	c.buf.WriteString("</svg>\n")
+	return c.buf.Bytes()
+}
+
+// chartNiceMax rounds max value up to 1, 2 or 5 times power of 10, so grid lines get round values
+func chartNiceMax(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	p := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if v <= m*p {
+			return m * p
+		}
+	}
+	return 10 * p
+}
+
+// chartNum formats axis value as integer with k, M, G suffixes
+func chartNum(v float64) string {
+	switch {
+	case v >= 1e9:
+		return fmt.Sprintf("%gG", math.Round(v/1e8)/10)
+	case v >= 1e6:
+		return fmt.Sprintf("%gM", math.Round(v/1e5)/10)
+	case v >= 1e3:
+		return fmt.Sprintf("%gk", math.Round(v/1e2)/10)
+	}
+	return fmt.Sprintf("%g", math.Round(v*10)/10)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSvgLineChart(t *testing.T) {
+	svg := string(svgLineChart("Title <x>", []string{"d1", "d2", "d3"},
+		[]chartSeries{{Name: "total", Values: []float64{10, 20, 15}}, {Name: "app", Values: []float64{0, 5, 5}}}, 410, 200))
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="410" height="200"`))
+	assert.Contains(t, svg, ">Title &lt;x&gt;</text>")
+	assert.Contains(t, svg, `<polyline fill="none" stroke="#333333" stroke-width="2" points="60.0,95.0 160.0,30.0 260.0,62.5"/>`)
+	assert.Contains(t, svg, `<polyline fill="none" stroke="#6a9fd4" stroke-width="2" points="60.0,160.0 160.0,127.5 260.0,127.5"/>`)
+	assert.Contains(t, svg, `text-anchor="end" fill="#999">20</text>`)
+	assert.Contains(t, svg, ">d3</text>")
+	assert.NotContains(t, svg, ">d2</text>", "labels thinned out to fit")
+	assert.True(t, strings.HasSuffix(svg, "</svg>\n"))
+}
+
+func TestChartNiceMax(t *testing.T) {
+	for in, out := range map[float64]float64{0: 1, 0.3: 0.5, 7: 10, 10: 10, 11: 20, 120: 200, 4500: 5000} {
+		assert.InDelta(t, out, chartNiceMax(in), 1e-9, "%v", in)
+	}
+	assert.Equal(t, "1.5k", chartNum(1500))
+	assert.Equal(t, "2M", chartNum(2e6))
+	assert.Equal(t, "12", chartNum(12))
+}
+
+func TestSvgBarChart(t *testing.T) {
+	svg := string(svgBarChart("Bars", []string{"a", "b"},
+		[]chartSeries{{Name: "rx", Values: []float64{10, 20}}, {Name: "tx", Values: []float64{5, 0}}}, 410, 200))
+	assert.Contains(t, svg, `<rect x="70.0" y="95.0" width="40.0" height="65.0" fill="#333333"><title>a rx: 10</title></rect>`)
+	assert.Contains(t, svg, `<rect x="170.0" y="30.0" width="40.0" height="130.0" fill="#333333"><title>b rx: 20</title></rect>`)
+	assert.Contains(t, svg, `<rect x="110.0" y="127.5" width="40.0" height="32.5" fill="#6a9fd4"><title>a tx: 5</title></rect>`)
+	assert.Contains(t, svg, `x="110.0" y="176.0" text-anchor="middle" fill="#999">a</text>`)
+	assert.Contains(t, svg, ">tx</text>")
+}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// StatsDownloads counts unique episode downloads from nginx access logs written by docker json-file driver
+// and from serve-media events log. Events have bytes actually sent, so since the first event media requests
+// of access logs are ignored, nginx logs them too as proxied.
+type StatsDownloads struct {
+	Logs     []string      `long:"log" default:"/var/lib/docker/containers/*/*-json.log*" description:"docker json-file log files, globs allowed"`
+	Events   []string      `long:"events" default:"/srv/podcast-uwp/var/stats/media-events.log*" description:"serve-media events log files, globs allowed"`
+	Output   string        `long:"output" default:"/srv/podcast-uwp/var/stats" description:"stats directory"`
+	Window   time.Duration `long:"window" default:"24h" description:"requests of the same ip and user agent within window are one download"`
+	MinBytes int64         `long:"min-bytes" default:"960000" description:"min bytes sent to count download, about a minute of audio"`
+	Days     int           `long:"days" default:"30" description:"days in html report"`
+}
+
+const (
+	downloadsJSON = "downloads.json"
+	downloadsHTML = "downloads.html"
+)
+
+// downloadRequest is a media request from the access log
+type downloadRequest struct {
+	Time   time.Time
+	IP, UA string
+	File   string
+	Status int
+	Bytes  int64
+}
+
+// downloadStats is the json stats file, history is kept between runs as logs are rotated
+type downloadStats struct {
+	Updated  time.Time          `json:"updated"`
+	Episodes []episodeDownloads `json:"episodes"`
+}
+
+// episodeDownloads is a number of downloads of the media file per day
+type episodeDownloads struct {
+	File    string         `json:"file"`
+	Episode int            `json:"episode,omitempty"`
+	Total   int            `json:"total"`
+	Days    map[string]int `json:"days"` // day in site time zone, as 2006-01-02
+}
+
+var (
+	// reAccessLog matches nginx combined log format, optional x-forwarded-for of the main format is ignored
+	reAccessLog = regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) (\S+)[^"]*" (\d{3}) (\d+|-) "[^"]*" "([^"]*)"`)
+	reMediaPath = regexp.MustCompile(`^/media/([^/?#]+\.mp3)(?:[?#].*)?$`)
+	reBotAgent  = regexp.MustCompile(`(?i)bot|crawl|spider|curl|wget|python|go-http-client|java/|libwww|httpclient|feedfetcher|monitor`)
+)
+
+//go:embed stats-downloads.tmpl
+var downloadsTmpl string
+
+// statsDownloadsCmd parses logs, merges counts with the previous stats and writes json and html report
+func statsDownloadsCmd(req StatsDownloads) error {
+	files, err := expandGlobs(req.Logs)
+	if err != nil {
+		return err
+	}
+	reqs, err := readDownloadRequests(files)
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] %d media requests in %d log files", len(reqs), len(files))
+
+	eventFiles, err := expandGlobs(req.Events)
+	if err != nil {
+		return err
+	}
+	events, err := readMediaEvents(eventFiles)
+	if err != nil {
+		return err
+	}
+	if len(events) > 0 {
+		reqs = mergeMediaEvents(reqs, events)
+		log.Printf("[INFO] %d media events in %d files, access logs used before %s", len(events), len(eventFiles),
+			events[0].Time.Format(time.RFC3339))
+	}
+
+	counts := countDownloads(reqs, req.Window, req.MinBytes)
+	jsonFile := filepath.Join(req.Output, downloadsJSON)
+	stats := downloadStats{}
+	if data, e := os.ReadFile(jsonFile); e == nil { //nolint:gosec
+		if e = json.Unmarshal(data, &stats); e != nil {
+			return fmt.Errorf("can't parse %s: %w", jsonFile, e)
+		}
+	}
+	stats = mergeDownloads(stats, counts)
+	stats.Updated = nowFn()
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal download stats: %w", err)
+	}
+	if err = os.MkdirAll(req.Output, 0o750); err != nil {
+		return fmt.Errorf("error creating dir %s: %w", req.Output, err)
+	}
+	if err = writeFileAtomic(jsonFile, data); err != nil {
+		return err
+	}
+	html, err := downloadsReport(stats, req.Days)
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(filepath.Join(req.Output, downloadsHTML), html); err != nil {
+		return err
+	}
+	log.Printf("[INFO] download stats of %d files saved to %s", len(stats.Episodes), req.Output)
+	return nil
+}
+
+// expandGlobs returns files matching patterns, sorted and without duplicates
+func expandGlobs(patterns []string) ([]string, error) {
+	seen := map[string]bool{}
+	res := []string{}
+	for _, p := range patterns {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				res = append(res, m)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// accessRecord is a request from nginx access log
+type accessRecord struct {
+	Time                 time.Time
+	IP, Method, Path, UA string
+	Status               int
+	Bytes                int64
+}
+
+// readDownloadRequests reads media requests from docker json-file logs
+func readDownloadRequests(files []string) ([]downloadRequest, error) {
+	var res []downloadRequest
+	err := readAccessLogs(files, func(rec accessRecord) {
+		if r, ok := downloadFromRecord(rec); ok {
+			res = append(res, r)
+		}
+	})
+	return res, err
+}
+
+// readMediaEvents reads download requests from serve-media events logs, sorted by time
+func readMediaEvents(files []string) ([]downloadRequest, error) {
+	var res []downloadRequest
+	for _, file := range files {
+		fh, err := os.Open(file) //nolint:gosec
+		if err != nil {
+			return nil, fmt.Errorf("error opening events log %s: %w", file, err)
+		}
+		scanner := bufio.NewScanner(fh)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var ev mediaEvent
+			if err = json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+				continue // partial line of the crashed writer
+			}
+			rec := accessRecord{Time: ev.Time, IP: ev.IP, Method: "GET", Path: "/media/" + ev.File, UA: ev.UA,
+				Status: ev.Status, Bytes: ev.Bytes}
+			if r, ok := downloadFromRecord(rec); ok {
+				res = append(res, r)
+			}
+		}
+		err = scanner.Err()
+		_ = fh.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading events log %s: %w", file, err)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Time.Before(res[j].Time) })
+	return res, nil
+}
+
+// mergeMediaEvents replaces access log requests made since the first event by events, sorted events expected
+func mergeMediaEvents(reqs, events []downloadRequest) []downloadRequest {
+	res := make([]downloadRequest, 0, len(reqs)+len(events))
+	for _, r := range reqs {
+		if r.Time.Before(events[0].Time) {
+			res = append(res, r)
+		}
+	}
+	return append(res, events...)
+}
+
+// readAccessLogs calls fn for each request of docker json-file logs, plain access log lines accepted too
+func readAccessLogs(files []string, fn func(rec accessRecord)) error {
+	for _, file := range files {
+		fh, err := os.Open(file) //nolint:gosec
+		if err != nil {
+			return fmt.Errorf("error opening log %s: %w", file, err)
+		}
+		scanner := bufio.NewScanner(fh)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if bytes.HasPrefix(line, []byte("{")) {
+				var rec struct {
+					Log string `json:"log"`
+				}
+				if err = json.Unmarshal(line, &rec); err != nil {
+					continue
+				}
+				line = []byte(rec.Log)
+			}
+			if rec, ok := parseAccessRecord(strings.TrimSpace(string(line))); ok {
+				fn(rec)
+			}
+		}
+		err = scanner.Err()
+		_ = fh.Close()
+		if err != nil {
+			return fmt.Errorf("error reading log %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// parseAccessRecord parses nginx access log line in combined format
+func parseAccessRecord(line string) (accessRecord, bool) {
+	m := reAccessLog.FindStringSubmatch(line)
+	if m == nil {
+		return accessRecord{}, false
+	}
+	ts, err := time.Parse("02/Jan/2006:15:04:05 -0700", m[2])
+	if err != nil {
+		return accessRecord{}, false
+	}
+	status, _ := strconv.Atoi(m[5])           // regex guarantees digits
+	size, _ := strconv.ParseInt(m[6], 10, 64) // "-" is 0
+	return accessRecord{Time: ts, IP: m[1], Method: m[3], Path: m[4], Status: status, Bytes: size, UA: m[7]}, true
+}
+
+// downloadFromRecord accepts GET request of mp3 in /media/, served (200, 206) or redirected to archive (302).
+// Requests of bots are skipped.
+func downloadFromRecord(rec accessRecord) (downloadRequest, bool) {
+	if rec.Method != "GET" || reBotAgent.MatchString(rec.UA) {
+		return downloadRequest{}, false
+	}
+	media := reMediaPath.FindStringSubmatch(rec.Path)
+	if media == nil {
+		return downloadRequest{}, false
+	}
+	if rec.Status != 200 && rec.Status != 206 && rec.Status != 302 {
+		return downloadRequest{}, false
+	}
+	return downloadRequest{Time: rec.Time, IP: rec.IP, UA: rec.UA, File: media[1], Status: rec.Status, Bytes: rec.Bytes}, true
+}
+
+// countDownloads counts downloads per file per day, IAB style. Requests of the same ip, user agent and file
+// within window from the first one are a single download, range requests are combined and counted once
+// the sum of sent bytes reaches minBytes. Redirect to archive counted as download, the bytes are sent by archive.
+func countDownloads(reqs []downloadRequest, window time.Duration, minBytes int64) map[string]map[string]int {
+	type session struct {
+		start   time.Time
+		bytes   int64
+		counted bool
+	}
+	sorted := make([]downloadRequest, len(reqs))
+	copy(sorted, reqs)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Time.Before(sorted[j].Time) })
+
+	res := map[string]map[string]int{}
+	sessions := map[string]*session{}
+	for _, r := range sorted {
+		key := r.IP + "\x00" + r.UA + "\x00" + r.File
+		s := sessions[key]
+		if s == nil || r.Time.Sub(s.start) >= window {
+			s = &session{start: r.Time}
+			sessions[key] = s
+		}
+		if s.counted {
+			continue
+		}
+		s.bytes += r.Bytes
+		if r.Status == 302 || s.bytes >= minBytes {
+			s.counted = true
+			day := s.start.In(siteTZ).Format("2006-01-02")
+			if res[r.File] == nil {
+				res[r.File] = map[string]int{}
+			}
+			res[r.File][day]++
+		}
+	}
+	return res
+}
+
+// mergeDownloads adds counts to stats. Counts of the same day are not added but the bigger one kept,
+// the day is counted again from logs on each run and older part of the day may be rotated out.
+func mergeDownloads(stats downloadStats, counts map[string]map[string]int) downloadStats {
+	idx := map[string]int{}
+	for i, ep := range stats.Episodes {
+		idx[ep.File] = i
+	}
+	for file, days := range counts {
+		i, ok := idx[file]
+		if !ok {
+			stats.Episodes = append(stats.Episodes, episodeDownloads{File: file, Episode: episodeNumber(file)})
+			i = len(stats.Episodes) - 1
+			idx[file] = i
+		}
+		ep := &stats.Episodes[i]
+		if ep.Days == nil {
+			ep.Days = map[string]int{}
+		}
+		for day, n := range days {
+			if n > ep.Days[day] {
+				ep.Days[day] = n
+			}
+		}
+	}
+	for i := range stats.Episodes {
+		stats.Episodes[i].Total = 0
+		for _, n := range stats.Episodes[i].Days {
+			stats.Episodes[i].Total += n
+		}
+	}
+	sort.Slice(stats.Episodes, func(i, j int) bool {
+		if stats.Episodes[i].Episode != stats.Episodes[j].Episode {
+			return stats.Episodes[i].Episode > stats.Episodes[j].Episode
+		}
+		return stats.Episodes[i].File < stats.Episodes[j].File
+	})
+	return stats
+}
+
+// downloadsReport renders html report with daily totals of the last days and downloads per episode
+func downloadsReport(stats downloadStats, days int) ([]byte, error) {
+	type dayTotal struct {
+		Day   string
+		Count int
+		Width int // bar width in percents of the max day
+	}
+	type episodeRow struct {
+		episodeDownloads
+		Recent int // downloads in the last days
+	}
+
+	end := stats.Updated.In(siteTZ)
+	var totals []dayTotal
+	maxCount := 0
+	for i := days - 1; i >= 0; i-- {
+		day := end.AddDate(0, 0, -i).Format("2006-01-02")
+		t := dayTotal{Day: day}
+		for _, ep := range stats.Episodes {
+			t.Count += ep.Days[day]
+		}
+		if t.Count > maxCount {
+			maxCount = t.Count
+		}
+		totals = append(totals, t)
+	}
+	for i := range totals {
+		if maxCount > 0 {
+			totals[i].Width = totals[i].Count * 100 / maxCount
+		}
+	}
+
+	from := end.AddDate(0, 0, -days+1).Format("2006-01-02")
+	rows := make([]episodeRow, 0, len(stats.Episodes))
+	for _, ep := range stats.Episodes {
+		row := episodeRow{episodeDownloads: ep}
+		for day, n := range ep.Days {
+			if day >= from {
+				row.Recent += n
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	tmpl, err := template.New("downloads").Parse(downloadsTmpl)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse downloads template: %w", err)
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		Updated string
+		Days    int
+		Totals  []dayTotal
+		Rows    []episodeRow
+	}{Updated: end.Format("2006-01-02 15:04:05 MST"), Days: days, Totals: totals, Rows: rows})
+	if err != nil {
+		return nil, fmt.Errorf("can't render downloads report: %w", err)
+	}
+	return buf.Bytes(), nil
+}
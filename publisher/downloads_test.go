@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsDownloadsCmd(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2023, 4, 10, 12, 0, 0, 0, siteTZ) }
+	defer func() { nowFn = time.Now }()
+
+	dir := t.TempDir()
+	logLine := func(s string) string {
+		data, err := json.Marshal(map[string]string{"log": s + "\n", "stream": "stdout", "time": "2023-04-09T10:00:00Z"})
+		require.NoError(t, err)
+		return string(data) + "\n"
+	}
+	rotated := logLine(`1.1.1.1 - - [09/Apr/2023:10:00:00 -0500] "GET /media/ump_podcast571.mp3 HTTP/1.1" 200 50000000 "-" "AppleCoreMedia/1.0"`) +
+		logLine(`2.2.2.2 - - [09/Apr/2023:11:00:00 -0500] "GET /media/ump_podcast571.mp3 HTTP/2.0" 206 500000 "-" "Overcast/3.0"`) +
+		"not a json line\n"
+	current := logLine(`2.2.2.2 - - [09/Apr/2023:11:00:05 -0500] "GET /media/ump_podcast571.mp3 HTTP/2.0" 206 600000 "-" "Overcast/3.0"`) +
+		logLine(`3.3.3.3 - - [09/Apr/2023:12:00:00 -0500] "GET /media/ump_podcast100.mp3 HTTP/1.1" 302 145 "-" "Podcasts/1.0"`) +
+		logLine(`4.4.4.4 - - [09/Apr/2023:12:00:00 -0500] "GET /media/ump_podcast571.mp3 HTTP/1.1" 200 50000000 "-" "Googlebot/2.1"`) +
+		logLine(`5.5.5.5 - - [09/Apr/2023:12:00:00 -0500] "GET /podcast.rss HTTP/1.1" 200 5000 "-" "Overcast/3.0"`)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "abc-json.log.1"), []byte(rotated), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "abc-json.log"), []byte(current), 0o600))
+
+	out := filepath.Join(t.TempDir(), "stats")
+	require.NoError(t, os.MkdirAll(out, 0o700))
+	prev := `{"episodes": [{"file": "ump_podcast571.mp3", "episode": 571, "total": 7, "days": {"2023-04-08": 5, "2023-04-09": 1}}]}`
+	require.NoError(t, os.WriteFile(filepath.Join(out, downloadsJSON), []byte(prev), 0o600))
+
+	req := StatsDownloads{Logs: []string{filepath.Join(dir, "*-json.log*")}, Output: out, Window: 24 * time.Hour,
+		MinBytes: 960000, Days: 3}
+	require.NoError(t, statsDownloadsCmd(req))
+
+	data, err := os.ReadFile(filepath.Join(out, downloadsJSON))
+	require.NoError(t, err)
+	var stats downloadStats
+	require.NoError(t, json.Unmarshal(data, &stats))
+	assert.Equal(t, []episodeDownloads{
+		{File: "ump_podcast571.mp3", Episode: 571, Total: 7, Days: map[string]int{"2023-04-08": 5, "2023-04-09": 2}},
+		{File: "ump_podcast100.mp3", Episode: 100, Total: 1, Days: map[string]int{"2023-04-09": 1}},
+	}, stats.Episodes)
+	assert.True(t, nowFn().Equal(stats.Updated))
+
+	html, err := os.ReadFile(filepath.Join(out, downloadsHTML))
+	require.NoError(t, err)
+	assert.Contains(t, string(html), `<tr><td>2023-04-09</td><td class="num">3</td><td><div class="bar" style="width: 60%"></div></td></tr>`)
+	assert.Contains(t, string(html), `<tr><td>2023-04-08</td><td class="num">5</td>`)
+	assert.Contains(t, string(html), `<tr><td>571</td><td>ump_podcast571.mp3</td><td class="num">7</td><td class="num">7</td></tr>`)
+}
+
+func TestStatsDownloadsCmdEvents(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2023, 4, 10, 12, 0, 0, 0, siteTZ) }
+	defer func() { nowFn = time.Now }()
+
+	dir := t.TempDir()
+	// nginx logs proxied requests too, only ones before the first event are used
+	access := `1.1.1.1 - - [09/Apr/2023:10:00:00 -0500] "GET /media/ump_podcast571.mp3 HTTP/1.1" 200 50000000 "-" "AppleCoreMedia/1.0"
+6.6.6.6 - - [09/Apr/2023:13:00:00 -0500] "GET /media/ump_podcast571.mp3 HTTP/1.1" 200 50000000 "-" "Overcast/3.0"
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "abc-json.log"), []byte(access), 0o600))
+	events := `{"time":"2023-04-09T17:30:00Z","ip":"7.7.7.7","ua":"Pocket Casts","file":"ump_podcast571.mp3","status":206,"range":"bytes=0-","bytes":2000000}
+{"time":"2023-04-09T18:00:00Z","ip":"6.6.6.6","ua":"Overcast/3.0","file":"ump_podcast571.mp3","status":200,"bytes":1000}
+{"time":"2023-04-09T18:00:00Z","ip":"4.4.4.4","ua":"Googlebot/2.1","file":"ump_podcast571.mp3","status":200,"bytes":50000000,"complete":true}
+{"time":"2023-04-09T18:10:00Z","ip":"8.8.8.8","ua":"Overcast/3.0","file":"ump_podcast571.mp3","status":404,"bytes":0}
+{"time":"2023-04-09T18:20:00Z","ip":"9.9.9.9","ua":"Overcast/3.0","file":"ump_pod`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "media-events.log"), []byte(events), 0o600))
+
+	out := filepath.Join(t.TempDir(), "stats")
+	req := StatsDownloads{Logs: []string{filepath.Join(dir, "*-json.log*")}, Events: []string{filepath.Join(dir, "media-events.log*")},
+		Output: out, Window: 24 * time.Hour, MinBytes: 960000, Days: 3}
+	require.NoError(t, statsDownloadsCmd(req))
+
+	data, err := os.ReadFile(filepath.Join(out, downloadsJSON))
+	require.NoError(t, err)
+	var stats downloadStats
+	require.NoError(t, json.Unmarshal(data, &stats))
+	assert.Equal(t, []episodeDownloads{
+		{File: "ump_podcast571.mp3", Episode: 571, Total: 2, Days: map[string]int{"2023-04-09": 2}},
+	}, stats.Episodes, "dropped download of 6.6.6.6 logged by nginx as full not counted")
+}
+
+func TestDownloadFromRecord(t *testing.T) {
+	tbl := []struct {
+		line string
+		ok   bool
+		res  downloadRequest
+	}{
+		{`1.1.1.1 - - [09/Apr/2023:10:00:00 -0500] "GET /media/ump_podcast571.mp3?from=rss HTTP/1.1" 206 1024 "-" "Overcast/3.0" "-"`, true,
+			downloadRequest{Time: time.Date(2023, 4, 9, 15, 0, 0, 0, time.UTC), IP: "1.1.1.1", UA: "Overcast/3.0",
+				File: "ump_podcast571.mp3", Status: 206, Bytes: 1024}},
+		{`1.1.1.1 - - [09/Apr/2023:10:00:00 -0500] "GET /media/ump_podcast100.mp3 HTTP/1.1" 302 - "-" "Podcasts/1.0"`, true,
+			downloadRequest{Time: time.Date(2023, 4, 9, 15, 0, 0, 0, time.UTC), IP: "1.1.1.1", UA: "Podcasts/1.0",
+				File: "ump_podcast100.mp3", Status: 302}},
+		{`1.1.1.1 - - [09/Apr/2023:10:00:00 -0500] "HEAD /media/ump_podcast571.mp3 HTTP/1.1" 200 0 "-" "Overcast/3.0"`, false, downloadRequest{}},
+		{`1.1.1.1 - - [09/Apr/2023:10:00:00 -0500] "GET /media/ump_podcast571.mp3 HTTP/1.1" 416 0 "-" "Overcast/3.0"`, false, downloadRequest{}},
+		{`1.1.1.1 - - [09/Apr/2023:10:00:00 -0500] "GET /media/sub/ump_podcast571.mp3 HTTP/1.1" 200 10 "-" "Overcast/3.0"`, false, downloadRequest{}},
+		{`1.1.1.1 - - [09/Apr/2023:10:00:00 -0500] "GET /media/ump_podcast571.mp3 HTTP/1.1" 200 10 "-" "curl/7.88"`, false, downloadRequest{}},
+		{`garbage`, false, downloadRequest{}},
+	}
+	for i, tt := range tbl {
+		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
+			rec, ok := parseAccessRecord(tt.line)
+			res := downloadRequest{}
+			if ok {
+				res, ok = downloadFromRecord(rec)
+			}
+			assert.Equal(t, tt.ok, ok)
+			assert.True(t, tt.res.Time.Equal(res.Time))
+			res.Time = tt.res.Time
+			assert.Equal(t, tt.res, res)
+		})
+	}
+}
+
+func TestCountDownloads(t *testing.T) {
+	base := time.Date(2023, 4, 9, 23, 30, 0, 0, siteTZ)
+	req := func(ip string, offset time.Duration, status int, size int64) downloadRequest {
+		return downloadRequest{Time: base.Add(offset), IP: ip, UA: "ua", File: "ump_podcast571.mp3", Status: status, Bytes: size}
+	}
+	reqs := []downloadRequest{
+		// ranges combined, counted on the day of the first request
+		req("1.1.1.1", time.Hour, 206, 600), req("1.1.1.1", 0, 206, 2), req("1.1.1.1", 2*time.Hour, 206, 600),
+		// repeated within window
+		req("2.2.2.2", 0, 200, 1000), req("2.2.2.2", 23*time.Hour, 200, 1000),
+		// next window
+		req("2.2.2.2", 25*time.Hour, 200, 1000),
+		// probe only
+		req("3.3.3.3", 0, 206, 2),
+		// redirect
+		req("4.4.4.4", 0, 302, 145),
+	}
+	assert.Equal(t, map[string]map[string]int{"ump_podcast571.mp3": {"2023-04-09": 3, "2023-04-11": 1}},
+		countDownloads(reqs, 24*time.Hour, 1000))
+}
+
+func TestExpandGlobs(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"a-json.log", "a-json.log.1", "b.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f), nil, 0o600))
+	}
+	res, err := expandGlobs([]string{filepath.Join(dir, "*-json.log*"), filepath.Join(dir, "a-json.log")})
+	require.NoError(t, err)
+	for i := range res {
+		res[i] = strings.TrimPrefix(res[i], dir+"/")
+	}
+	assert.Equal(t, []string{"a-json.log", "a-json.log.1"}, res)
+}
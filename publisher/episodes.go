@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Episodes lists posts matching filters as table, json or csv
+type Episodes struct {
+	PostsLocation string `long:"location" env:"POSTS_LOCATION" default:"/Users/umputun/dev.umputun/podcast-uwp/hugo/content/posts" description:"posts location"`
+	From          string `long:"from" description:"from date, inclusive, as 2006, 2006-01 or 2006-01-02"`
+	To            string `long:"to" description:"to date, inclusive, as 2006, 2006-01 or 2006-01-02"`
+	Category      string `long:"category" description:"post category, all categories if not set"`
+	Numbers       string `long:"num" description:"episode number or range, like 571 or 500-571"`
+	Topic         string `long:"topic" description:"topic substring, case insensitive"`
+	Format        string `long:"format" choice:"table" choice:"json" choice:"csv" default:"table" description:"output format"`
+}
+
+// episodeFilter selects posts, zero values match everything
+type episodeFilter struct {
+	From, To       time.Time // To is exclusive
+	Category       string
+	MinNum, MaxNum int
+	Topic          string
+}
+
+// episodeRecord is a post in json output
+type episodeRecord struct {
+	Number     int       `json:"number,omitempty"`
+	Date       time.Time `json:"date"`
+	Title      string    `json:"title"`
+	Categories []string  `json:"categories"`
+	Topics     []string  `json:"topics"`
+	Filename   string    `json:"filename,omitempty"`
+	Image      string    `json:"image,omitempty"`
+	Slug       string    `json:"slug"`
+}
+
+// episodesCmd prints posts matching the filter, newest first
+func episodesCmd(req Episodes) error {
+	flt, err := makeEpisodeFilter(req)
+	if err != nil {
+		return err
+	}
+	posts, err := loadPosts(req.PostsLocation)
+	if err != nil {
+		return fmt.Errorf("error loading posts: %w", err)
+	}
+
+	res := make([]Post, 0, len(posts))
+	for _, p := range posts {
+		if flt.match(p) {
+			res = append(res, p)
+		}
+	}
+	log.Printf("[DEBUG] %d of %d posts matched", len(res), len(posts))
+	return writeEpisodes(os.Stdout, res, req.Format)
+}
+
+// makeEpisodeFilter parses command line filters
+func makeEpisodeFilter(req Episodes) (episodeFilter, error) {
+	res := episodeFilter{Category: req.Category, Topic: strings.ToLower(req.Topic)}
+	var err error
+	if req.From != "" {
+		if res.From, _, err = parsePeriod(req.From); err != nil {
+			return episodeFilter{}, err
+		}
+	}
+	if req.To != "" {
+		if _, res.To, err = parsePeriod(req.To); err != nil {
+			return episodeFilter{}, err
+		}
+	}
+	if req.Numbers != "" {
+		if res.MinNum, res.MaxNum, err = parseNumRange(req.Numbers); err != nil {
+			return episodeFilter{}, err
+		}
+	}
+	return res, nil
+}
+
+func (f episodeFilter) match(p Post) bool {
+	if !f.From.IsZero() && p.Date.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !p.Date.Before(f.To) {
+		return false
+	}
+	if f.Category != "" && !p.HasCategory(f.Category) {
+		return false
+	}
+	if f.MaxNum > 0 && (p.Number < f.MinNum || p.Number > f.MaxNum) {
+		return false
+	}
+	if f.Topic == "" {
+		return true
+	}
+	for _, t := range p.Topics {
+		if strings.Contains(strings.ToLower(t), f.Topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePeriod parses year, month or day in siteTZ and returns its start and the start of the next one
+func parsePeriod(s string) (start, end time.Time, err error) {
+	for _, f := range []struct {
+		layout              string
+		years, months, days int
+	}{{"2006", 1, 0, 0}, {"2006-01", 0, 1, 0}, {"2006-01-02", 0, 0, 1}} {
+		if start, err = time.ParseInLocation(f.layout, s, siteTZ); err == nil {
+			return start, start.AddDate(f.years, f.months, f.days), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q, expected 2006, 2006-01 or 2006-01-02", s)
+}
+
+// parseNumRange parses "N" or "N-M"
+func parseNumRange(s string) (minNum, maxNum int, err error) {
+	from, to, isRange := strings.Cut(s, "-")
+	if minNum, err = strconv.Atoi(strings.TrimSpace(from)); err != nil {
+		return 0, 0, fmt.Errorf("invalid episode number %q: %w", s, err)
+	}
+	maxNum = minNum
+	if isRange {
+		if maxNum, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+			return 0, 0, fmt.Errorf("invalid episode number %q: %w", s, err)
+		}
+	}
+	if minNum <= 0 || maxNum < minNum {
+		return 0, 0, fmt.Errorf("invalid episode range %q", s)
+	}
+	return minNum, maxNum, nil
+}
+
+// writeEpisodes writes posts in the format, table, json or csv
+func writeEpisodes(w io.Writer, posts []Post, format string) error {
+	switch format {
+	case "json":
+		recs := make([]episodeRecord, 0, len(posts))
+		for _, p := range posts {
+			recs = append(recs, episodeRecord{Number: p.Number, Date: p.Date, Title: p.Title, Categories: p.Categories,
+				Topics: p.Topics, Filename: p.Filename, Image: p.Image, Slug: p.Slug})
+		}
+		data, err := json.MarshalIndent(recs, "", "  ")
+		if err != nil {
+			return fmt.Errorf("can't marshal episodes: %w", err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"number", "date", "title", "categories", "topics", "filename", "image", "slug"})
+		for _, p := range posts {
+			_ = cw.Write([]string{strconv.Itoa(p.Number), p.Date.Format(postDateFormats[0]), p.Title,
+				strings.Join(p.Categories, ","), strings.Join(p.Topics, "; "), p.Filename, p.Image, p.Slug})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NUM\tDATE\tCATEGORY\tTITLE\tTOPICS") //nolint:errcheck
+		for _, p := range posts {
+			num := "-"
+			if p.Number > 0 {
+				num = strconv.Itoa(p.Number)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", num, p.Date.Format("2006-01-02"), //nolint:errcheck
+				strings.Join(p.Categories, ","), p.Title, strings.Join(p.Topics, "; "))
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
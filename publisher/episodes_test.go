@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEpisodesFilter(t *testing.T) {
+	posts, err := loadPosts("testdata/hugo/content/posts")
+	require.NoError(t, err)
+
+	tbl := []struct {
+		req   Episodes
+		slugs []string
+		err   string
+	}{
+		{Episodes{}, []string{"podcast-571", "we-moved", "podcast-570"}, ""},
+		{Episodes{Category: "podcast"}, []string{"podcast-571", "podcast-570"}, ""},
+		{Episodes{From: "2023-03-28"}, []string{"podcast-571", "we-moved"}, ""},
+		{Episodes{To: "2023-03-28"}, []string{"we-moved", "podcast-570"}, ""},
+		{Episodes{From: "2023-04", To: "2023"}, []string{"podcast-571"}, ""},
+		{Episodes{From: "2022", To: "2022"}, []string{}, ""},
+		{Episodes{Numbers: "570"}, []string{"podcast-570"}, ""},
+		{Episodes{Numbers: "560-575"}, []string{"podcast-571", "podcast-570"}, ""},
+		{Episodes{Topic: "ЭЛЕКТРОМОБИЛИ"}, []string{"podcast-571"}, ""},
+		{Episodes{Topic: "go не rust", Category: "podcast"}, []string{"podcast-570"}, ""},
+		{Episodes{From: "28/03/2023"}, nil, `invalid date "28/03/2023", expected 2006, 2006-01 or 2006-01-02`},
+		{Episodes{Numbers: "575-560"}, nil, `invalid episode range "575-560"`},
+		{Episodes{Numbers: "abc"}, nil, `invalid episode number "abc": strconv.Atoi: parsing "abc": invalid syntax`},
+	}
+
+	for i, tt := range tbl {
+		flt, err := makeEpisodeFilter(tt.req)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, "case %d", i)
+			continue
+		}
+		require.NoError(t, err, "case %d", i)
+		slugs := []string{}
+		for _, p := range posts {
+			if flt.match(p) {
+				slugs = append(slugs, p.Slug)
+			}
+		}
+		assert.Equal(t, tt.slugs, slugs, "case %d", i)
+	}
+}
+
+func TestWriteEpisodes(t *testing.T) {
+	posts, err := loadPosts("testdata/hugo/content/posts")
+	require.NoError(t, err)
+	posts = posts[:2]
+
+	buf := bytes.Buffer{}
+	require.NoError(t, writeEpisodes(&buf, posts, "table"))
+	assert.Equal(t, `NUM  DATE        CATEGORY  TITLE             TOPICS
+571  2023-04-01  podcast   UWP - Выпуск 571  Облачные счета за месяц; Электромобили и зима; Вопросы и ответы
+-    2023-03-28  others    Мы переехали      
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeEpisodes(&buf, posts, "csv"))
+	assert.Equal(t, `number,date,title,categories,topics,filename,image,slug
+571,2023-04-01T14:10:05,UWP - Выпуск 571,podcast,Облачные счета за месяц; Электромобили и зима; Вопросы и ответы,ump_podcast571,https://podcast.umputun.com/images/uwp/uwp571.jpg,podcast-571
+0,2023-03-28T10:00:00,Мы переехали,others,,,,we-moved
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeEpisodes(&buf, posts, "json"))
+	var recs []episodeRecord
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &recs))
+	require.Len(t, recs, 2)
+	assert.Equal(t, 571, recs[0].Number)
+	assert.Equal(t, []string{"Облачные счета за месяц", "Электромобили и зима", "Вопросы и ответы"}, recs[0].Topics)
+	assert.True(t, posts[0].Date.Equal(recs[0].Date))
+	assert.Equal(t, "we-moved", recs[1].Slug)
+
+	assert.EqualError(t, writeEpisodes(&buf, posts, "xml"), `unknown format "xml"`)
+}
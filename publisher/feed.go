@@ -0,0 +1,601 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // uuid v5 is defined with sha1
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Feed generates rss feeds from hugo posts, replaces generate_rss.py
+type Feed struct {
+	HugoLocation     string   `long:"hugo" env:"HUGO_LOCATION" default:"/srv/podcast-uwp/hugo" description:"hugo site location"`
+	Output           string   `long:"output" env:"FEED_OUTPUT" description:"output directory, public dir in hugo location by default"`
+	MediaLocation    []string `long:"media" env:"MEDIA_LOCATION" env-delim:"," default:"/srv/podcast-uwp/var/media" description:"local media location(s)"`
+	MediaCache       string   `long:"media-cache" env:"MEDIA_CACHE" default:"/srv/podcast-uwp/var/media-info.json" description:"media sizes and durations cache"`
+	MediaURL         string   `long:"media-url" default:"https://podcast.umputun.com/media/" description:"primary media url"`
+	FailbackMediaURL string   `long:"failback-media-url" default:"http://podcast-failback.umputun.com/media/" description:"failback media url"`
+	ArchiveMediaURL  string   `long:"archive-media-url" default:"https://archive.rucast.net/uwp/media/" description:"archive media url"`
+	Size             int      `long:"size" default:"20" description:"number of episodes in podcast feeds"`
+	ArchiveSize      int      `long:"archive-size" default:"1000" description:"number of episodes in archives feed"`
+	ShortArchiveSize int      `long:"short-archive-size" default:"25" description:"min number of episodes in short archive feed, all not in archive pages"`
+	ArchivePageSize  int      `long:"archive-page-size" default:"100" description:"number of episodes in archive page"`
+	FeedsPage        bool     `long:"feeds-page" description:"update content/pages/feeds.md with the list of feeds"`
+}
+
+// siteConfig is a set of hugo config.toml values used by generators
+type siteConfig struct {
+	BaseURL     string
+	Title       string
+	Description string
+	Language    string
+	Author      string
+	Email       string
+	Cover       string
+	Category    string
+	Subcategory string
+	Funding     string
+	FundingText string
+	Permalink   string
+}
+
+// feedSpec defines a single rss feed to generate
+type feedSpec struct {
+	File        string // output file name
+	Title       string // channel title
+	Description string // human readable description for the list of feeds
+	MediaURL    string // base url for enclosures
+	Size        int    // max number of items
+	GUIDMedia   string // media url for item guid, archive feed always did it this way. Legacy page url used if empty
+	Paged       bool   // head of the paged archive, archive pages made with the spec and linked from the feed
+}
+
+// mediaInfo is size and duration of media file, cached between runs as remote-only files can't be measured
+type mediaInfo struct {
+	Size     int64         `json:"size"`
+	Duration time.Duration `json:"duration"`
+}
+
+// legacyArchiveMediaURL is the archive media url of guids in archive feed, as generate_rss.py made them.
+// Guids of published items never change, even if the archive moves.
+const legacyArchiveMediaURL = "http://archive.rucast.net/uwp/media/"
+
+// podcastNamespace is the uuid namespace for podcast:guid, defined by Podcasting 2.0 spec
+const podcastNamespace = "ead4c236-bf58-58c6-a2c6-a6b28d128cb6"
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	NsItunes  string     `xml:"xmlns:itunes,attr"`
+	NsPodcast string     `xml:"xmlns:podcast,attr"`
+	NsAtom    string     `xml:"xmlns:atom,attr"`
+	NsHistory string     `xml:"xmlns:fh,attr,omitempty"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title          string        `xml:"title"`
+	Link           string        `xml:"link"`
+	AtomLinks      []rssAtomLink `xml:"atom:link"`
+	Description    string        `xml:"description"`
+	Language       string        `xml:"language"`
+	LastBuildDate  string        `xml:"lastBuildDate"`
+	Image          rssImage      `xml:"image"`
+	ItunesAuthor   string        `xml:"itunes:author"`
+	ItunesSummary  string        `xml:"itunes:summary"`
+	ItunesType     string        `xml:"itunes:type"`
+	ItunesExplicit string        `xml:"itunes:explicit"`
+	ItunesImage    rssHref       `xml:"itunes:image"`
+	ItunesOwner    rssOwner      `xml:"itunes:owner"`
+	ItunesCategory rssCategory   `xml:"itunes:category"`
+	PodcastGUID    string        `xml:"podcast:guid"`
+	PodcastLocked  rssLocked     `xml:"podcast:locked"`
+	PodcastFunding *rssFunding   `xml:"podcast:funding,omitempty"`
+	PodcastArchive []rssAtomLink `xml:"podcast:archive,omitempty"`
+	HistoryArchive *struct{}     `xml:"fh:archive,omitempty"`
+	Items          []rssItem     `xml:"item"`
+}
+
+type rssItem struct {
+	Title             string        `xml:"title"`
+	Link              string        `xml:"link"`
+	GUID              rssGUID       `xml:"guid"`
+	PubDate           string        `xml:"pubDate"`
+	Description       rssCDATA      `xml:"description"`
+	Enclosure         rssEnclosure  `xml:"enclosure"`
+	ItunesAuthor      string        `xml:"itunes:author"`
+	ItunesDuration    string        `xml:"itunes:duration,omitempty"`
+	ItunesEpisode     int           `xml:"itunes:episode,omitempty"`
+	ItunesEpisodeType string        `xml:"itunes:episodeType"`
+	ItunesExplicit    string        `xml:"itunes:explicit"`
+	ItunesImage       *rssHref      `xml:"itunes:image,omitempty"`
+	PodcastChapters   *rssMediaRef  `xml:"podcast:chapters,omitempty"`
+	PodcastTranscript []rssMediaRef `xml:"podcast:transcript,omitempty"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type rssImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type rssHref struct {
+	Href string `xml:"href,attr"`
+}
+
+type rssOwner struct {
+	Name  string `xml:"itunes:name"`
+	Email string `xml:"itunes:email"`
+}
+
+type rssCategory struct {
+	Text string       `xml:"text,attr"`
+	Sub  *rssCategory `xml:"itunes:category,omitempty"`
+}
+
+type rssLocked struct {
+	Owner string `xml:"owner,attr"`
+	Value string `xml:",chardata"`
+}
+
+type rssFunding struct {
+	URL  string `xml:"url,attr"`
+	Text string `xml:",chardata"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssCDATA struct {
+	Value string `xml:",cdata"`
+}
+
+type rssMediaRef struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Language string `xml:"language,attr,omitempty"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// feedCmd generates all rss feeds from hugo posts
+func feedCmd(req Feed) error {
+	log.Printf("[INFO] generate feeds for %s", req.HugoLocation)
+
+	site, err := loadSiteConfig(filepath.Join(req.HugoLocation, "config.toml"))
+	if err != nil {
+		return err
+	}
+
+	posts, err := loadPosts(filepath.Join(req.HugoLocation, "content", "posts"))
+	if err != nil {
+		return fmt.Errorf("error loading posts: %w", err)
+	}
+	episodes := publishedEpisodes(posts, nowFn())
+	log.Printf("[DEBUG] loaded %d posts, %d episodes", len(posts), len(episodes))
+
+	cache := loadMediaCache(req.MediaCache)
+	client := &http.Client{Timeout: time.Second * 30}
+	media := episodesMedia(episodes, req.MediaLocation, cache, remoteMediaSize(client, req.ArchiveMediaURL, req.MediaURL))
+	if req.MediaCache != "" {
+		if err = saveMediaCache(req.MediaCache, media); err != nil {
+			log.Printf("[WARN] can't save media cache: %v", err)
+		}
+	}
+	var unknown []string
+	for _, ep := range episodes {
+		if media[ep.Filename+".mp3"].Size <= 0 {
+			unknown = append(unknown, ep.Filename+".mp3")
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown size of %d media files, enclosure length is required: %s", len(unknown),
+			strings.Join(unknown, ", "))
+	}
+
+	output := req.Output
+	if output == "" {
+		output = filepath.Join(req.HugoLocation, "public")
+	}
+	if err = os.MkdirAll(output, 0o750); err != nil {
+		return fmt.Errorf("error creating output dir %s: %w", output, err)
+	}
+
+	pages := 0
+	for _, spec := range req.specs(site) {
+		if !spec.Paged {
+			continue
+		}
+		if pages, err = writeArchivePages(output, site, spec, req.ArchivePageSize, episodes, media); err != nil {
+			return err
+		}
+		log.Printf("[INFO] %d archive pages of %s created, %d episodes per page", pages, spec.File, req.ArchivePageSize)
+		break
+	}
+
+	for _, spec := range req.specs(site) {
+		if spec.Paged {
+			spec.Size = archiveHeadSize(spec.Size, req.ArchivePageSize, pages, len(episodes))
+		}
+		feed := makeFeed(site, spec, episodes, media)
+		if spec.Paged {
+			addArchiveLinks(&feed, site, pages)
+		}
+		if err = writeFeed(filepath.Join(output, spec.File), feed); err != nil {
+			return err
+		}
+		log.Printf("[INFO] feed %s created with %d items", spec.File, len(feed.Channel.Items))
+	}
+
+	jfeed := makeJSONFeed(site, req.MediaURL, req.Size, episodes, media)
+	if err = writeJSONFeed(filepath.Join(output, jsonFeedFile), jfeed); err != nil {
+		return err
+	}
+	log.Printf("[INFO] json feed %s created with %d items", jsonFeedFile, len(jfeed.Items))
+
+	if err = writeOPML(filepath.Join(output, opmlFile), site, req.specs(site)); err != nil {
+		return err
+	}
+
+	if req.FeedsPage {
+		page := filepath.Join(req.HugoLocation, "content", "pages", "feeds.md")
+		if err = writeFeedsPage(page, site, req.specs(site)); err != nil {
+			return err
+		}
+		log.Printf("[INFO] feeds page %s updated", page)
+	}
+	return nil
+}
+
+// specs returns list of feeds to generate, same set as generate_rss.py used to make. The short archive is
+// the head of RFC 5005 archive pages, the archives feed is kept as a single file for existing subscribers.
+func (req Feed) specs(site siteConfig) []feedSpec {
+	return []feedSpec{
+		{File: "podcast.rss", Title: site.Title, Description: "основной фид", MediaURL: req.MediaURL, Size: req.Size},
+		{File: "podcast-failback.rss", Title: site.Title, Description: "запасной фид, аудио с запасного сервера",
+			MediaURL: req.FailbackMediaURL, Size: req.Size},
+		{File: "archives.rss", Title: site.Title + " (архив)", Description: "архив всех выпусков одним файлом",
+			MediaURL: req.ArchiveMediaURL, Size: req.ArchiveSize, GUIDMedia: legacyArchiveMediaURL},
+		{File: "podcast-archives-short.rss", Title: site.Title + " (архив)", Description: "последние выпуски архива, " +
+			"более старые постранично (RFC 5005)", MediaURL: req.ArchiveMediaURL, Size: req.ShortArchiveSize, Paged: true},
+	}
+}
+
+// loadSiteConfig reads hugo config.toml. Values missing in config are set to the site defaults
+func loadSiteConfig(file string) (siteConfig, error) {
+	res := siteConfig{
+		BaseURL:     "https://podcast.umputun.com/",
+		Title:       "Еженедельный подкаст от Umputun",
+		Description: "Еженедельный подкаст от Umputun",
+		Language:    "ru",
+		Author:      "Umputun",
+		Email:       "umputun@gmail.com",
+		Category:    "Society & Culture",
+		Subcategory: "Personal Journals",
+		Permalink:   "/p/:year/:month/:day/:slug/",
+	}
+
+	data, err := os.ReadFile(file) //nolint:gosec
+	if err != nil {
+		return res, fmt.Errorf("error reading site config %s: %w", file, err)
+	}
+	cfg, err := parseTOML(string(data))
+	if err != nil {
+		return res, fmt.Errorf("error parsing site config %s: %w", file, err)
+	}
+
+	set := func(dst *string, vals ...string) {
+		for _, v := range vals {
+			if v != "" {
+				*dst = v
+				return
+			}
+		}
+	}
+	params, permalinks := tomlTable(cfg, "params"), tomlTable(cfg, "permalinks")
+	set(&res.BaseURL, tomlString(cfg, "baseURL"), tomlString(cfg, "baseurl"))
+	set(&res.Title, tomlString(cfg, "title"))
+	set(&res.Language, tomlString(cfg, "languageCode"), tomlString(cfg, "languagecode"))
+	set(&res.Description, tomlString(params, "description"))
+	// params.author of the site is an email, feeds author and category are podcast constants
+	set(&res.Email, tomlString(params, "email"))
+	set(&res.Funding, tomlString(params, "funding"))
+	set(&res.FundingText, tomlString(params, "fundingText"), tomlString(params, "fundingtext"))
+	set(&res.Permalink, tomlString(permalinks, "posts"))
+	res.BaseURL = strings.TrimSuffix(res.BaseURL, "/") + "/"
+	res.Cover = res.BaseURL + "images/uwp/uwp-cover.jpg"
+	set(&res.Cover, tomlString(params, "cover"))
+	return res, nil
+}
+
+// publishedEpisodes returns episodes with date in the past, newest first
+func publishedEpisodes(posts []Post, now time.Time) []Post {
+	res := []Post{}
+	for _, p := range posts {
+		if p.IsEpisode() && !p.Date.After(now) {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// episodesMedia gets size and duration for each episode from local media, falls back to the cache for
+// files not available locally, i.e. removed from primary by retention. Size of files not cached yet is
+// taken from remote, duration is unknown for them.
+func episodesMedia(episodes []Post, locations []string, cache map[string]mediaInfo,
+	remote func(name string) (int64, error)) map[string]mediaInfo {
+	res := map[string]mediaInfo{}
+	for _, ep := range episodes {
+		name := ep.Filename + ".mp3"
+		info, found := localMediaInfo(name, locations, cache[name])
+		if found {
+			res[name] = info
+			continue
+		}
+		if c, ok := cache[name]; ok && c.Size > 0 {
+			res[name] = c
+			continue
+		}
+		if remote == nil {
+			log.Printf("[WARN] media %s not found locally and not cached", name)
+			continue
+		}
+		size, err := remote(name)
+		if err != nil {
+			log.Printf("[WARN] media %s not found locally, not cached and can't get its size: %v", name, err)
+			continue
+		}
+		res[name] = mediaInfo{Size: size}
+	}
+	return res
+}
+
+// remoteMediaSize returns func getting size of media file with HEAD request to the first of urls having it
+func remoteMediaSize(client *http.Client, urls ...string) func(name string) (int64, error) {
+	return func(name string) (int64, error) {
+		var errs []string
+		for _, u := range urls {
+			link := strings.TrimSuffix(u, "/") + "/" + name
+			resp, err := client.Head(link)
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusOK || resp.ContentLength <= 0 {
+				errs = append(errs, fmt.Sprintf("%s: status %d, length %d", link, resp.StatusCode, resp.ContentLength))
+				continue
+			}
+			return resp.ContentLength, nil
+		}
+		return 0, errors.New(strings.Join(errs, "; "))
+	}
+}
+
+// localMediaInfo looks for the file in all locations. Duration is taken from the cache if size not changed.
+func localMediaInfo(name string, locations []string, cached mediaInfo) (mediaInfo, bool) {
+	for _, loc := range locations {
+		file := filepath.Join(loc, name)
+		fi, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		if cached.Size == fi.Size() && cached.Duration > 0 {
+			return cached, true
+		}
+		dur, err := mp3Duration(file)
+		if err != nil {
+			log.Printf("[WARN] can't get duration of %s: %v", file, err)
+		}
+		return mediaInfo{Size: fi.Size(), Duration: dur}, true
+	}
+	return mediaInfo{}, false
+}
+
+func loadMediaCache(file string) map[string]mediaInfo {
+	res := map[string]mediaInfo{}
+	if file == "" {
+		return res
+	}
+	data, err := os.ReadFile(file) //nolint:gosec
+	if err != nil {
+		log.Printf("[DEBUG] no media cache %s: %v", file, err)
+		return res
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		log.Printf("[WARN] can't parse media cache %s: %v", file, err)
+		return map[string]mediaInfo{}
+	}
+	return res
+}
+
+func saveMediaCache(file string, media map[string]mediaInfo) error {
+	cache := loadMediaCache(file) // keep entries for episodes not in the current set
+	for k, v := range media {
+		cache[k] = v
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal media cache: %w", err)
+	}
+	return writeFileAtomic(file, data)
+}
+
+// makeFeed creates rss feed for the spec from the list of episodes
+func makeFeed(site siteConfig, spec feedSpec, episodes []Post, media map[string]mediaInfo) rssFeed {
+	feedURL := site.BaseURL + spec.File
+	ch := rssChannel{
+		Title:          spec.Title,
+		Link:           site.BaseURL,
+		AtomLinks:      []rssAtomLink{{Href: feedURL, Rel: "self", Type: "application/rss+xml"}},
+		Description:    site.Description,
+		Language:       site.Language,
+		LastBuildDate:  nowFn().In(siteTZ).Format(time.RFC1123Z),
+		Image:          rssImage{URL: site.Cover, Title: spec.Title, Link: site.BaseURL},
+		ItunesAuthor:   site.Author,
+		ItunesSummary:  site.Description,
+		ItunesType:     "episodic",
+		ItunesExplicit: "false",
+		ItunesImage:    rssHref{Href: site.Cover},
+		ItunesOwner:    rssOwner{Name: site.Author, Email: site.Email},
+		ItunesCategory: rssCategory{Text: site.Category, Sub: &rssCategory{Text: site.Subcategory}},
+		PodcastGUID:    podcastGUID(site.BaseURL + "podcast.rss"),
+		PodcastLocked:  rssLocked{Owner: site.Email, Value: "yes"},
+	}
+	if site.Funding != "" {
+		ch.PodcastFunding = &rssFunding{URL: site.Funding, Text: site.FundingText}
+	}
+
+	guids := map[string]int{}
+	for _, ep := range episodes {
+		if spec.Size > 0 && len(ch.Items) >= spec.Size {
+			break
+		}
+		item := makeFeedItem(site, spec, ep, media[ep.Filename+".mp3"])
+		if num, ok := guids[item.GUID.Value]; ok {
+			// legacy media guids of the archive are the same for posts sharing media file
+			log.Printf("[WARN] episode %d skipped in %s, same guid %s as episode %d", ep.Number, spec.File, item.GUID.Value, num)
+			continue
+		}
+		guids[item.GUID.Value] = ep.Number
+		ch.Items = append(ch.Items, item)
+	}
+
+	return rssFeed{
+		Version:   "2.0",
+		NsItunes:  nsItunes,
+		NsPodcast: nsPodcast,
+		NsAtom:    nsAtom,
+		Channel:   ch,
+	}
+}
+
+func makeFeedItem(site siteConfig, spec feedSpec, ep Post, info mediaInfo) rssItem {
+	link := ep.Permalink(site.BaseURL, site.Permalink)
+	mediaURL := strings.TrimSuffix(spec.MediaURL, "/") + "/" + ep.Filename + ".mp3"
+
+	item := rssItem{
+		Title:             ep.Title,
+		Link:              link,
+		GUID:              rssGUID{IsPermaLink: true, Value: legacyPostURL(site.BaseURL, ep)},
+		PubDate:           ep.Date.In(siteTZ).Format(time.RFC1123Z),
+		Description:       rssCDATA{Value: renderMarkdown(ep.Body)},
+		Enclosure:         rssEnclosure{URL: mediaURL, Length: info.Size, Type: "audio/mpeg"},
+		ItunesAuthor:      site.Author,
+		ItunesEpisode:     ep.Number,
+		ItunesEpisodeType: "full",
+		ItunesExplicit:    "false",
+	}
+	if spec.GUIDMedia != "" {
+		item.GUID = rssGUID{IsPermaLink: false, Value: strings.TrimSuffix(spec.GUIDMedia, "/") + "/" + ep.Filename + ".mp3"}
+	}
+	if info.Duration > 0 {
+		item.ItunesDuration = formatDuration(info.Duration)
+	}
+	if ep.Image != "" {
+		item.ItunesImage = &rssHref{Href: ep.Image}
+	}
+	if chapters := tomlString(ep.Params, "chapters"); chapters != "" {
+		item.PodcastChapters = &rssMediaRef{URL: chapters, Type: "application/json+chapters"}
+	}
+	for _, tr := range tomlStrings(ep.Params, "transcripts") {
+		ref := rssMediaRef{URL: tr, Type: "text/vtt", Language: site.Language}
+		if strings.HasSuffix(tr, ".srt") {
+			ref.Type = "application/srt"
+		}
+		item.PodcastTranscript = append(item.PodcastTranscript, ref)
+	}
+	return item
+}
+
+// legacyPostURL returns page url of the episode as generate_rss.py made it for guids, with trailing slash.
+// The script stripped double slash only before "p", posts with other file names have it in the url.
+func legacyPostURL(baseURL string, ep Post) string {
+	path := fmt.Sprintf("p/%s//%s/", ep.Date.Format("2006/01/02"), ep.Slug)
+	return strings.TrimSuffix(baseURL, "/") + "/" + strings.ReplaceAll(path, "//p", "/p")
+}
+
+// writeFeed marshals feed to xml and writes it atomically, so nginx never serves a partial file.
+// Unchanged files are not rewritten, archive pages keep their modification time for caching.
+func writeFeed(file string, feed rssFeed) error {
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling feed %s: %w", file, err)
+	}
+	data = append([]byte(xml.Header), data...)
+	if existing, e := os.ReadFile(file); e == nil && bytes.Equal(existing, data) { //nolint:gosec
+		return nil
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return fmt.Errorf("error creating dir for %s: %w", file, err)
+	}
+	return writeFileAtomic(file, data)
+}
+
+// writeFileAtomic writes data to temp file in the same directory and renames it to the destination
+func writeFileAtomic(file string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return fmt.Errorf("error creating temp file for %s: %w", file, err)
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck // removes temp file if rename failed
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing %s: %w", tmp.Name(), err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("error closing %s: %w", tmp.Name(), err)
+	}
+	if err = os.Chmod(tmp.Name(), 0o644); err != nil { //nolint:gosec // served by nginx
+		return fmt.Errorf("error setting permissions for %s: %w", tmp.Name(), err)
+	}
+	if err = os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("error renaming %s to %s: %w", tmp.Name(), file, err)
+	}
+	return nil
+}
+
+// podcastGUID makes uuid v5 from feed url without scheme and trailing slashes, as podcast:guid spec requires
+func podcastGUID(feedURL string) string {
+	name := feedURL
+	if i := strings.Index(name, "://"); i >= 0 {
+		name = name[i+3:]
+	}
+	name = strings.TrimRight(name, "/")
+
+	ns, err := hex.DecodeString(strings.ReplaceAll(podcastNamespace, "-", ""))
+	if err != nil {
+		panic(fmt.Sprintf("invalid podcast namespace: %v", err))
+	}
+
+	h := sha1.New() //nolint:gosec
+	h.Write(ns)
+	h.Write([]byte(name))
+	sum := h.Sum(nil)[:16]
+	sum[6] = (sum[6] & 0x0f) | 0x50 // version 5
+	sum[8] = (sum[8] & 0x3f) | 0x80 // rfc 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedCmd(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2023, 4, 7, 14, 40, 46, 0, time.UTC) }
+	defer func() { nowFn = time.Now }()
+
+	mediaDir, outDir := t.TempDir(), t.TempDir()
+	mp3 := append([]byte{0xFF, 0xFB, 0x90, 0x00}, make([]byte, 159996)...) // 10 seconds at 128kbps
+	require.NoError(t, os.WriteFile(filepath.Join(mediaDir, "ump_podcast571.mp3"), mp3, 0o600))
+	cacheFile := filepath.Join(t.TempDir(), "media.json")
+	require.NoError(t, os.WriteFile(cacheFile, []byte(`{"ump_podcast570.mp3":{"size":12345,"duration":3600000000000}}`), 0o600))
+
+	req := Feed{HugoLocation: "testdata/hugo", Output: outDir, MediaLocation: []string{mediaDir}, MediaCache: cacheFile,
+		MediaURL: "https://podcast.umputun.com/media/", FailbackMediaURL: "http://podcast-failback.umputun.com/media/",
+		ArchiveMediaURL: "https://archive.rucast.net/uwp/media/", Size: 20, ArchiveSize: 1000, ShortArchiveSize: 1,
+		ArchivePageSize: 1}
+	require.NoError(t, feedCmd(req))
+
+	for _, f := range []string{"podcast.rss", "podcast-failback.rss", "archives.rss", "podcast-archives-short.rss",
+		"podcast.json", "feeds.opml", "archives/archive-1.rss", "archives/archive-2.rss"} {
+		assert.FileExists(t, filepath.Join(outDir, f))
+	}
+
+	var feed rssFeed
+	data, err := os.ReadFile(filepath.Join(outDir, "podcast.rss"))
+	require.NoError(t, err)
+	require.NoError(t, xml.Unmarshal(data, &feed))
+	assert.Contains(t, string(data), `xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"`)
+	assert.Contains(t, string(data), `<podcast:locked owner="umputun@gmail.com">yes</podcast:locked>`)
+	assert.Contains(t, string(data), "<itunes:author>Umputun</itunes:author>")
+	assert.Contains(t, string(data), "<itunes:owner>\n      <itunes:name>Umputun</itunes:name>\n      <itunes:email>umputun@gmail.com</itunes:email>")
+	assert.Contains(t, string(data), `<itunes:category text="Society &amp; Culture">`+
+		"\n      <itunes:category text=\"Personal Journals\"></itunes:category>\n    </itunes:category>")
+	assert.Contains(t, string(data), `<podcast:funding url="https://podcast.umputun.com/donate/">Поддержать подкаст</podcast:funding>`)
+	assert.Contains(t, string(data), `<itunes:image href="https://podcast.umputun.com/images/uwp/uwp571.jpg"></itunes:image>`)
+
+	require.Len(t, feed.Channel.Items, 2, "non-episode post skipped")
+	item := feed.Channel.Items[0]
+	assert.Equal(t, "UWP - Выпуск 571", item.Title)
+	assert.Equal(t, "https://podcast.umputun.com/p/2023/04/01/podcast-571/", item.GUID.Value)
+	assert.Equal(t, "Sat, 01 Apr 2023 14:10:05 -0500", item.PubDate)
+	assert.Equal(t, rssEnclosure{URL: "https://podcast.umputun.com/media/ump_podcast571.mp3", Length: 160000,
+		Type: "audio/mpeg"}, item.Enclosure)
+	assert.Contains(t, string(data), "<itunes:duration>00:00:10</itunes:duration>\n      <itunes:episode>571</itunes:episode>")
+	assert.Contains(t, item.Description.Value, "<li>Облачные счета за месяц</li>")
+
+	item = feed.Channel.Items[1]
+	assert.Equal(t, int64(12345), item.Enclosure.Length, "size from cache")
+	assert.Contains(t, string(data), "<itunes:duration>01:00:00</itunes:duration>\n      <itunes:episode>570</itunes:episode>")
+	assert.Equal(t, "Sat, 25 Mar 2023 15:20:11 -0500", item.PubDate)
+
+	// guids are the same as generate_rss.py made them
+	data, err = os.ReadFile(filepath.Join(outDir, "podcast-failback.rss"))
+	require.NoError(t, err)
+	feed = rssFeed{}
+	require.NoError(t, xml.Unmarshal(data, &feed))
+	assert.Equal(t, "https://podcast.umputun.com/p/2023/04/01/podcast-571/", feed.Channel.Items[0].GUID.Value)
+	assert.Equal(t, "http://podcast-failback.umputun.com/media/ump_podcast571.mp3", feed.Channel.Items[0].Enclosure.URL)
+
+	data, err = os.ReadFile(filepath.Join(outDir, "archives.rss"))
+	require.NoError(t, err)
+	feed = rssFeed{}
+	require.NoError(t, xml.Unmarshal(data, &feed))
+	assert.Equal(t, rssGUID{Value: "http://archive.rucast.net/uwp/media/ump_podcast571.mp3"}, feed.Channel.Items[0].GUID)
+	assert.Equal(t, "https://archive.rucast.net/uwp/media/ump_podcast571.mp3", feed.Channel.Items[0].Enclosure.URL)
+	assert.Len(t, feed.Channel.Items, 2, "all episodes in single file archive")
+	assert.NotContains(t, string(data), "prev-archive")
+
+	data, err = os.ReadFile(filepath.Join(outDir, "podcast-archives-short.rss"))
+	require.NoError(t, err)
+	feed = rssFeed{}
+	require.NoError(t, xml.Unmarshal(data, &feed))
+	require.Len(t, feed.Channel.Items, 1)
+	assert.Equal(t, rssGUID{IsPermaLink: true, Value: "https://podcast.umputun.com/p/2023/04/01/podcast-571/"},
+		feed.Channel.Items[0].GUID)
+	assert.Contains(t, string(data), `<atom:link href="https://podcast.umputun.com/archives/archive-2.rss" rel="prev-archive"`)
+
+	data, err = os.ReadFile(filepath.Join(outDir, "archives", "archive-1.rss"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `<atom:link href="https://podcast.umputun.com/podcast-archives-short.rss" rel="current"`)
+	assert.Contains(t, string(data), "<guid isPermaLink=\"true\">https://podcast.umputun.com/p/2023/03/25/podcast-570/</guid>",
+		"same guids as in the short archive")
+
+	cache := loadMediaCache(cacheFile)
+	assert.Equal(t, mediaInfo{Size: 160000, Duration: 10 * time.Second}, cache["ump_podcast571.mp3"])
+	assert.Equal(t, int64(12345), cache["ump_podcast570.mp3"].Size)
+}
+
+func TestFeedCmdRemoteSize(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2023, 4, 7, 14, 40, 46, 0, time.UTC) }
+	defer func() { nowFn = time.Now }()
+
+	mediaDir := t.TempDir()
+	mp3 := append([]byte{0xFF, 0xFB, 0x90, 0x00}, make([]byte, 159996)...)
+	require.NoError(t, os.WriteFile(filepath.Join(mediaDir, "ump_podcast571.mp3"), mp3, 0o600))
+
+	archived := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead || r.URL.Path != "/uwp/media/ump_podcast570.mp3" || !archived {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", "54321")
+	}))
+	defer ts.Close()
+
+	cacheFile := filepath.Join(t.TempDir(), "media.json")
+	req := Feed{HugoLocation: "testdata/hugo", Output: t.TempDir(), MediaLocation: []string{mediaDir}, MediaCache: cacheFile,
+		MediaURL: ts.URL + "/media/", ArchiveMediaURL: ts.URL + "/uwp/media/", Size: 20, ShortArchiveSize: 1, ArchivePageSize: 1}
+	require.NoError(t, feedCmd(req))
+	feed, err := os.ReadFile(filepath.Join(req.Output, "podcast.rss"))
+	require.NoError(t, err)
+	assert.Contains(t, string(feed), `<enclosure url="`+ts.URL+`/media/ump_podcast570.mp3" length="54321" type="audio/mpeg">`)
+	assert.Equal(t, mediaInfo{Size: 54321}, loadMediaCache(cacheFile)["ump_podcast570.mp3"], "remote size cached")
+
+	archived, req.MediaCache, req.Output = false, "", t.TempDir()
+	err = feedCmd(req)
+	require.EqualError(t, err, "unknown size of 1 media files, enclosure length is required: ump_podcast570.mp3")
+	assert.NoFileExists(t, filepath.Join(req.Output, "podcast.rss"))
+}
+
+func TestMakeFeedDuplicateGUID(t *testing.T) {
+	site, err := loadSiteConfig("testdata/hugo/config.toml")
+	require.NoError(t, err)
+	episodes := []Post{
+		{Slug: "podcast-313", Number: 313, Filename: "ump_podcast313", Date: time.Date(2013, 3, 17, 19, 35, 0, 0, siteTZ)},
+		{Slug: "podcast-312", Number: 312, Filename: "ump_podcast313", Date: time.Date(2013, 2, 22, 14, 44, 0, 0, siteTZ)},
+		{Slug: "podcast-311", Number: 311, Filename: "ump_podcast311", Date: time.Date(2013, 2, 15, 14, 44, 0, 0, siteTZ)},
+	}
+	spec := feedSpec{File: "archives.rss", MediaURL: "https://archive.rucast.net/uwp/media/", GUIDMedia: legacyArchiveMediaURL, Size: 2}
+	feed := makeFeed(site, spec, episodes, nil)
+	require.Len(t, feed.Channel.Items, 2)
+	assert.Equal(t, "http://archive.rucast.net/uwp/media/ump_podcast313.mp3", feed.Channel.Items[0].GUID.Value)
+	assert.Equal(t, "http://archive.rucast.net/uwp/media/ump_podcast311.mp3", feed.Channel.Items[1].GUID.Value)
+
+	spec.GUIDMedia = ""
+	assert.Len(t, makeFeed(site, spec, episodes, nil).Channel.Items, 2, "page url guids differ")
+}
+
+func TestLegacyPostURL(t *testing.T) {
+	date := time.Date(2016, 1, 2, 12, 0, 0, 0, siteTZ)
+	assert.Equal(t, "https://podcast.umputun.com/p/2016/01/02/podcast-486/",
+		legacyPostURL("https://podcast.umputun.com/", Post{Slug: "podcast-486", Date: date}))
+	assert.Equal(t, "https://podcast.umputun.com/p/2016/01/02//ctocast-guest/",
+		legacyPostURL("https://podcast.umputun.com", Post{Slug: "ctocast-guest", Date: date}))
+}
+
+func TestPodcastGUID(t *testing.T) {
+	// example from podcast namespace spec
+	assert.Equal(t, "917393e3-1b1e-5cef-ace4-edaa54e1f810", podcastGUID("https://mp3s.nashownotes.com/pc20rss.xml"))
+	assert.Equal(t, podcastGUID("http://podcast.umputun.com/podcast.rss/"), podcastGUID("https://podcast.umputun.com/podcast.rss"))
+}
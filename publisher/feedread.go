@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	nsItunes  = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+	nsPodcast = "https://podcastindex.org/namespace/1.0"
+	nsAtom    = "http://www.w3.org/2005/Atom"
+)
+
+// feedDoc is a parsed rss feed, used to inspect published and generated feeds.
+// Namespaced fields go before plain ones with the same local name, otherwise
+// the plain field would catch namespaced elements as well.
+type feedDoc struct {
+	Channel feedDocChannel `xml:"channel"`
+}
+
+type feedDocChannel struct {
+	AtomLinks      []rssAtomLink `xml:"http://www.w3.org/2005/Atom link"`
+	ItunesImage    rssHref       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	ItunesAuthor   string        `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+	ItunesCategory []rssCategory `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+	ItunesExplicit string        `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+	PodcastGUID    string        `xml:"https://podcastindex.org/namespace/1.0 guid"`
+	Title          string        `xml:"title"`
+	Link           string        `xml:"link"`
+	Description    string        `xml:"description"`
+	Language       string        `xml:"language"`
+	Image          rssImage      `xml:"image"`
+	Items          []feedDocItem `xml:"item"`
+}
+
+type feedDocItem struct {
+	ItunesTitle    string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd title"`
+	ItunesImage    rssHref      `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	ItunesDuration string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ItunesEpisode  string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	Title          string       `xml:"title"`
+	Link           string       `xml:"link"`
+	GUID           rssGUID      `xml:"guid"`
+	PubDate        string       `xml:"pubDate"`
+	Description    string       `xml:"description"`
+	Enclosures     []feedDocEnc `xml:"enclosure"`
+}
+
+type feedDocEnc struct {
+	URL    string `xml:"url,attr"`
+	Length string `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// loadFeed reads feed from the file or fetches it if src is http(s) url
+func loadFeed(src string) ([]byte, error) {
+	if !strings.HasPrefix(src, "http://") && !strings.HasPrefix(src, "https://") {
+		data, err := os.ReadFile(src) //nolint:gosec
+		if err != nil {
+			return nil, fmt.Errorf("error reading feed %s: %w", src, err)
+		}
+		return data, nil
+	}
+
+	client := http.Client{Timeout: time.Second * 30}
+	resp, err := client.Get(src)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching feed %s: %w", src, err)
+	}
+	defer resp.Body.Close() //nolint:gosec
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching feed %s: status %d", src, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading feed %s: %w", src, err)
+	}
+	return data, nil
+}
+
+// parseFeed unmarshals rss feed
+func parseFeed(data []byte) (feedDoc, error) {
+	var res feedDoc
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if strings.EqualFold(charset, "utf-8") {
+			return input, nil
+		}
+		return nil, fmt.Errorf("unsupported charset %s", charset)
+	}
+	if err := dec.Decode(&res); err != nil {
+		return feedDoc{}, fmt.Errorf("can't parse feed: %w", err)
+	}
+	return res, nil
+}
+
+// rfc822Zones are offsets of time zone names allowed by rfc 822, time.Parse doesn't know them
+// unless the local time zone uses the same abbreviation
+var rfc822Zones = map[string]int{"UT": 0, "GMT": 0, "Z": 0, "EST": -5, "EDT": -4, "CST": -6, "CDT": -5,
+	"MST": -7, "MDT": -6, "PST": -8, "PDT": -7}
+
+// parseFeedDate parses rss pubDate in rfc 2822 format, with or without day of week
+func parseFeedDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC1123Z, "Mon, 2 Jan 2006 15:04:05 -0700", "2 Jan 2006 15:04:05 -0700"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	// named zones, rfc 2822 obsolete syntax but still used by many feeds
+	if i := strings.LastIndex(s, " "); i > 0 {
+		if offset, ok := rfc822Zones[strings.ToUpper(s[i+1:])]; ok {
+			for _, layout := range []string{"Mon, 2 Jan 2006 15:04:05", "2 Jan 2006 15:04:05"} {
+				if t, err := time.ParseInLocation(layout, s[:i], time.FixedZone(s[i+1:], offset*3600)); err == nil {
+					return t, nil
+				}
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid rfc 2822 date %q", s)
+}
+
+// Key returns stable key to match the same episode across feeds, episode number is preferred
+// and media file name is used for items without it
+func (it feedDocItem) Key() string {
+	if it.ItunesEpisode != "" {
+		if n, err := strconv.Atoi(strings.TrimSpace(it.ItunesEpisode)); err == nil {
+			return "episode " + strconv.Itoa(n)
+		}
+	}
+	if u := it.EnclosureURL(); u != "" {
+		if m := reEpisodeFile.FindStringSubmatch(u); len(m) > 1 {
+			n, _ := strconv.Atoi(m[1]) // regex guarantees digits
+			return "episode " + strconv.Itoa(n)
+		}
+		return path.Base(u)
+	}
+	return it.GUID.Value
+}
+
+// EnclosureURL returns url of the first enclosure or empty string
+func (it feedDocItem) EnclosureURL() string {
+	if len(it.Enclosures) == 0 {
+		return ""
+	}
+	return it.Enclosures[0].URL
+}
@@ -3,16 +3,17 @@ module github.com/podcast-uwp/publisher
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/bogem/id3v2 v1.2.0
 	github.com/go-pkgz/lgr v0.11.0
 	github.com/jessevdk/go-flags v1.5.0
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.8.1
 	golang.org/x/crypto v0.7.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/sys v0.7.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
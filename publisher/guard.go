@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// FeedGuard compares freshly generated feed with the published one, to catch changes
+// making podcast apps to re-download all episodes
+type FeedGuard struct {
+	New    string `long:"new" default:"/srv/podcast-uwp/hugo/public/podcast.rss" description:"generated feed, file or url"`
+	Old    string `long:"old" default:"https://podcast.umputun.com/podcast.rss" description:"published feed, file or url"`
+	Strict bool   `long:"strict" description:"fail on any difference, not only on changed guids"`
+}
+
+// feedDiff is a result of feeds comparison
+type feedDiff struct {
+	GUIDs      []string // changed guids of existing episodes, always fatal
+	Enclosures []string // changed enclosure urls
+	Dropped    []string // items removed from the feed, except the ones pushed out by new episodes
+	Dates      []string // changed publication dates
+}
+
+// feedGuardCmd loads both feeds and fails on changed guids, or on any difference in strict mode
+func feedGuardCmd(req FeedGuard) error {
+	log.Printf("[INFO] compare feed %s with published %s", req.New, req.Old)
+
+	newData, err := loadFeed(req.New)
+	if err != nil {
+		return err
+	}
+	oldData, err := loadFeed(req.Old)
+	if err != nil {
+		return err
+	}
+
+	newFeed, err := parseFeed(newData)
+	if err != nil {
+		return fmt.Errorf("new feed %s: %w", req.New, err)
+	}
+	oldFeed, err := parseFeed(oldData)
+	if err != nil {
+		return fmt.Errorf("published feed %s: %w", req.Old, err)
+	}
+
+	diff := compareFeeds(oldFeed, newFeed)
+	for _, s := range diff.GUIDs {
+		log.Printf("[WARN] guid changed, %s", s)
+	}
+	for _, s := range diff.Enclosures {
+		log.Printf("[WARN] enclosure changed, %s", s)
+	}
+	for _, s := range diff.Dropped {
+		log.Printf("[WARN] item dropped, %s", s)
+	}
+	for _, s := range diff.Dates {
+		log.Printf("[WARN] date shifted, %s", s)
+	}
+
+	if len(diff.GUIDs) > 0 {
+		return fmt.Errorf("%d episodes changed guid", len(diff.GUIDs))
+	}
+	if total := len(diff.Enclosures) + len(diff.Dropped) + len(diff.Dates); req.Strict && total > 0 {
+		return fmt.Errorf("%d differences found in strict mode", total)
+	}
+	log.Printf("[INFO] no guid changes in %d published items", len(oldFeed.Channel.Items))
+	return nil
+}
+
+// compareFeeds matches items of both feeds by episode and reports differences for the items present in
+// the published feed. Items older than the oldest one in the new feed are not reported as dropped,
+// those are pushed out of fixed size feed by new episodes.
+func compareFeeds(oldFeed, newFeed feedDoc) feedDiff {
+	res := feedDiff{}
+
+	newItems := map[string]feedDocItem{}
+	var oldest *feedDocItem
+	for i, it := range newFeed.Channel.Items {
+		newItems[it.Key()] = it
+		if oldest == nil || itemTime(it).Before(itemTime(*oldest)) {
+			oldest = &newFeed.Channel.Items[i]
+		}
+	}
+
+	for _, oldItem := range oldFeed.Channel.Items {
+		key := oldItem.Key()
+		newItem, ok := newItems[key]
+		if !ok {
+			if oldest == nil || !itemTime(oldItem).Before(itemTime(*oldest)) {
+				res.Dropped = append(res.Dropped, fmt.Sprintf("%s %q", key, oldItem.Title))
+			}
+			continue
+		}
+
+		if oldItem.GUID.Value != newItem.GUID.Value {
+			res.GUIDs = append(res.GUIDs, fmt.Sprintf("%s: %q -> %q", key, oldItem.GUID.Value, newItem.GUID.Value))
+		}
+		if oldItem.EnclosureURL() != newItem.EnclosureURL() {
+			res.Enclosures = append(res.Enclosures, fmt.Sprintf("%s: %q -> %q", key, oldItem.EnclosureURL(), newItem.EnclosureURL()))
+		}
+
+		oldTime, oldErr := parseFeedDate(oldItem.PubDate)
+		newTime, newErr := parseFeedDate(newItem.PubDate)
+		switch {
+		case oldErr != nil || newErr != nil:
+			if oldItem.PubDate != newItem.PubDate {
+				res.Dates = append(res.Dates, fmt.Sprintf("%s: %q -> %q", key, oldItem.PubDate, newItem.PubDate))
+			}
+		case !oldTime.Equal(newTime):
+			res.Dates = append(res.Dates, fmt.Sprintf("%s: %q -> %q (%s)", key, oldItem.PubDate, newItem.PubDate,
+				newTime.Sub(oldTime)))
+		}
+	}
+	return res
+}
+
+// itemTime returns item's publication time, zero time if date is invalid
+func itemTime(it feedDocItem) time.Time {
+	t, err := parseFeedDate(it.PubDate)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareFeeds(t *testing.T) {
+	oldFeed, err := parseFeed([]byte(`<rss version="2.0"><channel>
+<item><title>UWP - Выпуск 572</title><guid>https://podcast.umputun.com/p/2023/04/08/podcast-572/</guid>
+	<pubDate>Sat, 08 Apr 2023 14:10:05 EST</pubDate>
+	<enclosure url="http://podcast.umputun.com/media/ump_podcast572.mp3" length="1" type="audio/mp3"/></item>
+<item><title>UWP - Выпуск 571</title><guid>https://podcast.umputun.com/p/2023/04/01/podcast-571/</guid>
+	<pubDate>Sat, 01 Apr 2023 14:10:05 EST</pubDate>
+	<enclosure url="https://podcast.umputun.com/media/ump_podcast571.mp3" length="1" type="audio/mp3"/></item>
+<item><title>Special</title><guid>https://podcast.umputun.com/p/2023/03/30/special/</guid>
+	<pubDate>Thu, 30 Mar 2023 10:00:00 EST</pubDate>
+	<enclosure url="https://podcast.umputun.com/media/special.mp3" length="1" type="audio/mp3"/></item>
+<item><title>UWP - Выпуск 570</title><guid>https://podcast.umputun.com/p/2023/03/25/podcast-570/</guid>
+	<pubDate>Sat, 25 Mar 2023 15:20:11 EST</pubDate>
+	<enclosure url="https://podcast.umputun.com/media/ump_podcast570.mp3" length="1" type="audio/mp3"/></item>
+<item><title>UWP - Выпуск 569</title><guid>https://podcast.umputun.com/p/2023/03/18/podcast-569/</guid>
+	<pubDate>Sat, 18 Mar 2023 15:20:11 EST</pubDate>
+	<enclosure url="https://podcast.umputun.com/media/ump_podcast569.mp3" length="1" type="audio/mp3"/></item>
+</channel></rss>`))
+	require.NoError(t, err)
+
+	newFeed, err := parseFeed([]byte(`<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd"><channel>
+<item><title>UWP - Выпуск 573</title><guid>https://podcast.umputun.com/p/2023/04/15/podcast-573/</guid>
+	<pubDate>Sat, 15 Apr 2023 14:10:05 -0500</pubDate><itunes:episode>573</itunes:episode>
+	<enclosure url="https://podcast.umputun.com/media/ump_podcast573.mp3" length="1" type="audio/mpeg"/></item>
+<item><title>UWP - Выпуск 572</title><guid>https://podcast.umputun.com/p/2023/04/08/podcast-572/</guid>
+	<pubDate>Sat, 08 Apr 2023 14:10:05 -0500</pubDate><itunes:episode>572</itunes:episode>
+	<enclosure url="https://podcast.umputun.com/media/ump_podcast572.mp3" length="1" type="audio/mpeg"/></item>
+<item><title>UWP - Выпуск 571</title><guid>http://podcast.umputun.com/p/2023/04/01/podcast-571/</guid>
+	<pubDate>Sat, 01 Apr 2023 14:10:05 -0500</pubDate><itunes:episode>571</itunes:episode>
+	<enclosure url="https://podcast.umputun.com/media/ump_podcast571.mp3" length="1" type="audio/mpeg"/></item>
+<item><title>UWP - Выпуск 570</title><guid>https://podcast.umputun.com/p/2023/03/25/podcast-570/</guid>
+	<pubDate>Sat, 25 Mar 2023 15:20:11 -0600</pubDate><itunes:episode>570</itunes:episode>
+	<enclosure url="https://podcast.umputun.com/media/ump_podcast570.mp3" length="1" type="audio/mpeg"/></item>
+</channel></rss>`))
+	require.NoError(t, err)
+
+	diff := compareFeeds(oldFeed, newFeed)
+	assert.Equal(t, []string{`episode 571: "https://podcast.umputun.com/p/2023/04/01/podcast-571/" -> ` +
+		`"http://podcast.umputun.com/p/2023/04/01/podcast-571/"`}, diff.GUIDs)
+	assert.Equal(t, []string{`episode 572: "http://podcast.umputun.com/media/ump_podcast572.mp3" -> ` +
+		`"https://podcast.umputun.com/media/ump_podcast572.mp3"`}, diff.Enclosures)
+	assert.Equal(t, []string{`special.mp3 "Special"`}, diff.Dropped, "569 pushed out by 573, not reported")
+	assert.Equal(t, []string{`episode 570: "Sat, 25 Mar 2023 15:20:11 EST" -> "Sat, 25 Mar 2023 15:20:11 -0600" (1h0m0s)`},
+		diff.Dates)
+}
+
+func TestFeedGuardCmd(t *testing.T) {
+	feed := `<rss version="2.0"><channel><item><title>UWP - Выпуск 571</title><guid>%s</guid>
+	<pubDate>Sat, 01 Apr 2023 14:10:05 -0500</pubDate>
+	<enclosure url="https://podcast.umputun.com/media/ump_podcast571.mp3" length="1" type="audio/mpeg"/></item>
+	</channel></rss>`
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/podcast.rss" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(fmt.Sprintf(feed, "https://podcast.umputun.com/p/2023/04/01/podcast-571/")))
+	}))
+	defer ts.Close()
+
+	newFile := filepath.Join(t.TempDir(), "podcast.rss")
+	require.NoError(t, os.WriteFile(newFile, []byte(fmt.Sprintf(feed, "https://podcast.umputun.com/p/2023/04/01/podcast-571/")), 0o600))
+	assert.NoError(t, feedGuardCmd(FeedGuard{New: newFile, Old: ts.URL + "/podcast.rss"}))
+
+	require.NoError(t, os.WriteFile(newFile, []byte(fmt.Sprintf(feed, "https://podcast.umputun.com/media/ump_podcast571.mp3")), 0o600))
+	assert.EqualError(t, feedGuardCmd(FeedGuard{New: newFile, Old: ts.URL + "/podcast.rss"}), "1 episodes changed guid")
+
+	assert.ErrorContains(t, feedGuardCmd(FeedGuard{New: newFile, Old: ts.URL + "/archives.rss"}), "status 404")
+}
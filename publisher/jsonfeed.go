@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// jsonFeedFile is the name of json feed file in the output directory
+const jsonFeedFile = "podcast.json"
+
+// jsonFeed is a JSON Feed 1.1 document, see https://www.jsonfeed.org/version/1.1/
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Icon        string         `json:"icon,omitempty"`
+	Authors     []jsonAuthor   `json:"authors,omitempty"`
+	Language    string         `json:"language,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentHTML   string           `json:"content_html"`
+	Image         string           `json:"image,omitempty"`
+	DatePublished string           `json:"date_published"`
+	Tags          []string         `json:"tags,omitempty"`
+	Attachments   []jsonAttachment `json:"attachments"`
+}
+
+type jsonAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Title    string `json:"title,omitempty"`
+	Size     int64  `json:"size_in_bytes,omitempty"`
+	Duration int64  `json:"duration_in_seconds,omitempty"`
+}
+
+// makeJSONFeed creates json feed with the same items as the main rss feed, item ids are rss guids
+func makeJSONFeed(site siteConfig, mediaURL string, size int, episodes []Post, media map[string]mediaInfo) jsonFeed {
+	res := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       site.Title,
+		HomePageURL: site.BaseURL,
+		FeedURL:     site.BaseURL + jsonFeedFile,
+		Description: site.Description,
+		Icon:        site.Cover,
+		Authors:     []jsonAuthor{{Name: site.Author, URL: site.BaseURL}},
+		Language:    site.Language,
+		Items:       []jsonFeedItem{},
+	}
+
+	for i, ep := range episodes {
+		if size > 0 && i >= size {
+			break
+		}
+		link := ep.Permalink(site.BaseURL, site.Permalink)
+		info := media[ep.Filename+".mp3"]
+		res.Items = append(res.Items, jsonFeedItem{
+			ID:            legacyPostURL(site.BaseURL, ep),
+			URL:           link,
+			Title:         ep.Title,
+			ContentHTML:   renderMarkdown(ep.Body),
+			Image:         ep.Image,
+			DatePublished: ep.Date.In(siteTZ).Format(time.RFC3339),
+			Tags:          ep.Categories,
+			Attachments: []jsonAttachment{{
+				URL:      strings.TrimSuffix(mediaURL, "/") + "/" + ep.Filename + ".mp3",
+				MimeType: "audio/mpeg",
+				Title:    ep.Title,
+				Size:     info.Size,
+				Duration: int64(info.Duration.Seconds()),
+			}},
+		})
+	}
+	return res
+}
+
+func writeJSONFeed(file string, feed jsonFeed) error {
+	data, err := json.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling json feed %s: %w", file, err)
+	}
+	return writeFileAtomic(file, data)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeJSONFeed(t *testing.T) {
+	site, err := loadSiteConfig("testdata/hugo/config.toml")
+	require.NoError(t, err)
+	posts, err := loadPosts("testdata/hugo/content/posts")
+	require.NoError(t, err)
+	episodes := publishedEpisodes(posts, time.Date(2023, 4, 7, 0, 0, 0, 0, time.UTC))
+	media := map[string]mediaInfo{"ump_podcast571.mp3": {Size: 1234, Duration: 90 * time.Minute}}
+
+	feed := makeJSONFeed(site, "https://podcast.umputun.com/media", 1, episodes, media)
+	file := filepath.Join(t.TempDir(), jsonFeedFile)
+	require.NoError(t, writeJSONFeed(file, feed))
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	var res map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &res))
+	assert.Equal(t, "https://jsonfeed.org/version/1.1", res["version"])
+	assert.Equal(t, "https://podcast.umputun.com/podcast.json", res["feed_url"])
+
+	items := res["items"].([]interface{})
+	require.Len(t, items, 1)
+	item := items[0].(map[string]interface{})
+	assert.Equal(t, "https://podcast.umputun.com/p/2023/04/01/podcast-571/", item["id"])
+	assert.Equal(t, legacyPostURL(site.BaseURL, episodes[0]), item["id"], "same as rss guid")
+	assert.Equal(t, "2023-04-01T14:10:05-05:00", item["date_published"])
+	assert.Equal(t, "https://podcast.umputun.com/images/uwp/uwp571.jpg", item["image"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"url": "https://podcast.umputun.com/media/ump_podcast571.mp3",
+		"mime_type": "audio/mpeg", "title": "UWP - Выпуск 571", "size_in_bytes": 1234.0, "duration_in_seconds": 5400.0}},
+		item["attachments"])
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// CheckLinks checks all links of posts and pages, media files checked on both primary and archive hosts
+type CheckLinks struct {
+	Location        string        `long:"location" default:"/Users/umputun/dev.umputun/podcast-uwp/hugo/content" description:"hugo content location, posts and pages"`
+	MediaURL        string        `long:"media-url" default:"https://podcast.umputun.com/media/" description:"media url"`
+	ArchiveMediaURL string        `long:"archive-media-url" default:"https://archive.rucast.net/uwp/media/" description:"archive media url"`
+	Workers         int           `long:"workers" default:"8" description:"concurrent checks"`
+	HostInterval    time.Duration `long:"host-interval" default:"500ms" description:"min interval between requests to the same host"`
+	Timeout         time.Duration `long:"timeout" default:"30s" description:"request timeout"`
+	Cache           string        `long:"cache" default:"/Users/umputun/Library/Caches/uwp-publisher/links-cache.json" description:"checked links cache file, empty to disable"`
+	CacheTTL        time.Duration `long:"cache-ttl" default:"168h" description:"how long good links are not rechecked"`
+}
+
+// linkRef is a link found in the content file
+type linkRef struct {
+	File    string
+	URL     string
+	Comment string // why the link checked, i.e. archive copy of the media
+}
+
+// linkStatus is a result of the link check, stored in cache
+type linkStatus struct {
+	Status  int       `json:"status,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// OK returns true for successful response
+func (s linkStatus) OK() bool {
+	return s.Error == "" && s.Status > 0 && s.Status < 400
+}
+
+func (s linkStatus) String() string {
+	if s.Error != "" {
+		return s.Error
+	}
+	return fmt.Sprintf("status %d", s.Status)
+}
+
+var reLinkURL = regexp.MustCompile(`https?://[^\s)"'<>\]\[]+`)
+
+// checkLinksCmd extracts links from content, checks them and reports broken links grouped by file
+func checkLinksCmd(req CheckLinks) error {
+	refs, err := contentLinks(req.Location, req.MediaURL, req.ArchiveMediaURL)
+	if err != nil {
+		return err
+	}
+
+	cache := loadLinksCache(req.Cache)
+	checker := linkChecker{client: &http.Client{Timeout: req.Timeout}, limiter: newHostLimiter(req.HostInterval),
+		workers: req.Workers}
+	urls := map[string]bool{}
+	todo := []string{}
+	for _, r := range refs {
+		if urls[r.URL] {
+			continue
+		}
+		urls[r.URL] = true
+		if st, ok := cache[r.URL]; ok && st.OK() && nowFn().Sub(st.Checked) < req.CacheTTL {
+			continue
+		}
+		todo = append(todo, r.URL)
+	}
+	log.Printf("[INFO] %d links in %s, %d unique, %d to check", len(refs), req.Location, len(urls), len(todo))
+
+	for u, st := range checker.check(todo) {
+		cache[u] = st
+	}
+	// report goes first, failed cache save only means the next run rechecks everything
+	if req.Cache != "" {
+		defer func() {
+			if err := saveLinksCache(req.Cache, cache); err != nil {
+				log.Printf("[WARN] can't save links cache: %v", err)
+			}
+		}()
+	}
+
+	broken := brokenLinks(refs, cache)
+	files := make([]string, 0, len(broken))
+	count := 0
+	for f, fileRefs := range broken {
+		files = append(files, f)
+		count += len(fileRefs)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		fmt.Println(f)
+		for _, r := range broken[f] {
+			comment := ""
+			if r.Comment != "" {
+				comment = ", " + r.Comment
+			}
+			fmt.Printf("  %s: %s%s\n", r.URL, cache[r.URL], comment)
+		}
+	}
+	if count > 0 {
+		return fmt.Errorf("%d broken links in %d files", count, len(files))
+	}
+	log.Printf("[INFO] no broken links")
+	return nil
+}
+
+// contentLinks returns all links of md files in location. For media files linked to primary host the archive
+// copy is added too. Media links to archive don't need primary copy, primary keeps recent episodes only.
+func contentLinks(location, mediaURL, archiveMediaURL string) ([]linkRef, error) {
+	var res []linkRef
+	err := filepath.WalkDir(location, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(file) != ".md" {
+			return nil
+		}
+		data, err := os.ReadFile(file) //nolint:gosec
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file, err)
+		}
+		seen := map[string]bool{}
+		for _, u := range reLinkURL.FindAllString(string(data), -1) {
+			u = strings.TrimRight(u, ".,;:!?*_")
+			if seen[u] {
+				continue
+			}
+			seen[u] = true
+			res = append(res, linkRef{File: file, URL: u})
+			name := path.Base(u)
+			if !strings.HasSuffix(name, ".mp3") {
+				continue
+			}
+			if strings.HasPrefix(trimScheme(u), trimScheme(mediaURL)) && !seen[archiveMediaURL+name] {
+				seen[archiveMediaURL+name] = true
+				res = append(res, linkRef{File: file, URL: archiveMediaURL + name, Comment: "archive copy of " + u})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error collecting links in %s: %w", location, err)
+	}
+	return res, nil
+}
+
+// trimScheme removes http or https scheme from url, old posts link to media over http
+func trimScheme(u string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(u, "https://"), "http://")
+}
+
+// brokenLinks returns refs with failed checks grouped by file
+func brokenLinks(refs []linkRef, statuses map[string]linkStatus) map[string][]linkRef {
+	res := map[string][]linkRef{}
+	for _, r := range refs {
+		if st, ok := statuses[r.URL]; ok && !st.OK() {
+			res[r.File] = append(res[r.File], r)
+		}
+	}
+	return res
+}
+
+// linkChecker checks links concurrently, with limited rate per host
+type linkChecker struct {
+	client  *http.Client
+	limiter *hostLimiter
+	workers int
+}
+
+// check returns status of each url
+func (c linkChecker) check(urls []string) map[string]linkStatus {
+	res := map[string]linkStatus{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	ch := make(chan string)
+	workers := c.workers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range ch {
+				st := c.checkURL(u)
+				if !st.OK() {
+					log.Printf("[DEBUG] %s: %s", u, st)
+				}
+				mu.Lock()
+				res[u] = st
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, u := range urls {
+		ch <- u
+	}
+	close(ch)
+	wg.Wait()
+	return res
+}
+
+// checkURL makes HEAD request, falls back to GET of the first byte if HEAD is not supported by the server
+func (c linkChecker) checkURL(link string) linkStatus {
+	u, err := url.Parse(link)
+	if err != nil {
+		return linkStatus{Error: err.Error(), Checked: nowFn()}
+	}
+	st := c.request(http.MethodHead, u)
+	if st.Error != "" || st.Status == http.StatusMethodNotAllowed || st.Status == http.StatusNotImplemented ||
+		st.Status == http.StatusForbidden {
+		st = c.request(http.MethodGet, u)
+	}
+	return st
+}
+
+func (c linkChecker) request(method string, u *url.URL) linkStatus {
+	c.limiter.wait(u.Host)
+	req, err := http.NewRequest(method, u.String(), http.NoBody)
+	if err != nil {
+		return linkStatus{Error: err.Error(), Checked: nowFn()}
+	}
+	req.Header.Set("User-Agent", "uwp-publisher/"+revision)
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0") // don't download media
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return linkStatus{Error: err.Error(), Checked: nowFn()}
+	}
+	defer resp.Body.Close() //nolint:gosec
+	return linkStatus{Status: resp.StatusCode, Checked: nowFn()}
+}
+
+// hostLimiter keeps min interval between requests to the same host
+type hostLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     map[string]time.Time
+}
+
+func newHostLimiter(interval time.Duration) *hostLimiter {
+	return &hostLimiter{interval: interval, next: map[string]time.Time{}}
+}
+
+// wait blocks until the next request to the host allowed
+func (l *hostLimiter) wait(host string) {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(l.interval)
+	l.mu.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+func loadLinksCache(file string) map[string]linkStatus {
+	res := map[string]linkStatus{}
+	if file == "" {
+		return res
+	}
+	data, err := os.ReadFile(file) //nolint:gosec
+	if err != nil {
+		log.Printf("[DEBUG] no links cache %s: %v", file, err)
+		return res
+	}
+	if err = json.Unmarshal(data, &res); err != nil {
+		log.Printf("[WARN] can't parse links cache %s: %v", file, err)
+		return map[string]linkStatus{}
+	}
+	return res
+}
+
+func saveLinksCache(file string, cache map[string]linkStatus) error {
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal links cache: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return fmt.Errorf("can't make links cache directory: %w", err)
+	}
+	return writeFileAtomic(file, data)
+}
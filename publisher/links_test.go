@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLinksCmd(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/media/ump_podcast571.mp3", "/archive/ump_podcast571.mp3", "/images/uwp571.jpg", "/page":
+			w.WriteHeader(http.StatusOK)
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			assert.Equal(t, "bytes=0-0", r.Header.Get("Range"))
+			w.WriteHeader(http.StatusPartialContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "posts"), 0o700))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "pages"), 0o700))
+	post := func(num string) string {
+		return strings.NewReplacer("SRV", srv.URL, "N", num).Replace(`+++
+title = "UWP - Выпуск N"
+image = "SRV/images/uwpN.jpg"
++++
+- ссылка на [страницу](SRV/page), а [эта](SRV/no-head).
+- и [сломанная](SRV/broken)
+
+[аудио](SRV/media/ump_podcastN.mp3)
+<audio src="SRV/media/ump_podcastN.mp3" preload="none"></audio>
+`)
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "posts", "podcast-571.md"),
+		[]byte(post("571")), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "posts", "podcast-572.md"),
+		[]byte(post("572")), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pages", "info.md"),
+		[]byte("+++\ntitle = \"info\"\n+++\n[архив]("+srv.URL+"/archive/ump_podcast1.mp3)\n"), 0o600))
+
+	req := CheckLinks{Location: dir, MediaURL: srv.URL + "/media/", ArchiveMediaURL: srv.URL + "/archive/",
+		Workers: 4, HostInterval: time.Millisecond, Timeout: time.Second, Cache: filepath.Join(dir, "cache.json"),
+		CacheTTL: time.Hour}
+	out := captureStdout(t, func() {
+		err := checkLinksCmd(req)
+		assert.EqualError(t, err, "6 broken links in 3 files")
+	})
+	assert.Equal(t, strings.ReplaceAll(strings.ReplaceAll(`DIR/pages/info.md
+  SRV/archive/ump_podcast1.mp3: status 404
+DIR/posts/podcast-571.md
+  SRV/broken: status 404
+DIR/posts/podcast-572.md
+  SRV/images/uwp572.jpg: status 404
+  SRV/broken: status 404
+  SRV/media/ump_podcast572.mp3: status 404
+  SRV/archive/ump_podcast572.mp3: status 404, archive copy of SRV/media/ump_podcast572.mp3
+`, "SRV", srv.URL), "DIR", dir), out)
+
+	// second run checks only broken links, good ones are cached
+	atomic.StoreInt32(&requests, 0)
+	captureStdout(t, func() { assert.Error(t, checkLinksCmd(req)) })
+	assert.Equal(t, int32(5), atomic.LoadInt32(&requests), "5 unique broken links rechecked")
+	cache := loadLinksCache(req.Cache)
+	assert.Len(t, cache, 10)
+	assert.True(t, cache[srv.URL+"/no-head"].OK())
+	assert.Equal(t, 404, cache[srv.URL+"/broken"].Status)
+
+	// cache can't be saved, report is printed anyway
+	req.Cache = filepath.Join(dir, "posts", "podcast-571.md", "cache.json")
+	out = captureStdout(t, func() { assert.EqualError(t, checkLinksCmd(req), "6 broken links in 3 files") })
+	assert.Contains(t, out, srv.URL+"/broken: status 404")
+}
+
+func TestContentLinksMediaScheme(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "podcast-10.md"), []byte("+++\ntitle = \"UWP - Выпуск 10\"\n+++\n"+
+		"[аудио](http://podcast.umputun.com/media/ump_podcast10.mp3)\n"), 0o600))
+
+	refs, err := contentLinks(dir, "https://podcast.umputun.com/media/", "https://archive.rucast.net/uwp/media/")
+	require.NoError(t, err)
+	file := filepath.Join(dir, "podcast-10.md")
+	assert.Equal(t, []linkRef{
+		{File: file, URL: "http://podcast.umputun.com/media/ump_podcast10.mp3"},
+		{File: file, URL: "https://archive.rucast.net/uwp/media/ump_podcast10.mp3",
+			Comment: "archive copy of http://podcast.umputun.com/media/ump_podcast10.mp3"},
+	}, refs)
+}
+
+func TestHostLimiter(t *testing.T) {
+	l := newHostLimiter(20 * time.Millisecond)
+	st := time.Now()
+	l.wait("a.example.com")
+	l.wait("b.example.com")
+	assert.Less(t, time.Since(st), 20*time.Millisecond, "different hosts not limited")
+	l.wait("a.example.com")
+	l.wait("a.example.com")
+	assert.GreaterOrEqual(t, time.Since(st), 40*time.Millisecond)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Lint checks front matter and content of all posts
+type Lint struct {
+	PostsLocation string   `long:"location" env:"POSTS_LOCATION" default:"/Users/umputun/dev.umputun/podcast-uwp/hugo/content/posts" description:"posts location"`
+	Categories    []string `long:"category" default:"podcast" default:"others" default:"video" description:"allowed categories"`
+}
+
+// lintIssue is a single problem found by linter
+type lintIssue struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (l lintIssue) String() string {
+	return fmt.Sprintf("%s:%d: %s", l.File, l.Line, l.Msg)
+}
+
+var (
+	reLintLineNum  = regexp.MustCompile(`^line (\d+): `)
+	reLintImage    = regexp.MustCompile(`/uwp(\d+)\.jpg$`)
+	reLintAudio    = regexp.MustCompile(`(?i)\[[\s*]*аудио[\s*]*\]\(([^)]+)\)|<a\s+href="([^"]+)"\s*>аудио</a>`) // markdown or html link
+	reLintQA       = regexp.MustCompile(`(?i)вопросы и ответы|ответы на вопросы`)
+	reLintAudioTag = regexp.MustCompile(`<audio\s+src="([^"]+)"`)
+	reLintURL      = regexp.MustCompile(`\b(https?)://[^\s)"'<>\]]+`)
+)
+
+// lintCmd checks all posts and prints file:line diagnostics, fails if any issue found
+func lintCmd(req Lint) error {
+	files, err := filepath.Glob(filepath.Join(req.PostsLocation, "*.md"))
+	if err != nil {
+		return fmt.Errorf("error listing posts in %s: %w", req.PostsLocation, err)
+	}
+	log.Printf("[INFO] lint %d posts in %s", len(files), req.PostsLocation)
+
+	issues := lintPosts(files, req.Categories)
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("%d issues found", len(issues))
+	}
+	return nil
+}
+
+// lintPosts checks each post and cross-checks episode numbers and file names between posts
+func lintPosts(files, categories []string) []lintIssue {
+	var issues []lintIssue
+	filenames := map[string]lintIssue{} // media file name to the first post using it
+	numbers := map[int]lintIssue{}      // episode number to the first post using it
+
+	for _, file := range files {
+		data, err := os.ReadFile(file) //nolint:gosec
+		if err != nil {
+			issues = append(issues, lintIssue{File: file, Line: 1, Msg: err.Error()})
+			continue
+		}
+		post, postIssues := lintPost(file, string(data), categories)
+		issues = append(issues, postIssues...)
+		if post.Filename == "" {
+			continue
+		}
+
+		at := lintIssue{File: file, Line: contentLine(string(data), "filename")}
+		if prev, ok := filenames[post.Filename]; ok {
+			at.Msg = fmt.Sprintf("filename %q already used in %s:%d", post.Filename, prev.File, prev.Line)
+			issues = append(issues, at)
+			continue
+		}
+		filenames[post.Filename] = at
+		if post.Number == 0 {
+			continue
+		}
+		if prev, ok := numbers[post.Number]; ok {
+			at.Msg = fmt.Sprintf("episode %d already used in %s:%d", post.Number, prev.File, prev.Line)
+			issues = append(issues, at)
+		} else {
+			numbers[post.Number] = at
+		}
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].File != issues[j].File {
+			return issues[i].File < issues[j].File
+		}
+		return issues[i].Line < issues[j].Line
+	})
+	return issues
+}
+
+// lintPost checks a single post, returns parsed post for cross-checks
+func lintPost(file, content string, categories []string) (Post, []lintIssue) {
+	var issues []lintIssue
+	add := func(line int, format string, args ...interface{}) {
+		issues = append(issues, lintIssue{File: file, Line: line, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	post, err := parsePost(content)
+	if err != nil {
+		line := 1
+		if m := reLintLineNum.FindStringSubmatch(strings.TrimPrefix(err.Error(), "invalid front matter: ")); m != nil {
+			n, _ := strconv.Atoi(m[1]) // regex guarantees digits
+			open, _ := frontMatterLines(content)
+			line = open + 1 + n // front matter starts after +++ line
+		}
+		if strings.Contains(err.Error(), "date") {
+			line = contentLine(content, "date")
+		}
+		add(line, "%v", err)
+		return Post{}, issues
+	}
+
+	if date := tomlString(post.Params, "date"); date != post.Date.Format(postDateFormats[0]) {
+		add(contentLine(content, "date"), "date %q is not in %s format", date, postDateFormats[0])
+	}
+	if post.Title == "" {
+		add(contentLine(content, "title"), "missing title")
+	}
+
+	if len(post.Categories) == 0 {
+		add(1, "missing categories")
+	}
+	for _, c := range post.Categories {
+		if !containsString(categories, c) {
+			add(contentLine(content, "categories"), "unknown category %q, allowed %v", c, categories)
+		}
+	}
+
+	if post.HasCategory("podcast") {
+		issues = append(issues, lintEpisode(file, content, post)...)
+	}
+
+	// mixed http and https links
+	schemes := map[string]int{}
+	for _, m := range reLintURL.FindAllStringSubmatchIndex(content, -1) {
+		scheme := content[m[2]:m[3]]
+		if _, ok := schemes[scheme]; !ok {
+			schemes[scheme] = lineAt(content, m[0])
+		}
+	}
+	if line, ok := schemes["http"]; ok && schemes["https"] > 0 {
+		add(line, "mixed http and https links")
+	}
+	return post, issues
+}
+
+// lintEpisode checks episode specific fields, image, audio links and topics
+func lintEpisode(file, content string, post Post) []lintIssue {
+	var issues []lintIssue
+	add := func(line int, format string, args ...interface{}) {
+		issues = append(issues, lintIssue{File: file, Line: line, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if post.Filename == "" {
+		add(1, "missing filename")
+		return issues
+	}
+	if post.Number == 0 {
+		add(contentLine(content, "filename"), "filename %q has no episode number", post.Filename)
+		return issues
+	}
+
+	// old episodes have no cover image at all, only a wrong one is an issue
+	if post.Image != "" {
+		if m := reLintImage.FindStringSubmatch(post.Image); m == nil {
+			add(contentLine(content, "image"), "image %q doesn't match uwp%d.jpg", post.Image, post.Number)
+		} else if m[1] != strconv.Itoa(post.Number) {
+			add(contentLine(content, "image"), "image %q doesn't match episode %d", post.Image, post.Number)
+		}
+	}
+
+	mp3 := "/" + post.Filename + ".mp3"
+	if m := reLintAudio.FindStringSubmatchIndex(content); m == nil {
+		add(bodyLine(content), "missing [аудио] link")
+	} else if link := submatch(content, m, 1) + submatch(content, m, 2); !strings.HasSuffix(link, mp3) {
+		add(lineAt(content, m[0]), "[аудио] link %q doesn't match filename %q", link, post.Filename)
+	}
+	if m := reLintAudioTag.FindStringSubmatchIndex(content); m == nil {
+		add(bodyLine(content), "missing <audio> tag")
+	} else if src := content[m[2]:m[3]]; !strings.HasSuffix(src, mp3) {
+		add(lineAt(content, m[0]), "<audio> src %q doesn't match filename %q", src, post.Filename)
+	}
+
+	if !reLintQA.MatchString(post.Body) {
+		add(bodyLine(content), "missing \"Вопросы и ответы\" topic")
+	}
+	return issues
+}
+
+// frontMatterLines returns zero based indexes of opening and closing +++ lines. Blank lines before the front
+// matter are allowed, as in splitFrontMatter. Closing index is -1 if not found.
+func frontMatterLines(content string) (open, closing int) {
+	lines := strings.Split(content, "\n")
+	open, closing = -1, -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if open < 0 {
+			if trimmed == "" {
+				continue
+			}
+			if trimmed != "+++" {
+				return 0, -1
+			}
+			open = i
+			continue
+		}
+		if trimmed == "+++" {
+			return open, i
+		}
+	}
+	if open < 0 {
+		open = 0
+	}
+	return open, closing
+}
+
+// contentLine returns line number of the front matter key, 1 if not found
+func contentLine(content, key string) int {
+	open, closing := frontMatterLines(content)
+	for i, line := range strings.Split(content, "\n") {
+		if i <= open {
+			continue
+		}
+		if closing >= 0 && i >= closing {
+			break
+		}
+		if eq := strings.Index(line, "="); eq > 0 && strings.TrimSpace(line[:eq]) == key {
+			return i + 1
+		}
+	}
+	return 1
+}
+
+// bodyLine returns line number of the first body line, after the front matter
+func bodyLine(content string) int {
+	if _, closing := frontMatterLines(content); closing >= 0 {
+		return closing + 2
+	}
+	return 1
+}
+
+// submatch returns n-th group of the match indexes, empty if the group didn't participate
+func submatch(content string, m []int, n int) string {
+	if m[2*n] < 0 {
+		return ""
+	}
+	return content[m[2*n]:m[2*n+1]]
+}
+
+// lineAt returns line number of the byte offset
+func lineAt(content string, offset int) int {
+	return strings.Count(content[:offset], "\n") + 1
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintCmd(t *testing.T) {
+	req := Lint{PostsLocation: "testdata/hugo/content/posts", Categories: []string{"podcast", "others", "video"}}
+	assert.NoError(t, lintCmd(req), "test posts are clean")
+	// real posts with [Аудио], "Ответы на вопросы", no image and a blank line before front matter
+	assert.NoError(t, lintCmd(Lint{PostsLocation: "testdata/lint", Categories: []string{"podcast"}}), "real posts are clean")
+
+	dir := copyTestPosts(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "podcast-572.md"), []byte(`+++
+title = "UWP - Выпуск 572"
+date = "2023-04-08 14:10:00"
+categories = ["podcast", "podcats"]
+image = "https://podcast.umputun.com/images/uwp/uwp527.jpg"
+filename = "ump_podcast571"
++++
+
+- Тема
+- Ссылка http://example.com
+
+[аудио](https://podcast.umputun.com/media/ump_podcast572.mp3)
+<audio src="https://podcast.umputun.com/media/ump_podcast571.mp3" preload="none"></audio>
+`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "podcast-573.md"), []byte(`
++++
+title = "UWP - Выпуск 573"
+date = "2023-04-15T14:10:00"
+categories = ["podcast"]
+filename = "ump_podcast573"
++++
+
+- Ответы на вопросы
+`), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.md"), []byte("+++\ntitle = \"broken\ndate = \"2023-01-01T10:00:00\"\n+++\n"), 0o600))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.md"))
+	require.NoError(t, err)
+	issues := lintPosts(files, req.Categories)
+	strs := make([]string, 0, len(issues))
+	for _, is := range issues {
+		rel, err := filepath.Rel(dir, is.File)
+		require.NoError(t, err)
+		is.File = rel
+		strs = append(strs, strings.ReplaceAll(is.String(), dir+string(filepath.Separator), ""))
+	}
+	assert.Equal(t, []string{
+		`broken.md:2: invalid front matter: line 1: key "title": strings cannot contain newlines`,
+		`podcast-572.md:3: date "2023-04-08 14:10:00" is not in 2006-01-02T15:04:05 format`,
+		`podcast-572.md:4: unknown category "podcats", allowed [podcast others video]`,
+		`podcast-572.md:5: image "https://podcast.umputun.com/images/uwp/uwp527.jpg" doesn't match episode 571`,
+		`podcast-572.md:6: filename "ump_podcast571" already used in podcast-571.md:6`,
+		`podcast-572.md:8: missing "Вопросы и ответы" topic`,
+		`podcast-572.md:10: mixed http and https links`,
+		`podcast-572.md:12: [аудио] link "https://podcast.umputun.com/media/ump_podcast572.mp3" doesn't match filename "ump_podcast571"`,
+		`podcast-573.md:8: missing [аудио] link`,
+		`podcast-573.md:8: missing <audio> tag`,
+	}, strs)
+}
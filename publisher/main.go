@@ -3,14 +3,17 @@ package main
 
 import (
 	"bufio"
+	"crypto/ed25519"
 	_ "embed"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
@@ -21,11 +24,34 @@ import (
 )
 
 type options struct {
-	Mp3Tags     Mp3Tags     `command:"mp3" description:"set mp3 tags"`
-	Deploy      Deploy      `command:"deploy" description:"deploy to remote server"`
-	PrepEpisode PrepEpisode `command:"prep" description:"prepare new episode"`
-	Git         Git         `command:"git" description:"commit and push new episode"`
-	Dbg         bool        `long:"dbg" env:"DEBUG" description:"debug mode"`
+	Mp3Tags      Mp3Tags      `command:"mp3" description:"set mp3 tags"`
+	Deploy       Deploy       `command:"deploy" description:"deploy to remote server"`
+	PrepEpisode  PrepEpisode  `command:"prep" description:"prepare new episode"`
+	Git          Git          `command:"git" description:"commit and push new episode"`
+	Feed         Feed         `command:"feed" description:"generate rss feeds"`
+	FeedGuard    FeedGuard    `command:"feed-guard" description:"compare generated feed with published one"`
+	Validate     ValidateFeed `command:"validate-feed" description:"validate rss feed"`
+	Chapters     Chapters     `command:"chapters" description:"make json chapters from episode topics"`
+	Transcript   Transcript   `command:"transcript" description:"convert and publish episode transcript"`
+	Lint         Lint         `command:"lint" description:"check posts front matter and content"`
+	Migrate      Migrate      `command:"migrate" description:"apply rewrite rules to posts"`
+	CheckLinks   CheckLinks   `command:"check-links" description:"check links and media of posts and pages"`
+	NewPost      NewPost      `command:"post" description:"create non-episode post"`
+	Episodes     Episodes     `command:"episodes" description:"list episodes matching filters"`
+	Search       Search       `command:"search" description:"search posts topics, update site search index"`
+	Typo         Typo         `command:"typo" description:"check or fix russian typography of posts"`
+	ArchiveZip   ArchiveZip   `command:"archive-zip" description:"build zip bundles of episodes and update archives-zip page"`
+	Torrent      Torrent      `command:"torrent" description:"make torrents with web seed for episodes and zip bundles"`
+	MediaKey     MediaKey     `command:"media-key" description:"generate key signing SHA256SUMS of media"`
+	VerifyMirror VerifyMirror `command:"verify-mirror" description:"check mirror files against its signed SHA256SUMS"`
+	Audit        Audit        `command:"audit" description:"compare media files on primary and archive hosts with posts"`
+	Sync         Sync         `command:"sync" description:"copy missing and mismatched episodes between primary and archive hosts"`
+	Stats        Stats        `command:"stats" description:"make download and traffic statistics"`
+	ServeMedia   ServeMedia   `command:"serve-media" description:"serve media files and record downloads"`
+	Watch        Watch        `command:"watch" description:"watch site repo and rebuild site on changes"`
+	Build        Build        `command:"build" description:"build site into new directory and switch to it on success"`
+	Rollback     Rollback     `command:"rollback" description:"list site builds and switch back to previous one"`
+	Dbg          bool         `long:"dbg" env:"DEBUG" description:"debug mode"`
 }
 
 // Mp3Tags is a set for mp3 tags, used to parse command line as well as input for setMp3Tags
@@ -48,6 +74,17 @@ type Deploy struct {
 	ArchiveHost     string `long:"archive-host"  default:"archive.rucast.net" description:"archive host"`
 	ArchiveLocation string `long:"archive-location"  default:"/data/archive/uwp/media/" description:"archive location"`
 	PrivateKeyPath  string `long:"key"  default:"/Users/umputun/.ssh/id_rsa" description:"private key path"`
+	SignKey         string `long:"sign-key" default:"/Users/umputun/.ssh/uwp-media.key" description:"ed25519 key signing SHA256SUMS of media, empty to skip signing"`
+}
+
+// MediaUpload is a set of hosts for files published next to the episode media, same as deploy uses for mp3
+type MediaUpload struct {
+	Host            string `long:"host" default:"podcast.umputun.com" description:"primary remote host"`
+	User            string `long:"user" default:"umputun" description:"remote user"`
+	Location        string `long:"remote-location" default:"/srv/podcast-uwp/var/media" description:"media location on primary host"`
+	ArchiveHost     string `long:"archive-host" default:"archive.rucast.net" description:"archive host"`
+	ArchiveLocation string `long:"archive-location" default:"/data/archive/uwp/media/" description:"archive location"`
+	PrivateKeyPath  string `long:"key" default:"/Users/umputun/.ssh/id_rsa" description:"private key path"`
 }
 
 // PrepEpisode is a preparation command of new hugo post for the next episode
@@ -55,6 +92,7 @@ type PrepEpisode struct {
 	ReEpisode     string `long:"re-episode" env:"RE_EPISODE" default:"ump_podcast(\\d+)\\.mp3" description:"episode num regex"`
 	PostsLocation string `long:"location" env:"POSTS_LOCATION" default:"/Users/umputun/dev.umputun/podcast-uwp/hugo/content/posts" description:"posts location"`
 	Editor        string `long:"editor" default:"subl" description:"editor"`
+	Typo          bool   `long:"typo" description:"wait for editor to close and fix typography, editor should block, i.e. \"subl -w\""`
 }
 
 // Git command commits and pushes changes to the repo
@@ -120,6 +158,205 @@ func main() {
 		return
 	}
 
+	if p.Active != nil && p.Command.Find("feed") == p.Active {
+		if err := feedCmd(opts.Feed); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed feeds generation in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("feed-guard") == p.Active {
+		if err := feedGuardCmd(opts.FeedGuard); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed feed guard in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("validate-feed") == p.Active {
+		if err := validateFeedCmd(opts.Validate); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed feed validation in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("chapters") == p.Active {
+		if err := chaptersCmd(opts.Chapters); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed chapters in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("transcript") == p.Active {
+		if err := transcriptCmd(opts.Transcript); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed transcript in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("lint") == p.Active {
+		if err := lintCmd(opts.Lint); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed lint in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("migrate") == p.Active {
+		if err := migrateCmd(opts.Migrate); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed migrate in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("check-links") == p.Active {
+		if err := checkLinksCmd(opts.CheckLinks); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed check-links in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("post") == p.Active {
+		if err := newPostCmd(opts.NewPost); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed post in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("episodes") == p.Active {
+		if err := episodesCmd(opts.Episodes); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[DEBUG] completed episodes in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("search") == p.Active {
+		if err := searchCmd(opts.Search); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[DEBUG] completed search in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("typo") == p.Active {
+		if err := typoCmd(opts.Typo); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed typo in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("archive-zip") == p.Active {
+		if err := archiveZipCmd(opts.ArchiveZip); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed archive-zip in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("torrent") == p.Active {
+		if err := torrentCmd(opts.Torrent); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed torrent in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("media-key") == p.Active {
+		if err := mediaKeyCmd(opts.MediaKey); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("verify-mirror") == p.Active {
+		if err := verifyMirrorCmd(opts.VerifyMirror); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed verify-mirror in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("audit") == p.Active {
+		if err := auditCmd(opts.Audit); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed audit in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("sync") == p.Active {
+		if err := syncCmd(opts.Sync); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed sync in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("stats") != nil && p.Command.Find("stats").Find("downloads") == p.Active {
+		if err := statsDownloadsCmd(opts.Stats.Downloads); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed stats downloads in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("stats") != nil && p.Command.Find("stats").Find("subscribers") == p.Active {
+		if err := statsSubscribersCmd(opts.Stats.Subscribers); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed stats subscribers in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("stats") != nil && p.Command.Find("stats").Find("traffic") == p.Active {
+		if err := statsTrafficCmd(opts.Stats.Traffic); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed stats traffic in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("serve-media") == p.Active {
+		if err := serveMediaCmd(opts.ServeMedia); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] media server stopped after %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("watch") == p.Active {
+		if err := watchCmd(opts.Watch); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] watch stopped after %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("build") == p.Active {
+		if err := buildCmd(opts.Build); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed build in %v", time.Since(st))
+		return
+	}
+
+	if p.Active != nil && p.Command.Find("rollback") == p.Active {
+		if err := rollbackCmd(opts.Rollback); err != nil {
+			log.Fatalf("[PANIC] %v", err)
+		}
+		log.Printf("[INFO] completed rollback in %v", time.Since(st))
+		return
+	}
+
 	log.Printf("[WARN] nothing to do")
 }
 
@@ -242,10 +479,26 @@ func createEpisodeCmd(req PrepEpisode, epNumFn func(url, reEpisodeNumber string)
 
 	// Open the post file in text editor if specified
 	if req.Editor != "" {
-		if err = exec.Command(req.Editor, outfile).Start(); err != nil { //nolint:gosec
-			return fmt.Errorf("error opening file in editor %q: %w", req.Editor, err)
+		args := append(strings.Fields(req.Editor), outfile)
+		cmd := exec.Command(args[0], args[1:]...) //nolint:gosec
+		if !req.Typo {
+			if err = cmd.Start(); err != nil {
+				return fmt.Errorf("error opening file in editor %q: %w", req.Editor, err)
+			}
+			return nil
+		}
+		if err = cmd.Run(); err != nil {
+			return fmt.Errorf("error editing file in editor %q: %w", req.Editor, err)
 		}
 	}
+
+	if req.Typo {
+		issues, err := typoFiles([]string{outfile}, true)
+		if err != nil {
+			return err
+		}
+		log.Printf("[INFO] %d typography issues fixed in %s", len(issues), outfile)
+	}
 	return nil
 }
 
@@ -254,19 +507,21 @@ func createEpisodeCmd(req PrepEpisode, epNumFn func(url, reEpisodeNumber string)
 func deployCmd(req Deploy) error {
 	log.Printf("[INFO] deploy %+v", req)
 
-	key, err := os.ReadFile(req.PrivateKeyPath)
+	sshConfig, err := makeSSHConfig(req.User, req.PrivateKeyPath)
 	if err != nil {
-		return fmt.Errorf("unable to read private key: %v", err)
+		return err
 	}
 
-	signer, err := ssh.ParsePrivateKey(key)
-	if err != nil {
-		return fmt.Errorf("unable to parse private key: %v", err)
+	// load sign key before any upload, bad key shouldn't leave new file out of signed SHA256SUMS
+	var signKey ed25519.PrivateKey
+	if req.SignKey != "" {
+		if signKey, err = loadSignKey(req.SignKey); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("[WARN] no sign key, %s not updated", mediaSumsFile)
 	}
 
-	sshConfig := &ssh.ClientConfig{User: req.User, Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey()} // nolint
-
 	// create remote directory
 	if err = sshRun(sshConfig, req.Host, fmt.Sprintf("mkdir -p %s", req.Location)); err != nil {
 		return fmt.Errorf("error creating remote directory: %v", err)
@@ -293,6 +548,40 @@ func deployCmd(req Deploy) error {
 		return fmt.Errorf("error copying file to archive server: %v", err)
 	}
 
+	// update signed SHA256SUMS on both servers
+	if signKey == nil {
+		return nil
+	}
+	for _, dest := range []struct{ host, location string }{{req.Host, req.Location}, {req.ArchiveHost, req.ArchiveLocation}} {
+		err = updateMediaSums(sshConfig, dest.host, strings.TrimSuffix(dest.location, "/"), req.PrivateKeyPath, signKey,
+			filepath.Base(req.File))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uploadMedia is used to upload files next to episode media, replaced in tests
+var uploadMedia = uploadMediaFiles
+
+// uploadMediaFiles uploads files to podcast server and to archive server, the same way deploy uploads mp3
+func uploadMediaFiles(req MediaUpload, files ...string) error {
+	sshConfig, err := makeSSHConfig(req.User, req.PrivateKeyPath)
+	if err != nil {
+		return err
+	}
+	for _, dest := range []struct{ host, location string }{{req.Host, req.Location}, {req.ArchiveHost, req.ArchiveLocation}} {
+		if err = sshRun(sshConfig, dest.host, fmt.Sprintf("mkdir -p %s", dest.location)); err != nil {
+			return fmt.Errorf("error creating remote directory on %s: %v", dest.host, err)
+		}
+		for _, f := range files {
+			if err = scpUpload(sshConfig, f, dest.host, dest.location, req.PrivateKeyPath); err != nil {
+				return fmt.Errorf("error copying %s to %s: %v", filepath.Base(f), dest.host, err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -339,7 +628,28 @@ func gitCmd(req Git) error {
 	return nil
 }
 
+// makeSSHConfig makes ssh client config for user authenticated by the private key
+func makeSSHConfig(user, keyPath string) (*ssh.ClientConfig, error) {
+	key, err := os.ReadFile(keyPath) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("unable to read private key: %v", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key: %v", err)
+	}
+
+	return &ssh.ClientConfig{User: user, Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey()}, nil // nolint
+}
+
 func sshRun(sshConfig *ssh.ClientConfig, host, command string) error {
+	return sshExec(sshConfig, host, command, os.Stdout)
+}
+
+// sshExec runs command on the remote host, command output written to stdout
+func sshExec(sshConfig *ssh.ClientConfig, host, command string, stdout io.Writer) error {
 	log.Printf("[DEBUG] run command %q on %s", command, host)
 	client, err := ssh.Dial("tcp", host+":22", sshConfig)
 	if err != nil {
@@ -353,7 +663,7 @@ func sshRun(sshConfig *ssh.ClientConfig, host, command string) error {
 	}
 	defer session.Close()
 
-	session.Stdout, session.Stderr = os.Stdout, os.Stderr
+	session.Stdout, session.Stderr = stdout, os.Stderr
 	err = session.Run(command)
 	if err != nil {
 		return fmt.Errorf("failed to run command: %v", err)
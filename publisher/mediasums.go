@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	mrand "math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+	"golang.org/x/crypto/ssh"
+)
+
+// MediaKey generates ed25519 key signing SHA256SUMS manifests of media
+type MediaKey struct {
+	SignKey string `long:"sign-key" default:"/Users/umputun/.ssh/uwp-media.key" description:"private key file to create"`
+}
+
+// VerifyMirror checks files served by the mirror against its signed SHA256SUMS manifest
+type VerifyMirror struct {
+	PublicKey string        `long:"pubkey" env:"MEDIA_PUBKEY" description:"base64 ed25519 public key of manifest"`
+	Unsigned  bool          `long:"unsigned" description:"don't check manifest signature, no public key needed"`
+	Sample    int           `long:"sample" default:"5" description:"number of random files to check"`
+	Full      bool          `long:"full" description:"check all files"`
+	Timeout   time.Duration `long:"timeout" default:"60s" description:"http request timeout"`
+	Args      struct {
+		BaseURL string `positional-arg-name:"base-url" required:"true" description:"media base url, like https://podcast.umputun.com/media/"`
+	} `positional-args:"yes"`
+}
+
+const (
+	mediaSumsFile   = "SHA256SUMS"
+	mediaSumsSig    = "SHA256SUMS.sig"
+	mirrorChunkSize = 8 * 1024 * 1024
+)
+
+var (
+	reSumsLine     = regexp.MustCompile(`^([0-9a-f]{64}) [ *](.+)$`)
+	reContentRange = regexp.MustCompile(`^bytes (\d+)-(\d+)/(\d+)$`)
+)
+
+// mediaKeyCmd writes new private key and prints public key to pass to verify-mirror
+func mediaKeyCmd(req MediaKey) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("error generating key: %w", err)
+	}
+	fh, err := os.OpenFile(req.SignKey, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("error creating key file: %w", err)
+	}
+	if _, err = fh.WriteString(base64.StdEncoding.EncodeToString(priv.Seed()) + "\n"); err != nil {
+		_ = fh.Close()
+		return fmt.Errorf("error writing key file %s: %w", req.SignKey, err)
+	}
+	if err = fh.Close(); err != nil {
+		return fmt.Errorf("error closing key file %s: %w", req.SignKey, err)
+	}
+	log.Printf("[INFO] key saved to %s", req.SignKey)
+	fmt.Println(base64.StdEncoding.EncodeToString(pub))
+	return nil
+}
+
+// loadSignKey reads base64 encoded ed25519 seed
+func loadSignKey(file string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(file) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("unable to read sign key, make one with media-key command: %w", err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid sign key %s", file)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// updateMediaSums updates signed SHA256SUMS in the remote location. Files already listed are not hashed again,
+// except the changed ones, entries of removed files are dropped.
+func updateMediaSums(sshConfig *ssh.ClientConfig, host, location, keyPath string, key ed25519.PrivateKey, changed ...string) error {
+	var out bytes.Buffer
+	if err := sshExec(sshConfig, host, fmt.Sprintf("cat %s/%s 2>/dev/null || true", location, mediaSumsFile), &out); err != nil {
+		return fmt.Errorf("error reading %s on %s: %v", mediaSumsFile, host, err)
+	}
+	sums, err := parseSums(out.String())
+	if err != nil {
+		log.Printf("[WARN] can't parse %s on %s, rebuilding: %v", mediaSumsFile, host, err)
+		sums = map[string]string{}
+	}
+
+	out.Reset()
+	listCmd := fmt.Sprintf("find %s -maxdepth 1 -type f ! -name '%s*' ! -name '.*' -printf '%%f\\n'", location, mediaSumsFile)
+	if err = sshExec(sshConfig, host, listCmd, &out); err != nil {
+		return fmt.Errorf("error listing %s on %s: %v", location, host, err)
+	}
+	files := strings.Fields(out.String())
+	toHash := sumsToHash(sums, files, changed)
+	hashed := map[string]string{}
+	if len(toHash) > 0 {
+		log.Printf("[INFO] hash %d files on %s", len(toHash), host)
+		out.Reset()
+		if err = sshExec(sshConfig, host, fmt.Sprintf("cd %s && sha256sum -- %s", location, strings.Join(toHash, " ")), &out); err != nil {
+			return fmt.Errorf("error hashing files on %s: %v", host, err)
+		}
+		if hashed, err = parseSums(out.String()); err != nil {
+			return fmt.Errorf("error parsing hashes from %s: %v", host, err)
+		}
+	}
+	data := formatSums(mergeSums(sums, files, hashed))
+
+	dir, err := os.MkdirTemp("", "uwp-sums")
+	if err != nil {
+		return fmt.Errorf("error creating temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)                                                             //nolint:errcheck
+	if err = os.WriteFile(filepath.Join(dir, mediaSumsFile), data, 0o644); err != nil { //nolint:gosec // public file
+		return fmt.Errorf("error writing %s: %w", mediaSumsFile, err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, mediaSumsSig), signSums(data, key), 0o644); err != nil { //nolint:gosec // public file
+		return fmt.Errorf("error writing %s: %w", mediaSumsSig, err)
+	}
+	for _, f := range []string{mediaSumsFile, mediaSumsSig} {
+		if err = scpUpload(sshConfig, filepath.Join(dir, f), host, location, keyPath); err != nil {
+			return fmt.Errorf("error copying %s to %s: %v", f, host, err)
+		}
+	}
+	log.Printf("[INFO] %s updated on %s, %d files", mediaSumsFile, host, len(files))
+	return nil
+}
+
+// sumsToHash returns files not listed in sums and changed files present in files
+func sumsToHash(sums map[string]string, files, changed []string) []string {
+	res := []string{}
+	for _, f := range files {
+		if _, ok := sums[f]; !ok || containsString(changed, f) {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// mergeSums returns sums of files, hashed ones override existing
+func mergeSums(sums map[string]string, files []string, hashed map[string]string) map[string]string {
+	res := make(map[string]string, len(files))
+	for _, f := range files {
+		if h, ok := hashed[f]; ok {
+			res[f] = h
+			continue
+		}
+		if h, ok := sums[f]; ok {
+			res[f] = h
+		}
+	}
+	return res
+}
+
+// parseSums parses sha256sum output, text and binary mode lines
+func parseSums(data string) (map[string]string, error) {
+	res := map[string]string{}
+	for i, line := range strings.Split(data, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		m := reSumsLine.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("invalid line %d: %q", i+1, line)
+		}
+		res[m[2]] = m[1]
+	}
+	return res, nil
+}
+
+// formatSums returns sha256sum compatible manifest sorted by file name
+func formatSums(sums map[string]string) []byte {
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		buf.WriteString(sums[name] + "  " + name + "\n")
+	}
+	return buf.Bytes()
+}
+
+// signSums returns base64 encoded signature of the manifest
+func signSums(data []byte, key ed25519.PrivateKey) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)) + "\n")
+}
+
+// verifySums checks base64 encoded signature of the manifest with base64 encoded public key
+func verifySums(data, sig []byte, publicKey string) error {
+	pub, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid public key %q", publicKey)
+	}
+	rawSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %w", err)
+	}
+	if !ed25519.Verify(pub, data, rawSig) {
+		return fmt.Errorf("signature mismatch")
+	}
+	return nil
+}
+
+// verifyMirrorCmd fetches manifest of the mirror, checks its signature and hashes of sampled or all files
+func verifyMirrorCmd(req VerifyMirror) error {
+	if req.PublicKey == "" && !req.Unsigned {
+		return fmt.Errorf("public key required to check manifest signature, set --pubkey or MEDIA_PUBKEY, " +
+			"or --unsigned to skip the check")
+	}
+	baseURL := strings.TrimSuffix(req.Args.BaseURL, "/") + "/"
+	client := &http.Client{Timeout: req.Timeout}
+	data, err := httpGetBody(client, baseURL+mediaSumsFile)
+	if err != nil {
+		return err
+	}
+	if !req.Unsigned {
+		sig, e := httpGetBody(client, baseURL+mediaSumsSig)
+		if e != nil {
+			return e
+		}
+		if e = verifySums(data, sig, req.PublicKey); e != nil {
+			return fmt.Errorf("manifest %s: %w", baseURL+mediaSumsFile, e)
+		}
+		log.Printf("[INFO] manifest signature verified")
+	} else {
+		log.Printf("[WARN] manifest signature NOT checked, sha256 sums of %s may be forged by the mirror", baseURL)
+	}
+	sums, err := parseSums(string(data))
+	if err != nil {
+		return fmt.Errorf("invalid manifest %s: %w", baseURL+mediaSumsFile, err)
+	}
+
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if !req.Full && req.Sample < len(names) {
+		mrand.Shuffle(len(names), func(i, j int) { names[i], names[j] = names[j], names[i] })
+		names = names[:req.Sample]
+		sort.Strings(names)
+	}
+	log.Printf("[INFO] check %d of %d files", len(names), len(sums))
+
+	failed := 0
+	for _, name := range names {
+		if err := checkMirrorFile(client, baseURL+name, sums[name]); err != nil {
+			fmt.Printf("FAIL %s: %v\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("ok   %s\n", name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(names))
+	}
+	return nil
+}
+
+// checkMirrorFile downloads file by chunks with range requests and compares its sha256 with expected one
+func checkMirrorFile(client *http.Client, link, want string) error {
+	h := sha256.New()
+	for offset, total := int64(0), int64(-1); total < 0 || offset < total; {
+		req, err := http.NewRequest(http.MethodGet, link, http.NoBody)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+mirrorChunkSize-1))
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			_ = resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return fmt.Errorf("range requests not supported")
+			}
+			return fmt.Errorf("status %d", resp.StatusCode)
+		}
+		m := reContentRange.FindStringSubmatch(resp.Header.Get("Content-Range"))
+		if m == nil || m[1] != strconv.FormatInt(offset, 10) {
+			_ = resp.Body.Close()
+			return fmt.Errorf("unexpected content range %q for offset %d", resp.Header.Get("Content-Range"), offset)
+		}
+		total, _ = strconv.ParseInt(m[3], 10, 64) // regex guarantees digits
+		n, err := io.Copy(h, resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("empty range at %d of %d", offset, total)
+		}
+		offset += n
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("sha256 mismatch, %s instead of %s", got, want)
+	}
+	return nil
+}
+
+func httpGetBody(client *http.Client, link string) ([]byte, error) {
+	resp, err := client.Get(link)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %w", link, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching %s: status %d", link, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", link, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMediaKeyCmd(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "media.key")
+	out := captureStdout(t, func() { require.NoError(t, mediaKeyCmd(MediaKey{SignKey: file})) })
+	key, err := loadSignKey(file)
+	require.NoError(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))+"\n", out)
+
+	fi, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+	assert.Error(t, mediaKeyCmd(MediaKey{SignKey: file}), "existing key not overwritten")
+}
+
+func TestSignSums(t *testing.T) {
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{1}, ed25519.SeedSize))
+	pub := base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	data := formatSums(map[string]string{"b.mp3": strings.Repeat("b", 64), "a.mp3": strings.Repeat("a", 64)})
+	assert.Equal(t, strings.Repeat("a", 64)+"  a.mp3\n"+strings.Repeat("b", 64)+"  b.mp3\n", string(data))
+
+	sig := signSums(data, key)
+	assert.NoError(t, verifySums(data, sig, pub))
+	assert.EqualError(t, verifySums(append(data, '\n'), sig, pub), "signature mismatch")
+	assert.EqualError(t, verifySums(data, sig, "bad"), `invalid public key "bad"`)
+	assert.Error(t, verifySums(data, []byte("!!!"), pub))
+}
+
+func TestParseSums(t *testing.T) {
+	sums, err := parseSums(strings.Repeat("a", 64) + "  ump_podcast1.mp3\n" + strings.Repeat("b", 64) + " *ump podcast2.mp3\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"ump_podcast1.mp3": strings.Repeat("a", 64), "ump podcast2.mp3": strings.Repeat("b", 64)}, sums)
+
+	_, err = parseSums("abc  file.mp3\n")
+	assert.EqualError(t, err, `invalid line 1: "abc  file.mp3"`)
+}
+
+func TestMergeSums(t *testing.T) {
+	sums := map[string]string{"1.mp3": "h1", "2.mp3": "h2", "removed.mp3": "h3"}
+	files := []string{"1.mp3", "2.mp3", "3.mp3"}
+	assert.Equal(t, []string{"2.mp3", "3.mp3"}, sumsToHash(sums, files, []string{"2.mp3", "4.mp3"}))
+	assert.Equal(t, map[string]string{"1.mp3": "h1", "2.mp3": "new2", "3.mp3": "h3new"},
+		mergeSums(sums, files, map[string]string{"2.mp3": "new2", "3.mp3": "h3new"}))
+}
+
+func TestVerifyMirrorCmd(t *testing.T) {
+	key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{2}, ed25519.SeedSize))
+	pub := base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	big := bytes.Repeat([]byte("0123456789"), mirrorChunkSize/10+100) // two chunks
+	files := map[string][]byte{"ump_podcast1.mp3": []byte("mp3 1"), "ump_podcast2.mp3": big}
+	data := formatSums(map[string]string{"ump_podcast1.mp3": sha256Hex("mp3 1"), "ump_podcast2.mp3": sha256Hex(string(big))})
+
+	var ranges int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/media/")
+		switch name {
+		case mediaSumsFile:
+			_, _ = w.Write(data)
+		case mediaSumsSig:
+			_, _ = w.Write(signSums(data, key))
+		default:
+			content, ok := files[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			atomic.AddInt32(&ranges, 1)
+			assert.NotEmpty(t, r.Header.Get("Range"))
+			http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(content))
+		}
+	}))
+	defer srv.Close()
+
+	req := VerifyMirror{PublicKey: pub, Full: true, Timeout: time.Second * 5}
+	req.Args.BaseURL = srv.URL + "/media"
+	out := captureStdout(t, func() { require.NoError(t, verifyMirrorCmd(req)) })
+	assert.Equal(t, "ok   ump_podcast1.mp3\nok   ump_podcast2.mp3\n", out)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&ranges))
+
+	req.Full, req.Sample = false, 1
+	out = captureStdout(t, func() { require.NoError(t, verifyMirrorCmd(req)) })
+	assert.Equal(t, 1, strings.Count(out, "ok "))
+
+	files["ump_podcast1.mp3"] = []byte("mp3 X")
+	req.Full = true
+	out = captureStdout(t, func() { assert.EqualError(t, verifyMirrorCmd(req), "1 of 2 files failed") })
+	assert.Contains(t, out, "FAIL ump_podcast1.mp3: sha256 mismatch")
+
+	other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{3}, ed25519.SeedSize))
+	req.PublicKey = base64.StdEncoding.EncodeToString(other.Public().(ed25519.PublicKey))
+	assert.ErrorContains(t, verifyMirrorCmd(req), "signature mismatch")
+
+	req.PublicKey = ""
+	assert.ErrorContains(t, verifyMirrorCmd(req), "public key required")
+	req.Unsigned = true
+	captureStdout(t, func() { assert.EqualError(t, verifyMirrorCmd(req), "1 of 2 files failed") })
+}
+
+func TestCheckMirrorFileNoRanges(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("mp3"))
+	}))
+	defer srv.Close()
+	err := checkMirrorFile(srv.Client(), srv.URL+"/ump_podcast1.mp3", sha256Hex("mp3"))
+	assert.EqualError(t, err, "range requests not supported")
+}
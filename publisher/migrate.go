@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/go-pkgz/lgr"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Migrate applies named rewrite rules to all posts, shows diffs in dry-run mode
+type Migrate struct {
+	PostsLocation  string   `long:"location" env:"POSTS_LOCATION" default:"/Users/umputun/dev.umputun/podcast-uwp/hugo/content/posts" description:"posts location"`
+	Rules          []string `long:"rule" default:"https" default:"archive-host" default:"dead-links" default:"audio" description:"rules to apply, in order"`
+	DryRun         bool     `long:"dry-run" description:"show diffs without changing posts"`
+	HTTPSHosts     []string `long:"https-host" default:"podcast.umputun.com" default:"archive.rucast.net" description:"hosts switched to https"`
+	OldArchiveURLs []string `long:"old-archive-url" default:"http://archive.rucast.net/uwp/media/" description:"old archive media urls"`
+	ArchiveURL     string   `long:"archive-media-url" default:"https://archive.rucast.net/uwp/media/" description:"archive media url"`
+	DeadHosts      []string `long:"dead-host" default:"rpod.ru" default:"podfm.ru" description:"dead hosts, links unwrapped to text"`
+}
+
+// migrateRule is a named rewrite of the post content. Rules must be idempotent, i.e. applying a rule to
+// its own result makes no changes.
+type migrateRule struct {
+	Name  string
+	Apply func(content string) string
+}
+
+// migrateChange is a pending change of a single post
+type migrateChange struct {
+	File     string
+	Old, New string
+}
+
+var (
+	reMigrateAudioLink = regexp.MustCompile(`(?m)^[ \t]*(?:\*\*)?\[(?:\*\*)?\s*[Аа]удио\s*(?:\*\*)?\]\(([^)\s]+)\)(?:\*\*)?`)
+	reMigrateAudioTag  = regexp.MustCompile(`<audio\s+src="([^"]+)"[^>]*>(?:\s*</audio>)?`)
+)
+
+// migrateCmd applies rules to all posts. All changes are made and verified in memory first, posts are
+// written only if every changed post still parses.
+func migrateCmd(req Migrate) error {
+	rules, err := migrateRules(req)
+	if err != nil {
+		return err
+	}
+
+	files, err := filepath.Glob(filepath.Join(req.PostsLocation, "*.md"))
+	if err != nil {
+		return fmt.Errorf("error listing posts in %s: %w", req.PostsLocation, err)
+	}
+	sort.Strings(files)
+	log.Printf("[INFO] migrate %d posts in %s, rules %v", len(files), req.PostsLocation, req.Rules)
+
+	changes, err := migratePosts(files, rules)
+	if err != nil {
+		return err
+	}
+
+	for _, ch := range changes {
+		if req.DryRun {
+			diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{A: difflib.SplitLines(ch.Old),
+				B: difflib.SplitLines(ch.New), FromFile: "a/" + filepath.Base(ch.File), ToFile: "b/" + filepath.Base(ch.File), Context: 3})
+			if err != nil {
+				return fmt.Errorf("error making diff for %s: %w", ch.File, err)
+			}
+			fmt.Print(diff)
+			continue
+		}
+		if err = writeFileAtomic(ch.File, []byte(ch.New)); err != nil {
+			return err
+		}
+		log.Printf("[DEBUG] migrated %s", ch.File)
+	}
+
+	if req.DryRun {
+		log.Printf("[INFO] dry run, %d of %d posts would be changed", len(changes), len(files))
+		return nil
+	}
+	log.Printf("[INFO] %d of %d posts changed", len(changes), len(files))
+	return nil
+}
+
+// migratePosts applies rules to each file and returns changed posts only
+func migratePosts(files []string, rules []migrateRule) ([]migrateChange, error) {
+	var res []migrateChange
+	for _, file := range files {
+		data, err := os.ReadFile(file) //nolint:gosec
+		if err != nil {
+			return nil, fmt.Errorf("error reading post %s: %w", file, err)
+		}
+		content := string(data)
+		for _, r := range rules {
+			content = r.Apply(content)
+		}
+		if content == string(data) {
+			continue
+		}
+		if _, err = parsePost(content); err != nil {
+			return nil, fmt.Errorf("post %s is broken by migration: %w", file, err)
+		}
+		res = append(res, migrateChange{File: file, Old: string(data), New: content})
+	}
+	return res, nil
+}
+
+// migrateRules returns rules by name, in requested order
+func migrateRules(req Migrate) ([]migrateRule, error) {
+	known := map[string]func(content string) string{
+		"https": func(content string) string {
+			return migrateHTTPS(content, req.HTTPSHosts)
+		},
+		"archive-host": func(content string) string {
+			for _, old := range req.OldArchiveURLs {
+				content = replacePrefix(content, old, req.ArchiveURL)
+			}
+			return content
+		},
+		"dead-links": func(content string) string {
+			return migrateDeadLinks(content, req.DeadHosts)
+		},
+		"audio": migrateAudio,
+	}
+
+	res := make([]migrateRule, 0, len(req.Rules))
+	for _, name := range req.Rules {
+		fn, ok := known[name]
+		if !ok {
+			names := make([]string, 0, len(known))
+			for k := range known {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown rule %q, available %v", name, names)
+		}
+		res = append(res, migrateRule{Name: name, Apply: fn})
+	}
+	return res, nil
+}
+
+// migrateHTTPS switches http links of given hosts to https
+func migrateHTTPS(content string, hosts []string) string {
+	for _, host := range hosts {
+		re := regexp.MustCompile(`\bhttp://` + regexp.QuoteMeta(host) + `\b`)
+		content = re.ReplaceAllString(content, "https://"+host)
+	}
+	return content
+}
+
+// migrateDeadLinks unwraps markdown and html links to dead hosts, or their subdomains, keeping the link text
+func migrateDeadLinks(content string, hosts []string) string {
+	for _, host := range hosts {
+		url := `https?://(?:[a-z0-9-]+\.)*` + regexp.QuoteMeta(host) + `(?:[/?#][^)"\s]*)?`
+		reMd := regexp.MustCompile(`\[([^\]]*)\]\(` + url + `\)`)
+		reHTML := regexp.MustCompile(`<a\s+href="` + url + `"[^>]*>(.*?)</a>`)
+		content = reHTML.ReplaceAllString(reMd.ReplaceAllString(content, "$1"), "$1")
+	}
+	return content
+}
+
+// migrateAudio normalizes audio block to "[аудио](url)" link and closed <audio> tag, the link may be followed
+// by other links, like torrent
+func migrateAudio(content string) string {
+	content = reMigrateAudioLink.ReplaceAllString(content, "[аудио]($1)")
+	return reMigrateAudioTag.ReplaceAllString(content, `<audio src="$1" preload="none"></audio>`)
+}
+
+// replacePrefix replaces url prefix from with to. If to starts with from, places already starting with to
+// are skipped, so the result doesn't change if called again.
+func replacePrefix(content, from, to string) string {
+	if from == "" || from == to {
+		return content
+	}
+	extends := strings.HasPrefix(to, from)
+	var sb strings.Builder
+	for {
+		idx := strings.Index(content, from)
+		if idx < 0 {
+			sb.WriteString(content)
+			return sb.String()
+		}
+		if extends && strings.HasPrefix(content[idx:], to) {
+			sb.WriteString(content[:idx+len(to)])
+			content = content[idx+len(to):]
+			continue
+		}
+		sb.WriteString(content[:idx] + to)
+		content = content[idx+len(from):]
+	}
+}
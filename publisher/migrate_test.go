@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const migrateOldPost = `+++
+title = "UWP - Выпуск 248"
+date = "2011-05-14T10:00:00"
+categories = ["podcast"]
+image = "http://podcast.umputun.com/images/uwp/uwp248.jpg"
+filename = "ump_podcast248"
++++
+
+![](http://podcast.umputun.com/images/uwp/uwp248.jpg)
+
+- Приятный [подкаст](http://21csm-journal.rpod.ru/)
+- Ссылка на <a href="http://engsuccess.podfm.ru/my/1/">интервью</a>
+- Вопросы и ответы
+
+**[Аудио](http://archive.rucast.net/uwp/media/ump_podcast248.mp3)** ● [torrent](http://archive.rucast.net/uwp/media/ump_podcast248.mp3.torrent)
+<audio src="http://archive.rucast.net/uwp/media/ump_podcast248.mp3" preload="none">
+`
+
+func TestMigrateCmd(t *testing.T) {
+	dir := copyTestPosts(t)
+	file := filepath.Join(dir, "podcast-248.md")
+	require.NoError(t, os.WriteFile(file, []byte(migrateOldPost), 0o600))
+	clean, err := os.ReadFile(filepath.Join(dir, "podcast-571.md"))
+	require.NoError(t, err)
+
+	req := Migrate{PostsLocation: dir, Rules: []string{"https", "archive-host", "dead-links", "audio"},
+		HTTPSHosts: []string{"podcast.umputun.com"}, OldArchiveURLs: []string{"http://archive.rucast.net/uwp/media/"},
+		ArchiveURL: "https://archive.rucast.net/uwp/media/", DeadHosts: []string{"rpod.ru", "podfm.ru"}, DryRun: true}
+
+	out := captureStdout(t, func() { require.NoError(t, migrateCmd(req)) })
+	assert.Contains(t, out, "--- a/podcast-248.md\n+++ b/podcast-248.md\n")
+	assert.Contains(t, out, "-image = \"http://podcast.umputun.com/images/uwp/uwp248.jpg\"\n"+
+		"+image = \"https://podcast.umputun.com/images/uwp/uwp248.jpg\"\n")
+	assert.NotContains(t, out, "podcast-571.md")
+	data, err := os.ReadFile(file) //nolint:gosec
+	require.NoError(t, err)
+	assert.Equal(t, migrateOldPost, string(data), "dry run doesn't change posts")
+
+	req.DryRun = false
+	require.NoError(t, migrateCmd(req))
+	data, err = os.ReadFile(file) //nolint:gosec
+	require.NoError(t, err)
+	assert.Equal(t, `+++
+title = "UWP - Выпуск 248"
+date = "2011-05-14T10:00:00"
+categories = ["podcast"]
+image = "https://podcast.umputun.com/images/uwp/uwp248.jpg"
+filename = "ump_podcast248"
++++
+
+![](https://podcast.umputun.com/images/uwp/uwp248.jpg)
+
+- Приятный подкаст
+- Ссылка на интервью
+- Вопросы и ответы
+
+[аудио](https://archive.rucast.net/uwp/media/ump_podcast248.mp3) ● [torrent](https://archive.rucast.net/uwp/media/ump_podcast248.mp3.torrent)
+<audio src="https://archive.rucast.net/uwp/media/ump_podcast248.mp3" preload="none"></audio>
+`, string(data))
+	data, err = os.ReadFile(filepath.Join(dir, "podcast-571.md"))
+	require.NoError(t, err)
+	assert.Equal(t, string(clean), string(data), "up-to-date post not changed")
+
+	// second run changes nothing
+	req.DryRun = true
+	out = captureStdout(t, func() { require.NoError(t, migrateCmd(req)) })
+	assert.Empty(t, out)
+}
+
+func TestMigrateCmd_Errors(t *testing.T) {
+	dir := copyTestPosts(t)
+	err := migrateCmd(Migrate{PostsLocation: dir, Rules: []string{"https", "blah"}})
+	assert.EqualError(t, err, `unknown rule "blah", available [archive-host audio dead-links https]`)
+
+	// rule breaking front matter fails the whole migration, nothing written
+	file := filepath.Join(dir, "podcast-248.md")
+	require.NoError(t, os.WriteFile(file, []byte(migrateOldPost), 0o600))
+	req := Migrate{PostsLocation: dir, Rules: []string{"https", "archive-host"}, HTTPSHosts: []string{"podcast.umputun.com"},
+		OldArchiveURLs: []string{`date = "`}, ArchiveURL: `date = "bad`}
+	err = migrateCmd(req)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is broken by migration")
+	data, err := os.ReadFile(file) //nolint:gosec
+	require.NoError(t, err)
+	assert.Equal(t, migrateOldPost, string(data))
+}
+
+func TestReplacePrefix(t *testing.T) {
+	tbl := []struct {
+		content, from, to, res string
+	}{
+		{"a http://x/m/1.mp3 b http://x/m/2.mp3", "http://x/m/", "https://y/m/", "a https://y/m/1.mp3 b https://y/m/2.mp3"},
+		{"http://x/m/1.mp3 http://x/m/uwp/2.mp3", "http://x/m/", "http://x/m/uwp/", "http://x/m/uwp/1.mp3 http://x/m/uwp/2.mp3"},
+		{"http://x/m/1.mp3", "http://x/m/", "http://x/", "http://x/1.mp3"},
+		{"http://x/m/1.mp3", "http://x/m/", "http://x/m/", "http://x/m/1.mp3"},
+		{"nothing", "http://x/m/", "http://y/", "nothing"},
+	}
+	for i, tt := range tbl {
+		res := replacePrefix(tt.content, tt.from, tt.to)
+		assert.Equal(t, tt.res, res, "case %d", i)
+		assert.Equal(t, res, replacePrefix(res, tt.from, tt.to), "case %d, idempotent", i)
+	}
+}
+
+// captureStdout returns everything fn printed to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	orig := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = orig }()
+	fn()
+	require.NoError(t, w.Close())
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
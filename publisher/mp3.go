@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// mp3 bitrates in kbps for layer 3, indexed by [mpeg1 ? 0 : 1][bitrate index]
+var mp3Bitrates = [2][16]int{
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+}
+
+// mp3 sample rates, indexed by [version bits][sample rate index]
+var mp3SampleRates = map[byte][3]int{
+	3: {44100, 48000, 32000}, // mpeg1
+	2: {22050, 24000, 16000}, // mpeg2
+	0: {11025, 12000, 8000},  // mpeg2.5
+}
+
+// mp3Duration returns duration of layer 3 mp3 file. It uses Xing/Info or VBRI header
+// if present and falls back to the constant bitrate estimation otherwise.
+func mp3Duration(file string) (time.Duration, error) {
+	fh, err := os.Open(file) //nolint:gosec
+	if err != nil {
+		return 0, fmt.Errorf("error opening %s: %w", file, err)
+	}
+	defer fh.Close() //nolint
+
+	fi, err := fh.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("error getting file info %s: %w", file, err)
+	}
+
+	// 64k is enough to skip a small id3 tag, larger ones are skipped by offset
+	buf := make([]byte, 64*1024)
+	n, err := io.ReadFull(fh, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, fmt.Errorf("error reading %s: %w", file, err)
+	}
+	buf = buf[:n]
+
+	start := int64(0)
+	if len(buf) >= 10 && bytes.Equal(buf[:3], []byte("ID3")) {
+		size := int64(buf[6])<<21 | int64(buf[7])<<14 | int64(buf[8])<<7 | int64(buf[9])
+		start = 10 + size
+		if buf[5]&0x10 != 0 { // footer present
+			start += 10
+		}
+		if start+4 > int64(len(buf)) {
+			buf = make([]byte, 4096)
+			if n, err = fh.ReadAt(buf, start); err != nil && err != io.EOF {
+				return 0, fmt.Errorf("error reading %s: %w", file, err)
+			}
+			buf = buf[:n]
+		} else {
+			buf = buf[start:]
+		}
+	}
+
+	return mp3FrameDuration(buf, fi.Size()-start)
+}
+
+// mp3FrameDuration finds the first frame in data and calculates duration of audioSize bytes
+func mp3FrameDuration(data []byte, audioSize int64) (time.Duration, error) {
+	for i := 0; i+4 <= len(data); i++ {
+		if data[i] != 0xFF || data[i+1]&0xE0 != 0xE0 {
+			continue
+		}
+		version, layer := (data[i+1]>>3)&0x03, (data[i+1]>>1)&0x03
+		brIdx, srIdx := data[i+2]>>4, (data[i+2]>>2)&0x03
+		if version == 1 || layer != 1 || brIdx == 0 || brIdx == 15 || srIdx == 3 {
+			continue // not a valid layer 3 frame header
+		}
+		mpeg1 := version == 3
+		sampleRate := mp3SampleRates[version][srIdx]
+		samplesPerFrame, row := 576, 1
+		if mpeg1 {
+			samplesPerFrame, row = 1152, 0
+		}
+		bitrate := mp3Bitrates[row][brIdx] * 1000
+		mono := data[i+3]>>6 == 3
+
+		// xing/info header located after side info
+		sideInfo := 17
+		switch {
+		case mpeg1 && !mono:
+			sideInfo = 32
+		case !mpeg1 && mono:
+			sideInfo = 9
+		}
+		if pos := i + 4 + sideInfo; pos+12 <= len(data) {
+			tag := string(data[pos : pos+4])
+			flags := binary.BigEndian.Uint32(data[pos+4 : pos+8])
+			if (tag == "Xing" || tag == "Info") && flags&0x01 != 0 {
+				frames := binary.BigEndian.Uint32(data[pos+8 : pos+12])
+				return framesDuration(int64(frames), samplesPerFrame, sampleRate), nil
+			}
+		}
+
+		// vbri header has fixed offset of 32 bytes after frame header
+		if pos := i + 4 + 32; pos+18 <= len(data) && string(data[pos:pos+4]) == "VBRI" {
+			frames := binary.BigEndian.Uint32(data[pos+14 : pos+18])
+			return framesDuration(int64(frames), samplesPerFrame, sampleRate), nil
+		}
+
+		// constant bitrate
+		secs := float64(audioSize-int64(i)) * 8 / float64(bitrate)
+		return time.Duration(secs * float64(time.Second)).Round(time.Second), nil
+	}
+	return 0, fmt.Errorf("no mp3 frame found")
+}
+
+func framesDuration(frames int64, samplesPerFrame, sampleRate int) time.Duration {
+	secs := float64(frames) * float64(samplesPerFrame) / float64(sampleRate)
+	return time.Duration(secs * float64(time.Second)).Round(time.Second)
+}
+
+// formatDuration returns duration as HH:MM:SS, as expected by itunes:duration
+func formatDuration(d time.Duration) string {
+	secs := int(d.Round(time.Second).Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", secs/3600, (secs/60)%60, secs%60)
+}
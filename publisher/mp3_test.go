@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMp3Duration(t *testing.T) {
+	dir := t.TempDir()
+
+	// mpeg1 layer3, 128kbps, 44100Hz, stereo
+	header := []byte{0xFF, 0xFB, 0x90, 0x00}
+
+	t.Run("cbr with id3 tag", func(t *testing.T) {
+		id3 := []byte{'I', 'D', '3', 4, 0, 0, 0, 0, 0, 10}
+		data := append(append(id3, make([]byte, 10)...), header...)
+		data = append(data, make([]byte, 160000-len(header))...) // 10 seconds at 128kbps
+		file := filepath.Join(dir, "cbr.mp3")
+		require.NoError(t, os.WriteFile(file, data, 0o600))
+
+		d, err := mp3Duration(file)
+		require.NoError(t, err)
+		assert.Equal(t, 10*time.Second, d)
+	})
+
+	t.Run("vbr with xing header", func(t *testing.T) {
+		data := append([]byte{}, header...)
+		data = append(data, make([]byte, 32)...)                              // side info
+		data = append(data, 'X', 'i', 'n', 'g', 0, 0, 0, 1, 0, 0, 0x0e, 0xf4) // 3828 frames
+		data = append(data, make([]byte, 1000)...)
+		file := filepath.Join(dir, "vbr.mp3")
+		require.NoError(t, os.WriteFile(file, data, 0o600))
+
+		d, err := mp3Duration(file)
+		require.NoError(t, err)
+		assert.Equal(t, 100*time.Second, d)
+	})
+
+	t.Run("not mp3", func(t *testing.T) {
+		file := filepath.Join(dir, "bad.mp3")
+		require.NoError(t, os.WriteFile(file, []byte("some text"), 0o600))
+		_, err := mp3Duration(file)
+		assert.EqualError(t, err, "no mp3 frame found")
+	})
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "00:00:59", formatDuration(59*time.Second))
+	assert.Equal(t, "01:02:03", formatDuration(time.Hour+2*time.Minute+3*time.Second))
+}
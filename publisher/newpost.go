@@ -0,0 +1,163 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// NewPost is a command creating non-episode hugo post with slug transliterated from the russian title
+type NewPost struct {
+	Title         string `short:"t" long:"title" required:"true" description:"post title"`
+	Slug          string `long:"slug" description:"post slug, transliterated title by default"`
+	Category      string `long:"category" choice:"others" choice:"video" default:"others" description:"post category"`
+	Audio         string `long:"audio" description:"audio url, adds audio block"`
+	Video         string `long:"video" description:"video url, youtube or direct link, adds video block"`
+	PostsLocation string `long:"location" env:"POSTS_LOCATION" default:"/Users/umputun/dev.umputun/podcast-uwp/hugo/content/posts" description:"posts location"`
+	Editor        string `long:"editor" default:"subl" description:"editor"`
+}
+
+//go:embed uwp-post.tmpl
+var postTmplData string
+
+// translitTable is ICAO Doc 9303 transliteration of russian, the one used in russian passports since 2013
+var translitTable = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z", 'и': "i",
+	'й': "i", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t",
+	'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "ie", 'ы': "y", 'ь': "",
+	'э': "e", 'ю': "iu", 'я': "ia",
+}
+
+// newPostCmd makes a new post from the title, refuses to overwrite or duplicate existing slug
+func newPostCmd(req NewPost) error {
+	slug := req.Slug
+	if slug == "" {
+		slug = makeSlug(req.Title)
+	}
+	if slug == "" {
+		return fmt.Errorf("can't make slug from title %q, set it with --slug", req.Title)
+	}
+	log.Printf("[INFO] create post %q, slug %s", req.Title, slug)
+
+	if err := checkSlugCollision(req.PostsLocation, slug); err != nil {
+		return err
+	}
+
+	data := struct {
+		Title, Date, Category string
+		Audio, Video, YouTube string
+	}{
+		Title:    strings.ReplaceAll(strings.ReplaceAll(req.Title, `\`, `\\`), `"`, `\"`),
+		Date:     nowFn().Format("2006-01-02T15:04:05"),
+		Category: req.Category,
+		Audio:    req.Audio,
+		Video:    req.Video,
+		YouTube:  youTubeID(req.Video),
+	}
+	tmpl, err := template.New("post").Parse(postTmplData)
+	if err != nil {
+		return fmt.Errorf("error parsing template: %w", err)
+	}
+	var sb strings.Builder
+	if err = tmpl.Execute(&sb, data); err != nil {
+		return fmt.Errorf("error executing template: %w", err)
+	}
+
+	outfile := filepath.Join(req.PostsLocation, slug+".md")
+	if err = os.MkdirAll(req.PostsLocation, 0o750); err != nil {
+		return fmt.Errorf("error creating posts dir %s: %w", req.PostsLocation, err)
+	}
+	f, err := os.OpenFile(outfile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("error creating file %s: %w", outfile, err)
+	}
+	if _, err = f.WriteString(sb.String()); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error writing file %s: %w", outfile, err)
+	}
+	if err = f.Close(); err != nil {
+		return fmt.Errorf("error closing file %s: %w", outfile, err)
+	}
+	log.Printf("[INFO] post file %s created", outfile)
+
+	// Open the post file in text editor if specified
+	if req.Editor != "" {
+		args := append(strings.Fields(req.Editor), outfile)
+		if err = exec.Command(args[0], args[1:]...).Start(); err != nil { //nolint:gosec
+			return fmt.Errorf("error opening file in editor %q: %w", req.Editor, err)
+		}
+	}
+	return nil
+}
+
+// makeSlug transliterates russian title, other letters and digits kept as is, everything else turned to dashes
+func makeSlug(title string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		tr, ok := translitTable[r]
+		switch {
+		case ok:
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			tr = string(r)
+		default:
+			dash = sb.Len() > 0
+			continue
+		}
+		if tr == "" {
+			continue
+		}
+		if dash {
+			sb.WriteByte('-')
+			dash = false
+		}
+		sb.WriteString(tr)
+	}
+	return sb.String()
+}
+
+// checkSlugCollision fails if the post file exists or any post has the same slug set in front matter
+func checkSlugCollision(location, slug string) error {
+	file := filepath.Join(location, slug+".md")
+	if _, err := os.Stat(file); err == nil {
+		return fmt.Errorf("post %s already exists", file)
+	}
+	posts, err := loadPosts(location)
+	if err != nil {
+		return fmt.Errorf("error loading posts: %w", err)
+	}
+	for _, p := range posts {
+		if p.Slug == slug || tomlString(p.Params, "slug") == slug {
+			return fmt.Errorf("slug %s already used by %s", slug, p.Path)
+		}
+	}
+	return nil
+}
+
+// youTubeID returns video id for youtube links, empty string for other links
+func youTubeID(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || link == "" {
+		return ""
+	}
+	switch strings.TrimPrefix(u.Hostname(), "www.") {
+	case "youtube.com", "m.youtube.com":
+		if id := u.Query().Get("v"); id != "" {
+			return id
+		}
+		if rest, ok := strings.CutPrefix(u.Path, "/embed/"); ok {
+			return rest
+		}
+	case "youtu.be":
+		return strings.TrimPrefix(u.Path, "/")
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPostCmd(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2023, 4, 7, 14, 40, 46, 0, time.UTC) }
+	defer func() { nowFn = time.Now }()
+	dir := copyTestPosts(t)
+
+	req := NewPost{Title: `Мы переехали "снова"`, Category: "others", PostsLocation: dir,
+		Audio: "https://archive.rucast.net/uwp/media/moved.mp3"}
+	require.NoError(t, newPostCmd(req))
+	data, err := os.ReadFile(filepath.Join(dir, "my-pereekhali-snova.md"))
+	require.NoError(t, err)
+	assert.Equal(t, `+++
+title = "Мы переехали \"снова\""
+date = "2023-04-07T14:40:46"
+categories = ["others"]
++++
+
+.
+
+[аудио](https://archive.rucast.net/uwp/media/moved.mp3)
+<audio src="https://archive.rucast.net/uwp/media/moved.mp3" preload="none"></audio>
+`, string(data))
+	post, err := readPost(filepath.Join(dir, "my-pereekhali-snova.md"))
+	require.NoError(t, err)
+	assert.Equal(t, `Мы переехали "снова"`, post.Title)
+
+	err = newPostCmd(req)
+	assert.EqualError(t, err, "post "+filepath.Join(dir, "my-pereekhali-snova.md")+" already exists")
+
+	req = NewPost{Title: "Животные для поглаживания", Category: "video", PostsLocation: dir,
+		Video: "https://www.youtube.com/watch?v=XbwdRcZkx4M"}
+	require.NoError(t, newPostCmd(req))
+	data, err = os.ReadFile(filepath.Join(dir, "zhivotnye-dlia-poglazhivaniia.md"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "categories = [\"video\"]\n+++\n\n.\n\n"+
+		`<iframe width="640" height="360" src="https://www.youtube.com/embed/XbwdRcZkx4M" frameborder="0" allowfullscreen></iframe>`+"\n")
+
+	// slug set in front matter of other post
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "old.md"),
+		[]byte("+++\ntitle = \"old\"\ndate = \"2012-08-25T00:51:00\"\nslug = \"pereezd\"\n+++\n"), 0o600))
+	err = newPostCmd(NewPost{Title: "Переезд", Category: "others", PostsLocation: dir})
+	assert.EqualError(t, err, "slug pereezd already used by "+filepath.Join(dir, "old.md"))
+
+	err = newPostCmd(NewPost{Title: "!!!", Category: "others", PostsLocation: dir})
+	assert.EqualError(t, err, `can't make slug from title "!!!", set it with --slug`)
+}
+
+func TestMakeSlug(t *testing.T) {
+	tbl := []struct{ title, slug string }{
+		{"Переезд", "pereezd"},
+		{"Дима в гостях", "dima-v-gostiakh"},
+		{"Щедрый подъезд, ёжик и объём", "shchedryi-podieezd-ezhik-i-obieem"},
+		{"Итоги 2023 года: Go & Rust!", "itogi-2023-goda-go-rust"},
+		{"  Цирк — с конями…  ", "tsirk-s-koniami"},
+		{"Мышь", "mysh"},
+		{"ü ø", ""},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.slug, makeSlug(tt.title), tt.title)
+	}
+}
+
+func TestYouTubeID(t *testing.T) {
+	tbl := []struct{ link, id string }{
+		{"https://www.youtube.com/watch?v=XbwdRcZkx4M", "XbwdRcZkx4M"},
+		{"https://youtu.be/XbwdRcZkx4M", "XbwdRcZkx4M"},
+		{"https://www.youtube.com/embed/XbwdRcZkx4M", "XbwdRcZkx4M"},
+		{"https://archive.rucast.net/uwp/media/video.mp4", ""},
+		{"", ""},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.id, youTubeID(tt.link), tt.link)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// opmlFile is the name of opml file with all feeds in the output directory
+const opmlFile = "feeds.opml"
+
+type opmlDoc struct {
+	XMLName xml.Name    `xml:"opml"`
+	Version string      `xml:"version,attr"`
+	Head    opmlHead    `xml:"head"`
+	Body    []opmlEntry `xml:"body>outline"`
+}
+
+type opmlHead struct {
+	Title        string `xml:"title"`
+	DateModified string `xml:"dateModified"`
+	OwnerName    string `xml:"ownerName"`
+	OwnerEmail   string `xml:"ownerEmail"`
+}
+
+type opmlEntry struct {
+	Type        string `xml:"type,attr"`
+	Text        string `xml:"text,attr"`
+	Title       string `xml:"title,attr"`
+	Description string `xml:"description,attr,omitempty"`
+	XMLURL      string `xml:"xmlUrl,attr"`
+	HTMLURL     string `xml:"htmlUrl,attr"`
+}
+
+// writeOPML writes opml document listing all rss feeds
+func writeOPML(file string, site siteConfig, specs []feedSpec) error {
+	doc := opmlDoc{
+		Version: "2.0",
+		Head: opmlHead{Title: site.Title, DateModified: nowFn().In(siteTZ).Format(time.RFC1123Z),
+			OwnerName: site.Author, OwnerEmail: site.Email},
+	}
+	for _, spec := range specs {
+		doc.Body = append(doc.Body, opmlEntry{Type: "rss", Text: spec.Title, Title: spec.Title,
+			Description: spec.Description, XMLURL: site.BaseURL + spec.File, HTMLURL: site.BaseURL})
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling opml %s: %w", file, err)
+	}
+	return writeFileAtomic(file, append([]byte(xml.Header), data...))
+}
+
+// feeds page section markers, only the section between them is generated
+const (
+	feedsPageBegin = "<!-- feeds:begin, generated by uwp-publisher feed --feeds-page, do not edit -->"
+	feedsPageEnd   = "<!-- feeds:end -->"
+)
+
+// writeFeedsPage updates the list of feeds in hugo page between section markers, the rest of the page
+// is hand-written and kept as is. The section is appended to the page without markers, new page is created
+// if missing.
+func writeFeedsPage(file string, site siteConfig, specs []feedSpec) error {
+	var sb strings.Builder
+	sb.WriteString(feedsPageBegin + "\n\n")
+	for _, spec := range specs {
+		sb.WriteString(fmt.Sprintf("- [%s](%s%s) - %s\n", spec.File, site.BaseURL, spec.File, spec.Description))
+	}
+	sb.WriteString(fmt.Sprintf("- [%s](%s%s) - JSON Feed\n", jsonFeedFile, site.BaseURL, jsonFeedFile))
+	sb.WriteString(fmt.Sprintf("\nВсе фиды одним файлом для импорта: [%s](%s%s)\n\n", opmlFile, site.BaseURL, opmlFile))
+	sb.WriteString(feedsPageEnd)
+	section := sb.String()
+
+	page := "+++\ntitle = \"Фиды\"\n+++\n\n" + section + "\n"
+	data, err := os.ReadFile(file) //nolint:gosec
+	switch {
+	case err != nil && !os.IsNotExist(err):
+		return fmt.Errorf("can't read feeds page %s: %w", file, err)
+	case err == nil:
+		content := string(data)
+		begin, end := strings.Index(content, feedsPageBegin), strings.Index(content, feedsPageEnd)
+		switch {
+		case begin >= 0 && end > begin:
+			page = content[:begin] + section + content[end+len(feedsPageEnd):]
+		case begin >= 0 || end >= 0:
+			return fmt.Errorf("feeds page %s has unpaired section markers", file)
+		default:
+			page = strings.TrimRight(content, "\n") + "\n\n" + section + "\n"
+		}
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return fmt.Errorf("error creating dir for %s: %w", file, err)
+	}
+	return writeFileAtomic(file, []byte(page))
+}
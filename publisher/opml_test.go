@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteOPML(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2023, 4, 7, 14, 40, 46, 0, time.UTC) }
+	defer func() { nowFn = time.Now }()
+
+	site, err := loadSiteConfig("testdata/hugo/config.toml")
+	require.NoError(t, err)
+	specs := Feed{Size: 20, ShortArchiveSize: 100}.specs(site)
+	file := filepath.Join(t.TempDir(), opmlFile)
+	require.NoError(t, writeOPML(file, site, specs))
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "<dateModified>Fri, 07 Apr 2023 09:40:46 -0500</dateModified>")
+	assert.Contains(t, string(data), `<outline type="rss" text="Еженедельный подкаст от Umputun" `+
+		`title="Еженедельный подкаст от Umputun" description="основной фид" `+
+		`xmlUrl="https://podcast.umputun.com/podcast.rss" htmlUrl="https://podcast.umputun.com/"></outline>`)
+	assert.Contains(t, string(data), `xmlUrl="https://podcast.umputun.com/podcast-archives-short.rss"`)
+}
+
+func TestWriteFeedsPage(t *testing.T) {
+	site, err := loadSiteConfig("testdata/hugo/config.toml")
+	require.NoError(t, err)
+	specs := Feed{}.specs(site)
+	file := filepath.Join(t.TempDir(), "pages", "feeds.md")
+
+	require.NoError(t, writeFeedsPage(file, site, specs))
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "+++\ntitle = \"Фиды\"\n+++\n\n"+feedsPageBegin+"\n"))
+	assert.Contains(t, string(data), "- [podcast.rss](https://podcast.umputun.com/podcast.rss) - основной фид\n")
+
+	// hand-written content around the section is kept
+	page := "+++\ntitle = \"RSS\"\n+++\n\nПодписка:\n\n- [iTunes](https://podcasts.apple.com/)\n\n" +
+		feedsPageBegin + "\nold list\n" + feedsPageEnd + "\n\nПрочие фиды:\n\n- [Telegram](https://t.me/uwp_podcast)\n"
+	require.NoError(t, os.WriteFile(file, []byte(page), 0o600))
+	require.NoError(t, writeFeedsPage(file, site, specs))
+	data, err = os.ReadFile(file)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "+++\ntitle = \"RSS\"\n+++\n\nПодписка:\n\n- [iTunes](https://podcasts.apple.com/)\n\n"+
+		feedsPageBegin+"\n\n- [podcast.rss]"))
+	assert.True(t, strings.HasSuffix(string(data), "[feeds.opml](https://podcast.umputun.com/feeds.opml)\n\n"+
+		feedsPageEnd+"\n\nПрочие фиды:\n\n- [Telegram](https://t.me/uwp_podcast)\n"))
+	assert.NotContains(t, string(data), "old list")
+
+	// section appended to the page without markers
+	require.NoError(t, os.WriteFile(file, []byte("+++\ntitle = \"RSS\"\n+++\n\n- [Telegram](https://t.me/uwp_podcast)\n"), 0o600))
+	require.NoError(t, writeFeedsPage(file, site, specs))
+	data, err = os.ReadFile(file)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "+++\ntitle = \"RSS\"\n+++\n\n- [Telegram](https://t.me/uwp_podcast)\n\n"+feedsPageBegin))
+	assert.True(t, strings.HasSuffix(string(data), feedsPageEnd+"\n"))
+
+	require.NoError(t, os.WriteFile(file, []byte("+++\ntitle = \"RSS\"\n+++\n"+feedsPageEnd+"\n"), 0o600))
+	assert.Error(t, writeFeedsPage(file, site, specs), "end marker without begin")
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // posts are in America/Chicago, container may have no zoneinfo
+)
+
+// Post is a single hugo post with parsed front matter
+type Post struct {
+	Path       string // full path to the md file
+	Slug       string // file name without extension
+	Title      string
+	Date       time.Time
+	Categories []string
+	Image      string
+	Filename   string // media file name without extension, i.e. ump_podcast123
+	Number     int    // episode number extracted from Filename, 0 if not an episode
+	Draft      bool
+	Topics     []string               // plain text of top level list items in the body
+	Body       string                 // markdown content after front matter
+	Params     map[string]interface{} // all front matter values, including known ones
+}
+
+// siteTZ is the time zone of post dates, those are written without offset
+var siteTZ = mustLoadLocation("America/Chicago")
+
+var reEpisodeFile = regexp.MustCompile(`ump_podcast(\d+)`)
+
+// postDateFormats lists date formats found in front matter of the posts
+var postDateFormats = []string{"2006-01-02T15:04:05", time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// loadPosts reads all md files in the directory and returns posts sorted by date, newest first
+func loadPosts(location string) ([]Post, error) {
+	files, err := filepath.Glob(filepath.Join(location, "*.md"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing posts in %s: %w", location, err)
+	}
+
+	res := make([]Post, 0, len(files))
+	for _, f := range files {
+		p, err := readPost(f)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, p)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Date.After(res[j].Date) })
+	return res, nil
+}
+
+// readPost reads and parses a single post file
+func readPost(file string) (Post, error) {
+	data, err := os.ReadFile(file) //nolint:gosec
+	if err != nil {
+		return Post{}, fmt.Errorf("error reading post %s: %w", file, err)
+	}
+	p, err := parsePost(string(data))
+	if err != nil {
+		return Post{}, fmt.Errorf("error parsing post %s: %w", file, err)
+	}
+	p.Path = file
+	p.Slug = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	return p, nil
+}
+
+// parsePost parses post content with toml front matter delimited by +++
+func parsePost(content string) (Post, error) {
+	fm, body, err := splitFrontMatter(content)
+	if err != nil {
+		return Post{}, err
+	}
+
+	params, err := parseTOML(fm)
+	if err != nil {
+		return Post{}, fmt.Errorf("invalid front matter: %w", err)
+	}
+
+	p := Post{
+		Title:      tomlString(params, "title"),
+		Categories: tomlStrings(params, "categories"),
+		Image:      tomlString(params, "image"),
+		Filename:   tomlString(params, "filename"),
+		Topics:     postTopics(body),
+		Body:       body,
+		Params:     params,
+	}
+	if draft, ok := params["draft"].(bool); ok {
+		p.Draft = draft
+	}
+
+	if p.Date, err = parsePostDate(tomlString(params, "date")); err != nil {
+		return Post{}, err
+	}
+
+	if m := reEpisodeFile.FindStringSubmatch(p.Filename); len(m) > 1 {
+		p.Number, _ = strconv.Atoi(m[1]) // regex guarantees digits
+	}
+	return p, nil
+}
+
+// postTopics returns plain text of the list items, without markdown, images and chapter timestamps.
+// Placeholders like "- ." left by the episode template are skipped.
+func postTopics(body string) []string {
+	var res []string
+	for _, line := range strings.Split(body, "\n") {
+		loc := reMdList.FindStringIndex(line)
+		if loc == nil || len(line)-len(strings.TrimLeft(line, " \t")) > 1 {
+			continue // not a list item or nested one
+		}
+		if m := reChapterTopic.FindStringSubmatch(line); m != nil {
+			line = m[2]
+		} else {
+			line = line[loc[1]:]
+		}
+		line = reMdImage.ReplaceAllString(line, "")
+		line = strings.TrimSpace(reMdBold.ReplaceAllString(reMdLink.ReplaceAllString(line, "$1"), "$1"))
+		if strings.Trim(line, ".") == "" {
+			continue
+		}
+		res = append(res, line)
+	}
+	return res
+}
+
+// splitFrontMatter separates toml front matter from the post body
+func splitFrontMatter(content string) (frontMatter, body string, err error) {
+	content = strings.TrimPrefix(strings.ReplaceAll(content, "\r\n", "\n"), "\ufeff")
+	content = strings.TrimLeft(content, " \t\n") // hugo allows blank lines before front matter
+	if !strings.HasPrefix(content, "+++\n") {
+		return "", "", fmt.Errorf("no front matter found")
+	}
+	end := strings.Index(content[4:], "\n+++")
+	if end < 0 {
+		return "", "", fmt.Errorf("front matter is not terminated")
+	}
+	frontMatter = content[4 : 4+end+1]
+	body = strings.TrimPrefix(content[4+end+4:], "\n")
+	return frontMatter, body, nil
+}
+
+// parsePostDate parses date from front matter, dates without offset are in siteTZ
+func parsePostDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, fmt.Errorf("missing date")
+	}
+	for _, layout := range postDateFormats {
+		if t, err := time.ParseInLocation(layout, s, siteTZ); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+// HasCategory checks if post has the category
+func (p Post) HasCategory(cat string) bool {
+	for _, c := range p.Categories {
+		if strings.EqualFold(c, cat) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEpisode checks if post is a podcast episode with audio file
+func (p Post) IsEpisode() bool {
+	return p.Number > 0 && !p.Draft
+}
+
+// Permalink makes post url the way hugo does, for patterns like "/p/:year/:month/:day/:filename".
+// Pages are rendered to index.html, hugo adds trailing slash to such urls.
+func (p Post) Permalink(baseURL, pattern string) string {
+	slug := p.Slug
+	if s := tomlString(p.Params, "slug"); s != "" {
+		slug = s
+	}
+	r := strings.NewReplacer(
+		":year", p.Date.Format("2006"), ":month", p.Date.Format("01"), ":day", p.Date.Format("02"),
+		":slug", slug, ":filename", p.Slug, ":section", "posts",
+	)
+	path := strings.TrimSuffix(strings.TrimPrefix(r.Replace(pattern), "/"), "/") + "/"
+	return strings.TrimSuffix(baseURL, "/") + "/" + path
+}
+
+var (
+	reMdImage = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	reMdLink  = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	reMdBold  = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	reMdList  = regexp.MustCompile(`^\s*[-*+]\s+`)
+)
+
+// renderMarkdown converts the limited markdown used by posts (paragraphs, lists, links, images
+// and raw html) to html. It is not a general markdown renderer.
+func renderMarkdown(md string) string {
+	var sb strings.Builder
+	inList := false
+	var para []string
+
+	flushPara := func() {
+		if len(para) > 0 {
+			sb.WriteString("<p>" + strings.Join(para, "\n") + "</p>\n")
+			para = nil
+		}
+	}
+	closeList := func() {
+		if inList {
+			sb.WriteString("</ul>\n")
+			inList = false
+		}
+	}
+
+	for _, line := range strings.Split(md, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flushPara()
+			closeList()
+		case reMdList.MatchString(line):
+			flushPara()
+			if !inList {
+				sb.WriteString("<ul>\n")
+				inList = true
+			}
+			sb.WriteString("<li>" + renderMarkdownInline(reMdList.ReplaceAllString(line, "")) + "</li>\n")
+		case strings.HasPrefix(trimmed, "<"):
+			flushPara()
+			closeList()
+			sb.WriteString(trimmed + "\n")
+		default:
+			closeList()
+			para = append(para, renderMarkdownInline(trimmed))
+		}
+	}
+	flushPara()
+	closeList()
+	return sb.String()
+}
+
+// renderMarkdownInline handles images, links and bold text in a single line
+func renderMarkdownInline(s string) string {
+	s = html.EscapeString(s)
+	s = reMdImage.ReplaceAllString(s, `<img src="$2" alt="$1">`)
+	s = reMdLink.ReplaceAllString(s, `<a href="$2">$1</a>`)
+	s = reMdBold.ReplaceAllString(s, `<strong>$1</strong>`)
+	return s
+}
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(fmt.Sprintf("can't load location %s: %v", name, err))
+	}
+	return loc
+}
+
+// setFrontMatterValue sets top level front matter key of the post content to the value, string or []string.
+// The existing key is replaced in place, a new one is added to the end of top level keys.
+func setFrontMatterValue(content, key string, value interface{}) (string, error) {
+	fm, body, err := splitFrontMatter(content)
+	if err != nil {
+		return "", err
+	}
+
+	var line string
+	switch v := value.(type) {
+	case string:
+		line = fmt.Sprintf("%s = %s", key, tomlQuote(v))
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = tomlQuote(s)
+		}
+		line = fmt.Sprintf("%s = [%s]", key, strings.Join(quoted, ", "))
+	default:
+		return "", fmt.Errorf("unsupported front matter value type %T", value)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(fm, "\n"), "\n")
+	res := make([]string, 0, len(lines)+1)
+	tableAt, replaced := -1, false // tableAt is the position of the first table, keys after it are not top level
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if tableAt < 0 && strings.HasPrefix(trimmed, "[") { // keys can't start with "[", so it is a table header
+			tableAt = len(res)
+		}
+		eq := strings.Index(trimmed, "=")
+		if tableAt < 0 && eq > 0 && strings.Trim(strings.TrimSpace(trimmed[:eq]), `"`) == key {
+			// skip continuation lines of multi-line array
+			for raw := strings.TrimSpace(trimmed[eq+1:]); strings.HasPrefix(raw, "[") && !tomlBalanced(raw) && i+1 < len(lines); {
+				i++
+				raw += lines[i]
+			}
+			res = append(res, line)
+			replaced = true
+			continue
+		}
+		res = append(res, lines[i])
+	}
+	if !replaced {
+		if tableAt < 0 {
+			tableAt = len(res)
+		}
+		res = append(res[:tableAt], append([]string{line}, res[tableAt:]...)...)
+	}
+	newFm := strings.Join(res, "\n") + "\n"
+	if _, err := parseTOML(newFm); err != nil {
+		return "", fmt.Errorf("can't set front matter key %q: %w", key, err)
+	}
+	return "+++\n" + newFm + "+++\n" + body, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPosts(t *testing.T) {
+	posts, err := loadPosts("testdata/hugo/content/posts")
+	require.NoError(t, err)
+	require.Len(t, posts, 3)
+
+	assert.Equal(t, "podcast-571", posts[0].Slug)
+	assert.Equal(t, 571, posts[0].Number)
+	assert.True(t, posts[0].IsEpisode())
+	assert.Equal(t, time.Date(2023, 4, 1, 14, 10, 5, 0, siteTZ), posts[0].Date)
+	assert.Equal(t, "https://podcast.umputun.com/images/uwp/uwp571.jpg", posts[0].Image)
+	assert.Equal(t, []string{"Облачные счета за месяц", "Электромобили и зима", "Вопросы и ответы"}, posts[0].Topics)
+
+	assert.Equal(t, "we-moved", posts[1].Slug)
+	assert.False(t, posts[1].IsEpisode())
+	assert.True(t, posts[1].HasCategory("others"))
+
+	assert.Equal(t, "podcast-570", posts[2].Slug)
+	assert.Equal(t, "https://podcast.umputun.com/p/2023/03/25/podcast-570/",
+		posts[2].Permalink("https://podcast.umputun.com/", "/p/:year/:month/:day/:slug/"))
+}
+
+func TestParsePostErrors(t *testing.T) {
+	_, err := parsePost("title = \"no front matter\"\n")
+	assert.EqualError(t, err, "no front matter found")
+
+	_, err = parsePost("+++\ntitle = \"blah\"\n")
+	assert.EqualError(t, err, "front matter is not terminated")
+
+	_, err = parsePost("+++\ntitle = \"blah\"\n+++\n")
+	assert.EqualError(t, err, "missing date")
+
+	_, err = parsePost("+++\ntitle = \"blah\"\ndate = \"01/02/2023\"\n+++\n")
+	assert.EqualError(t, err, `invalid date "01/02/2023"`)
+
+	p, err := parsePost("\n+++\ntitle = \"blah\"\ndate = \"2023-01-02T10:00:00\"\n+++\nbody\n")
+	require.NoError(t, err, "blank line before front matter allowed")
+	assert.Equal(t, "body\n", p.Body)
+}
+
+func TestPostTopics(t *testing.T) {
+	body := `![](https://podcast.umputun.com/images/uwp/uwp5.jpg)
+
+- 00:00 [Go](https://go.dev) **не** Rust
+- [12:30] Облачные счета ![](https://example.com/x.jpg)
+  - вложенный пункт
+* Вопросы и ответы
+- .
+
+просто текст
+`
+	assert.Equal(t, []string{"Go не Rust", "Облачные счета", "Вопросы и ответы"}, postTopics(body))
+	assert.Empty(t, postTopics("no list\n"))
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	md := `![](https://example.com/uwp1.jpg)
+
+- topic **one**
+- [link](https://example.com/x?a=1&b=2)
+
+first line
+second line
+
+<audio src="https://example.com/1.mp3" preload="none"></audio>
+`
+	exp := `<p><img src="https://example.com/uwp1.jpg" alt=""></p>
+<ul>
+<li>topic <strong>one</strong></li>
+<li><a href="https://example.com/x?a=1&amp;b=2">link</a></li>
+</ul>
+<p>first line
+second line</p>
+<audio src="https://example.com/1.mp3" preload="none"></audio>
+`
+	assert.Equal(t, exp, renderMarkdown(md))
+}
+
+func TestSetFrontMatterValue(t *testing.T) {
+	content := "+++\ntitle = \"UWP - Выпуск 5\"\ntags = [\n  \"a\",\n  \"b\",\n]\n\n[params]\n  chapters = \"x\"\n+++\n\nbody\n"
+
+	res, err := setFrontMatterValue(content, "chapters", "https://podcast.umputun.com/media/chapters5.json")
+	require.NoError(t, err)
+	assert.Equal(t, "+++\ntitle = \"UWP - Выпуск 5\"\ntags = [\n  \"a\",\n  \"b\",\n]\n\n"+
+		"chapters = \"https://podcast.umputun.com/media/chapters5.json\"\n[params]\n  chapters = \"x\"\n+++\n\nbody\n", res)
+
+	res, err = setFrontMatterValue(res, "tags", []string{"c"})
+	require.NoError(t, err)
+	assert.Equal(t, "+++\ntitle = \"UWP - Выпуск 5\"\ntags = [\"c\"]\n\n"+
+		"chapters = \"https://podcast.umputun.com/media/chapters5.json\"\n[params]\n  chapters = \"x\"\n+++\n\nbody\n", res)
+
+	res, err = setFrontMatterValue(res, "date", "2023-01-01")
+	require.NoError(t, err)
+	p, err := parsePost(res)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, tomlStrings(p.Params, "tags"))
+
+	_, err = setFrontMatterValue(res, "weight", 1)
+	assert.EqualError(t, err, "unsupported front matter value type int")
+
+	res, err = setFrontMatterValue("+++\ntitle = \"t\"\n[\"a = b\"]\n  k = 1\n+++\nbody\n", "slug", "s")
+	require.NoError(t, err)
+	assert.Equal(t, "+++\ntitle = \"t\"\nslug = \"s\"\n[\"a = b\"]\n  k = 1\n+++\nbody\n", res)
+}
+
+// copyTestPosts copies test posts to temp directory, for tests modifying posts
+func copyTestPosts(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files, err := filepath.Glob("testdata/hugo/content/posts/*.md")
+	require.NoError(t, err)
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, filepath.Base(f)), data, 0o600))
+	}
+	return dir
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Rollback lists site builds and switches current symlink back to one of them. Optionally reverts
+// commits made after the build and pushes the revert, so the next build from repo doesn't bring them back.
+type Rollback struct {
+	Builds string `long:"builds" default:"/srv/podcast-uwp/var/site" description:"site builds directory"`
+	Lock   string `long:"lock" default:"/srv/podcast-uwp/var/build.lock" description:"build lock file"`
+	List   bool   `long:"list" description:"list builds only"`
+	Revert bool   `long:"revert" description:"git revert commits made after the build"`
+	Push   bool   `long:"push" description:"push the revert"`
+	Repo   string `long:"repo" default:"/srv/podcast-uwp" description:"site git repo"`
+	Remote string `long:"remote" default:"origin" description:"git remote"`
+	Branch string `long:"branch" default:"master" description:"git branch"`
+	Args   struct {
+		Build string `positional-arg-name:"build" description:"build id, the previous build by default"`
+	} `positional-args:"yes"`
+}
+
+// rollbackCmd lists builds or switches to the requested one under the build lock
+func rollbackCmd(req Rollback) error {
+	if req.List {
+		builds, err := listBuilds(req.Builds)
+		if err != nil {
+			return err
+		}
+		return writeBuilds(os.Stdout, builds)
+	}
+	unlock, err := acquireLock(req.Lock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return rollback(context.Background(), req, shellRunner)
+}
+
+// rollback switches current build to the requested one, or to the one before current.
+// With revert, commits from the build commit to the current build commit reverted in repo, see revertCommands.
+func rollback(ctx context.Context, req Rollback, run cmdRunner) error {
+	builds, err := listBuilds(req.Builds)
+	if err != nil {
+		return err
+	}
+	var current, target *siteBuild
+	for i := range builds {
+		if builds[i].Current {
+			current = &builds[i]
+			if req.Args.Build == "" && i+1 < len(builds) {
+				target = &builds[i+1]
+			}
+		}
+		if req.Args.Build != "" && builds[i].ID == req.Args.Build {
+			target = &builds[i]
+		}
+	}
+	switch {
+	case req.Args.Build != "" && target == nil:
+		return fmt.Errorf("build %s not found in %s", req.Args.Build, req.Builds)
+	case target == nil:
+		return fmt.Errorf("no build before the current one in %s", req.Builds)
+	case current != nil && current.ID == target.ID:
+		return fmt.Errorf("build %s is current already", target.ID)
+	}
+
+	// commits to revert checked before the switch, the site isn't rolled back if revert is impossible
+	var reverts []string
+	if req.Revert {
+		if reverts, err = revertCommands(ctx, req, run, target.Commit, current); err != nil {
+			return err
+		}
+	}
+
+	if err = switchBuild(req.Builds, target.ID); err != nil {
+		return err
+	}
+	log.Printf("[INFO] switched to build %s of %s, %d episodes, %d feed items", target.ID, shortCommit(target.Commit),
+		target.Episodes, target.FeedItems)
+
+	if len(reverts) == 0 {
+		return nil
+	}
+	// revert on top of the remote branch, local repo may be behind it and push of the revert would be rejected
+	steps := []string{
+		fmt.Sprintf("git fetch %s %s", req.Remote, req.Branch),
+		fmt.Sprintf("git merge --ff-only %s/%s", req.Remote, req.Branch),
+	}
+	steps = append(steps, reverts...)
+	if req.Push {
+		steps = append(steps, fmt.Sprintf("git push %s HEAD:%s", req.Remote, req.Branch))
+	}
+	for _, step := range steps {
+		if out, e := run(ctx, req.Repo, step); e != nil {
+			return fmt.Errorf("%s: %v %s", step, e, strings.TrimSpace(out))
+		}
+		log.Printf("[INFO] %s", step)
+	}
+	return nil
+}
+
+// revertCommands returns git revert commands for commits made after the target commit up to the current build,
+// newest first. Only the first-parent history is reverted, merges with -m 1, so changes of a merged branch are
+// reverted once by its merge. The target must be in the first-parent history of the current build commit.
+func revertCommands(ctx context.Context, req Rollback, run cmdRunner, target string, current *siteBuild) ([]string, error) {
+	if current == nil || current.Commit == target || current.Commit == "unknown" || target == "unknown" {
+		log.Printf("[WARN] nothing to revert between builds")
+		return nil, nil
+	}
+	if out, err := run(ctx, req.Repo, fmt.Sprintf("git merge-base --is-ancestor %s %s", target, current.Commit)); err != nil {
+		return nil, fmt.Errorf("can't revert, commit %s of the build is not an ancestor of current %s, "+
+			"rollback to a newer build can't be reverted: %s", shortCommit(target), shortCommit(current.Commit),
+			strings.TrimSpace(fmt.Sprintf("%v %s", err, out)))
+	}
+	out, err := run(ctx, req.Repo, fmt.Sprintf("git rev-list --first-parent --parents %s..%s", target, current.Commit))
+	if err != nil {
+		return nil, fmt.Errorf("can't list commits to revert: %v %s", err, strings.TrimSpace(out))
+	}
+	res, parent := []string{}, ""
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Fields(line) // commit and its parents
+		if len(fields) < 2 {
+			continue
+		}
+		if len(fields) > 2 {
+			res = append(res, fmt.Sprintf("git revert --no-edit -m 1 %s", fields[0]))
+		} else {
+			res = append(res, fmt.Sprintf("git revert --no-edit %s", fields[0]))
+		}
+		parent = fields[1]
+	}
+	if parent != target {
+		return nil, fmt.Errorf("can't revert, commit %s of the build is not in the first-parent history of current %s, "+
+			"revert merged commits manually", shortCommit(target), shortCommit(current.Commit))
+	}
+	return res, nil
+}
+
+// writeBuilds prints builds table, the current one marked by *
+func writeBuilds(w io.Writer, builds []siteBuild) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, " \tBUILD\tCOMMIT\tTIME\tEPISODES\tFEED ITEMS") //nolint:errcheck
+	for _, b := range builds {
+		mark := ""
+		if b.Current {
+			mark = "*"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\n", mark, b.ID, shortCommit(b.Commit), //nolint:errcheck
+			b.Time.In(siteTZ).Format("2006-01-02 15:04:05"), b.Episodes, b.FeedItems)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeTestBuilds(t *testing.T, current string) string {
+	dir := t.TempDir()
+	for i, commit := range []string{"aaaaaaaaaa", "bbbbbbbbbb", "cccccccccc"} {
+		b := siteBuild{Commit: commit, Time: time.Date(2023, 4, 10+i, 12, 0, 0, 0, siteTZ), Episodes: 570 + i, FeedItems: 20}
+		b.ID = b.Time.Format("20060102-150405") + "-" + shortCommit(commit)
+		data, err := json.Marshal(b)
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, b.ID), 0o700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, b.ID, buildManifest), data, 0o600))
+	}
+	require.NoError(t, switchBuild(dir, current))
+	return dir
+}
+
+// gitStub is a cmdRunner answering rev-list with the commit lines of the range, other commands succeed
+func gitStub(commands *[]string, revList map[string]string) cmdRunner {
+	return func(_ context.Context, _, command string) (string, error) {
+		*commands = append(*commands, command)
+		if strings.HasPrefix(command, "git rev-list") {
+			fields := strings.Fields(command)
+			return revList[fields[len(fields)-1]], nil
+		}
+		return "", nil
+	}
+}
+
+func TestRollback(t *testing.T) {
+	dir := makeTestBuilds(t, "20230412-120000-ccccccc")
+	var commands []string
+	stub := gitStub(&commands, map[string]string{"bbbbbbbbbb..cccccccccc": "cccccccccc 1111111111\n1111111111 bbbbbbbbbb\n",
+		"aaaaaaaaaa..bbbbbbbbbb": "bbbbbbbbbb aaaaaaaaaa\n"})
+	run := func(ctx context.Context, repo, command string) (string, error) {
+		assert.Equal(t, "/srv/repo", repo)
+		return stub(ctx, repo, command)
+	}
+	req := Rollback{Builds: dir, Repo: "/srv/repo", Remote: "origin", Branch: "master", Revert: true, Push: true}
+
+	require.NoError(t, rollback(context.Background(), req, run))
+	current, err := os.Readlink(filepath.Join(dir, siteCurrent))
+	require.NoError(t, err)
+	assert.Equal(t, "20230411-120000-bbbbbbb", current, "previous build by default")
+	assert.Equal(t, []string{"git merge-base --is-ancestor bbbbbbbbbb cccccccccc",
+		"git rev-list --first-parent --parents bbbbbbbbbb..cccccccccc", "git fetch origin master",
+		"git merge --ff-only origin/master", "git revert --no-edit cccccccccc", "git revert --no-edit 1111111111",
+		"git push origin HEAD:master"}, commands)
+
+	commands = nil
+	req.Args.Build, req.Push = "20230410-120000-aaaaaaa", false
+	require.NoError(t, rollback(context.Background(), req, run))
+	current, err = os.Readlink(filepath.Join(dir, siteCurrent))
+	require.NoError(t, err)
+	assert.Equal(t, "20230410-120000-aaaaaaa", current)
+	assert.Equal(t, []string{"git merge-base --is-ancestor aaaaaaaaaa bbbbbbbbbb",
+		"git rev-list --first-parent --parents aaaaaaaaaa..bbbbbbbbbb", "git fetch origin master",
+		"git merge --ff-only origin/master", "git revert --no-edit bbbbbbbbbb"}, commands)
+
+	assert.EqualError(t, rollback(context.Background(), req, run), "build 20230410-120000-aaaaaaa is current already")
+	req.Args.Build = ""
+	assert.EqualError(t, rollback(context.Background(), req, run), "no build before the current one in "+dir)
+	req.Args.Build = "20230101-000000-fffffff"
+	assert.EqualError(t, rollback(context.Background(), req, run), "build 20230101-000000-fffffff not found in "+dir)
+}
+
+func TestRollbackRevertMerges(t *testing.T) {
+	dir := makeTestBuilds(t, "20230412-120000-ccccccc")
+	var commands []string
+	// merge of a branch with 2222222222 and 3333333333, branch commits are not in the first-parent history
+	run := gitStub(&commands, map[string]string{
+		"bbbbbbbbbb..cccccccccc": "cccccccccc 1111111111\n1111111111 bbbbbbbbbb 3333333333\n",
+		"aaaaaaaaaa..cccccccccc": "cccccccccc 1111111111\n1111111111 4444444444 3333333333\n",
+	})
+	req := Rollback{Builds: dir, Remote: "origin", Branch: "master", Revert: true}
+	require.NoError(t, rollback(context.Background(), req, run))
+	assert.Equal(t, []string{"git revert --no-edit cccccccccc", "git revert --no-edit -m 1 1111111111"}, commands[4:])
+
+	// build commit in merged branch only
+	require.NoError(t, switchBuild(dir, "20230412-120000-ccccccc"))
+	commands = nil
+	req.Args.Build = "20230410-120000-aaaaaaa"
+	assert.EqualError(t, rollback(context.Background(), req, run), "can't revert, commit aaaaaaa of the build is not "+
+		"in the first-parent history of current ccccccc, revert merged commits manually")
+	current, err := os.Readlink(filepath.Join(dir, siteCurrent))
+	require.NoError(t, err)
+	assert.Equal(t, "20230412-120000-ccccccc", current, "not switched")
+	assert.Len(t, commands, 2, "nothing fetched or reverted")
+}
+
+func TestRollbackRevertFailed(t *testing.T) {
+	dir := makeTestBuilds(t, "20230412-120000-ccccccc")
+	run := func(_ context.Context, _, command string) (string, error) {
+		switch {
+		case strings.HasPrefix(command, "git rev-list"):
+			return "cccccccccc bbbbbbbbbb\n", nil
+		case strings.HasPrefix(command, "git revert"):
+			return "error: could not revert", errors.New("exit status 1")
+		}
+		return "", nil
+	}
+	req := Rollback{Builds: dir, Revert: true, Push: true, Remote: "origin", Branch: "master"}
+	assert.EqualError(t, rollback(context.Background(), req, run),
+		"git revert --no-edit cccccccccc: exit status 1 error: could not revert")
+	current, err := os.Readlink(filepath.Join(dir, siteCurrent))
+	require.NoError(t, err)
+	assert.Equal(t, "20230411-120000-bbbbbbb", current, "site switched anyway")
+
+	// diverged local repo isn't reverted
+	run = func(_ context.Context, _, command string) (string, error) {
+		switch {
+		case strings.HasPrefix(command, "git rev-list"):
+			return "cccccccccc bbbbbbbbbb\n", nil
+		case strings.HasPrefix(command, "git merge --ff-only"):
+			return "fatal: Not possible to fast-forward, aborting.", errors.New("exit status 128")
+		}
+		require.False(t, strings.HasPrefix(command, "git revert"), "revert not expected")
+		return "", nil
+	}
+	req.Args.Build = "20230411-120000-bbbbbbb"
+	require.NoError(t, switchBuild(dir, "20230412-120000-ccccccc"))
+	assert.EqualError(t, rollback(context.Background(), req, run),
+		"git merge --ff-only origin/master: exit status 128 fatal: Not possible to fast-forward, aborting.")
+
+	// rollback to a newer build is refused before the switch
+	run = func(_ context.Context, _, command string) (string, error) {
+		if strings.HasPrefix(command, "git merge-base") {
+			return "", errors.New("exit status 1")
+		}
+		require.Fail(t, "unexpected command", command)
+		return "", nil
+	}
+	require.NoError(t, switchBuild(dir, "20230410-120000-aaaaaaa"))
+	req.Args.Build = "20230412-120000-ccccccc"
+	assert.EqualError(t, rollback(context.Background(), req, run), "can't revert, commit ccccccc of the build is not "+
+		"an ancestor of current aaaaaaa, rollback to a newer build can't be reverted: exit status 1")
+	current, err = os.Readlink(filepath.Join(dir, siteCurrent))
+	require.NoError(t, err)
+	assert.Equal(t, "20230410-120000-aaaaaaa", current, "not switched")
+}
+
+func TestWriteBuilds(t *testing.T) {
+	builds, err := listBuilds(makeTestBuilds(t, "20230411-120000-bbbbbbb"))
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, writeBuilds(&buf, builds))
+	assert.Equal(t, `   BUILD                    COMMIT   TIME                 EPISODES  FEED ITEMS
+   20230412-120000-ccccccc  ccccccc  2023-04-12 12:00:00  572       20
+*  20230411-120000-bbbbbbb  bbbbbbb  2023-04-11 12:00:00  571       20
+   20230410-120000-aaaaaaa  aaaaaaa  2023-04-10 12:00:00  570       20
+`, buf.String())
+}
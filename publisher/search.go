@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Search queries posts titles and topics, with --update writes the search index for client side search
+type Search struct {
+	HugoLocation string `long:"hugo" env:"HUGO_LOCATION" default:"/srv/podcast-uwp/hugo" description:"hugo site location"`
+	Output       string `long:"output" description:"search index file, static/search-index.json in hugo location by default"`
+	Update       bool   `long:"update" description:"write search index for the site"`
+	Limit        int    `long:"limit" default:"20" description:"max number of results"`
+	Args         struct {
+		Query []string `positional-arg-name:"query" description:"words to search"`
+	} `positional-args:"yes"`
+}
+
+// searchIndexFile is the index written to hugo static dir
+const searchIndexFile = "search-index.json"
+
+// searchIndex is an inverted index of stemmed words of post titles and topics. Short json names keep
+// the file small, it is loaded by the site.
+type searchIndex struct {
+	Docs  []searchDoc      `json:"docs"`
+	Terms map[string][]int `json:"terms"` // stem to sorted list of doc positions
+}
+
+// searchDoc is an indexed post
+type searchDoc struct {
+	Num    int      `json:"n,omitempty"`
+	Title  string   `json:"t"`
+	URL    string   `json:"u"`
+	Date   string   `json:"d"`
+	Topics []string `json:"p,omitempty"`
+}
+
+// searchCmd builds index from posts, writes it with --update and prints results of the query
+func searchCmd(req Search) error {
+	if !req.Update && len(req.Args.Query) == 0 {
+		return fmt.Errorf("query or --update required")
+	}
+	site, err := loadSiteConfig(filepath.Join(req.HugoLocation, "config.toml"))
+	if err != nil {
+		return err
+	}
+	posts, err := loadPosts(filepath.Join(req.HugoLocation, "content", "posts"))
+	if err != nil {
+		return fmt.Errorf("error loading posts: %w", err)
+	}
+	idx := makeSearchIndex(posts, site)
+	log.Printf("[DEBUG] search index, %d docs, %d terms", len(idx.Docs), len(idx.Terms))
+
+	if req.Update {
+		output := req.Output
+		if output == "" {
+			output = filepath.Join(req.HugoLocation, "static", searchIndexFile)
+		}
+		if err = writeSearchIndex(output, idx); err != nil {
+			return err
+		}
+		log.Printf("[INFO] search index saved to %s, %d docs, %d terms", output, len(idx.Docs), len(idx.Terms))
+	}
+
+	if len(req.Args.Query) == 0 {
+		return nil
+	}
+	query := strings.Join(req.Args.Query, " ")
+	res := idx.search(query)
+	log.Printf("[INFO] %d posts found for %q", len(res), query)
+	if req.Limit > 0 && len(res) > req.Limit {
+		res = res[:req.Limit]
+	}
+	stems := map[string]bool{}
+	for _, w := range searchTokens(query) {
+		stems[stemRussian(w)] = true
+	}
+	for _, d := range res {
+		fmt.Printf("%s  %s  %s\n", d.Date, d.Title, d.URL)
+		for _, t := range d.Topics {
+			for _, w := range searchTokens(t) {
+				if stems[stemRussian(w)] {
+					fmt.Printf("    - %s\n", t)
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// makeSearchIndex indexes titles and topics of published posts, newest first
+func makeSearchIndex(posts []Post, site siteConfig) searchIndex {
+	res := searchIndex{Docs: []searchDoc{}, Terms: map[string][]int{}}
+	now := nowFn()
+	for _, p := range posts {
+		if p.Draft || p.Date.After(now) {
+			continue
+		}
+		pos := len(res.Docs)
+		res.Docs = append(res.Docs, searchDoc{Num: p.Number, Title: p.Title, Date: p.Date.Format("2006-01-02"),
+			URL: p.Permalink("", site.Permalink), Topics: p.Topics})
+		for _, text := range append([]string{p.Title}, p.Topics...) {
+			for _, w := range searchTokens(text) {
+				stem := stemRussian(w)
+				if docs := res.Terms[stem]; len(docs) == 0 || docs[len(docs)-1] != pos {
+					res.Terms[stem] = append(docs, pos)
+				}
+			}
+		}
+	}
+	return res
+}
+
+// search returns docs containing all words of the query, in index order
+func (idx searchIndex) search(query string) []searchDoc {
+	words := searchTokens(query)
+	if len(words) == 0 {
+		return nil
+	}
+	var found []int
+	for i, w := range words {
+		docs := idx.Terms[stemRussian(w)]
+		if i == 0 {
+			found = docs
+			continue
+		}
+		found = intersectSorted(found, docs)
+	}
+	res := make([]searchDoc, 0, len(found))
+	for _, pos := range found {
+		res = append(res, idx.Docs[pos])
+	}
+	return res
+}
+
+// intersectSorted returns values present in both sorted lists
+func intersectSorted(a, b []int) []int {
+	res := []int{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] == b[j]:
+			res = append(res, a[i])
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	return res
+}
+
+// writeSearchIndex writes compact json index, skips unchanged file
+func writeSearchIndex(file string, idx searchIndex) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("error marshaling search index: %w", err)
+	}
+	if existing, e := os.ReadFile(file); e == nil && bytes.Equal(existing, data) { //nolint:gosec
+		return nil
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return fmt.Errorf("error creating dir for %s: %w", file, err)
+	}
+	return writeFileAtomic(file, data)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchCmd(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2023, 4, 10, 0, 0, 0, 0, time.UTC) }
+	defer func() { nowFn = time.Now }()
+	output := filepath.Join(t.TempDir(), "static", "search-index.json")
+
+	req := Search{HugoLocation: "testdata/hugo", Output: output, Update: true, Limit: 10}
+	req.Args.Query = []string{"электромобили"}
+	out := captureStdout(t, func() { require.NoError(t, searchCmd(req)) })
+	assert.Equal(t, "2023-04-01  UWP - Выпуск 571  /p/2023/04/01/podcast-571/\n    - Электромобили и зима\n", out)
+
+	data, err := os.ReadFile(output) //nolint:gosec
+	require.NoError(t, err)
+	idx := searchIndex{}
+	require.NoError(t, json.Unmarshal(data, &idx))
+	require.Len(t, idx.Docs, 3)
+	assert.Equal(t, searchDoc{Num: 571, Title: "UWP - Выпуск 571", URL: "/p/2023/04/01/podcast-571/", Date: "2023-04-01",
+		Topics: []string{"Облачные счета за месяц", "Электромобили и зима", "Вопросы и ответы"}}, idx.Docs[0])
+	assert.Equal(t, []int{0, 2}, idx.Terms["вопрос"])
+	assert.NotContains(t, idx.Terms, "и", "stop words not indexed")
+
+	req = Search{HugoLocation: "testdata/hugo"}
+	assert.EqualError(t, searchCmd(req), "query or --update required")
+}
+
+func TestSearchIndex_Search(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2023, 4, 10, 0, 0, 0, 0, time.UTC) }
+	defer func() { nowFn = time.Now }()
+	posts, err := loadPosts("testdata/hugo/content/posts")
+	require.NoError(t, err)
+	posts = append(posts, Post{Title: "будущий", Date: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)},
+		Post{Title: "черновик вопросов", Draft: true, Date: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)})
+	idx := makeSearchIndex(posts, siteConfig{Permalink: "/p/:year/:month/:day/:slug/"})
+	require.Len(t, idx.Docs, 3, "draft and future posts not indexed")
+
+	titles := func(docs []searchDoc) []string {
+		res := []string{}
+		for _, d := range docs {
+			res = append(res, d.Title)
+		}
+		return res
+	}
+	assert.Equal(t, []string{"UWP - Выпуск 571", "UWP - Выпуск 570"}, titles(idx.search("вопрос")))
+	assert.Equal(t, []string{"UWP - Выпуск 571"}, titles(idx.search("ВОПРОСЫ и облачный счет")))
+	assert.Equal(t, []string{"UWP - Выпуск 570"}, titles(idx.search("почему go")))
+	assert.Equal(t, []string{"Мы переехали"}, titles(idx.search("переехали")))
+	assert.Empty(t, idx.search("вопрос самолет"))
+	assert.Empty(t, idx.search("и в"))
+}
+
+func TestIntersectSorted(t *testing.T) {
+	assert.Equal(t, []int{2, 5}, intersectSorted([]int{1, 2, 5, 7}, []int{2, 3, 5}))
+	assert.Equal(t, []int{}, intersectSorted(nil, []int{1}))
+}
+
+// TestSearchJS checks the site search script makes the same tokens and stems as the index, on all real posts
+func TestSearchJS(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not installed")
+	}
+	posts, err := loadPosts("../hugo/content/posts")
+	require.NoError(t, err)
+	texts := []string{"Почему Go не Rust, и ЁЖИКИ в 2023?", "важнейшие вдохновенно бежавший"}
+	for _, p := range posts {
+		texts = append(texts, p.Title)
+		texts = append(texts, p.Topics...)
+	}
+	type result struct {
+		Tokens []string `json:"tokens"`
+		Stems  []string `json:"stems"`
+	}
+	expected := make([]result, 0, len(texts))
+	for _, text := range texts {
+		r := result{Tokens: searchTokens(text), Stems: []string{}}
+		for _, w := range r.Tokens {
+			r.Stems = append(r.Stems, stemRussian(w))
+		}
+		expected = append(expected, r)
+	}
+
+	script, err := filepath.Abs("../hugo/static/js/search.js")
+	require.NoError(t, err)
+	input, err := json.Marshal(texts)
+	require.NoError(t, err)
+	cmd := exec.Command(node, "-e", `const s = require(process.argv[1]);
+const texts = JSON.parse(require("fs").readFileSync(0, "utf8"));
+console.log(JSON.stringify(texts.map(t => { const tokens = s.tokens(t); return {tokens, stems: tokens.map(s.stem)}; })));`,
+		script) //nolint:gosec
+	cmd.Stdin = strings.NewReader(string(input))
+	out, err := cmd.Output()
+	require.NoError(t, err)
+	var actual []result
+	require.NoError(t, json.Unmarshal(out, &actual))
+	require.Len(t, actual, len(expected))
+	for i := range expected {
+		if expected[i].Tokens == nil {
+			expected[i].Tokens = []string{}
+		}
+		assert.Equal(t, expected[i], actual[i], texts[i])
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// ServeMedia serves media files behind nginx and records each download to append-only events log.
+// Missing files are redirected to archive, as nginx @archive location does.
+type ServeMedia struct {
+	Listen        string `long:"listen" default:"127.0.0.1:8090" description:"listen address"`
+	MediaLocation string `long:"media-location" default:"/srv/podcast-uwp/var/media" description:"media location"`
+	ArchiveURL    string `long:"archive-url" default:"http://archive.rucast.net/uwp/media/" description:"archive media url, missing files redirected to"`
+	Events        string `long:"events" default:"/srv/podcast-uwp/var/stats/media-events.log" description:"append-only download events log"`
+}
+
+// mediaEvent is a served request of media file, a line of json in events log
+type mediaEvent struct {
+	Time     time.Time `json:"time"`
+	IP       string    `json:"ip"`
+	UA       string    `json:"ua"`
+	File     string    `json:"file"`
+	Status   int       `json:"status"`
+	Range    string    `json:"range,omitempty"`
+	Bytes    int64     `json:"bytes"`              // body bytes actually sent
+	Complete bool      `json:"complete,omitempty"` // whole response body sent, client didn't drop the connection
+}
+
+// mediaServer is http handler of /media/ with events log
+type mediaServer struct {
+	location   string
+	archiveURL string
+
+	mu     sync.Mutex
+	events *os.File
+}
+
+// serveMediaCmd runs media server till SIGTERM or SIGINT
+func serveMediaCmd(req ServeMedia) error {
+	events, err := os.OpenFile(req.Events, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("error opening events log %s: %w", req.Events, err)
+	}
+	defer events.Close() //nolint:errcheck
+
+	ms := &mediaServer{location: req.MediaLocation, archiveURL: req.ArchiveURL, events: events}
+	srv := &http.Server{
+		Addr:              req.Listen,
+		Handler:           ms,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, done := context.WithTimeout(context.Background(), 30*time.Second)
+		defer done()
+		if e := srv.Shutdown(shutdownCtx); e != nil {
+			log.Printf("[WARN] media server shutdown: %v", e)
+		}
+	}()
+
+	log.Printf("[INFO] serving %s on %s, events to %s", req.MediaLocation, req.Listen, req.Events)
+	if err = srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("media server failed: %w", err)
+	}
+	return nil
+}
+
+// ServeHTTP serves /media/<file> with Range, If-Range and conditional requests support of http.ServeContent.
+// ETag made the same way as nginx does, so caches and resumed downloads stay valid after switching from nginx.
+func (ms *mediaServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/media/")
+	if name == r.URL.Path || name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		http.NotFound(w, r)
+		return
+	}
+
+	fh, err := os.Open(filepath.Join(ms.location, name)) //nolint:gosec // name has no path separators
+	if err != nil {
+		if os.IsNotExist(err) && strings.HasSuffix(name, ".mp3") {
+			http.Redirect(w, r, ms.archiveURL+name, http.StatusFound)
+			ms.record(r, name, http.StatusFound, 0, true)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+	defer fh.Close() //nolint:errcheck
+	fi, err := fh.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, fi.ModTime().Unix(), fi.Size()))
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	cw := &countingWriter{ResponseWriter: w, status: http.StatusOK}
+	http.ServeContent(cw, r, name, fi.ModTime(), fh)
+
+	if r.Method == http.MethodGet && (cw.status == http.StatusOK || cw.status == http.StatusPartialContent) {
+		expected := int64(-1)
+		if cl := cw.Header().Get("Content-Length"); cl != "" {
+			_, _ = fmt.Sscan(cl, &expected)
+		}
+		ms.record(r, name, cw.status, cw.bytes, cw.bytes == expected)
+	}
+}
+
+// record appends event to events log, a single write per line keeps lines whole with O_APPEND
+func (ms *mediaServer) record(r *http.Request, name string, status int, size int64, complete bool) {
+	ev := mediaEvent{Time: nowFn(), IP: clientIP(r), UA: r.UserAgent(), File: name, Status: status,
+		Range: r.Header.Get("Range"), Bytes: size, Complete: complete}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("[WARN] can't marshal media event: %v", err)
+		return
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if _, err = ms.events.Write(append(data, '\n')); err != nil {
+		log.Printf("[WARN] can't write media event: %v", err)
+	}
+}
+
+// clientIP returns the client address set by nginx in X-Real-IP or X-Forwarded-For, remote address otherwise
+func clientIP(r *http.Request) string {
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		return strings.TrimSpace(strings.Split(fwd, ",")[0])
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// countingWriter counts body bytes written to the client and keeps response status
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WriteHeader keeps the status
+func (cw *countingWriter) WriteHeader(status int) {
+	cw.status = status
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts bytes actually written, failed write of dropped connection returns the partial count
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.ResponseWriter.Write(p)
+	cw.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom passes the body to ResponseWriter's ReadFrom, http.ServeContent copies the file with it and
+// the server uses sendfile. Falls back to plain copy with Write if ResponseWriter has no ReadFrom.
+func (cw *countingWriter) ReadFrom(r io.Reader) (int64, error) {
+	if rf, ok := cw.ResponseWriter.(io.ReaderFrom); ok {
+		n, err := rf.ReadFrom(r)
+		cw.bytes += n
+		return n, err
+	}
+	return io.Copy(struct{ io.Writer }{cw}, r) // hides ReadFrom of cw, Write counts bytes
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMediaServer(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2023, 4, 10, 12, 0, 0, 0, siteTZ) }
+	defer func() { nowFn = time.Now }()
+
+	dir := t.TempDir()
+	body := strings.Repeat("0123456789", 100)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ump_podcast571.mp3"), []byte(body), 0o600))
+	mtime := time.Date(2023, 4, 8, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "ump_podcast571.mp3"), mtime, mtime))
+	etag := fmt.Sprintf(`"%x-%x"`, mtime.Unix(), len(body))
+
+	events, err := os.OpenFile(filepath.Join(dir, "events.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	defer events.Close()
+	ts := httptest.NewServer(&mediaServer{location: dir, archiveURL: "http://archive.example.com/uwp/media/", events: events})
+	defer ts.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	get := func(path string, headers map[string]string) (*http.Response, string) {
+		req, e := http.NewRequest("GET", ts.URL+path, http.NoBody)
+		require.NoError(t, e)
+		req.Header.Set("User-Agent", "Overcast/3.0")
+		req.Header.Set("X-Real-IP", "1.2.3.4")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, e := client.Do(req)
+		require.NoError(t, e)
+		defer resp.Body.Close()
+		data, e := io.ReadAll(resp.Body)
+		require.NoError(t, e)
+		return resp, string(data)
+	}
+
+	resp, data := get("/media/ump_podcast571.mp3", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, body, data)
+	assert.Equal(t, etag, resp.Header.Get("ETag"))
+	assert.Equal(t, "bytes", resp.Header.Get("Accept-Ranges"))
+	assert.Equal(t, "audio/mpeg", resp.Header.Get("Content-Type"))
+
+	resp, data = get("/media/ump_podcast571.mp3", map[string]string{"Range": "bytes=10-19"})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "0123456789", data)
+	assert.Equal(t, "bytes 10-19/1000", resp.Header.Get("Content-Range"))
+
+	resp, _ = get("/media/ump_podcast571.mp3", map[string]string{"Range": "bytes=10-19", "If-Range": etag})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode, "matching If-Range")
+
+	resp, data = get("/media/ump_podcast571.mp3", map[string]string{"Range": "bytes=10-19", "If-Range": `"other"`})
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "changed file sent whole")
+	assert.Len(t, data, len(body))
+
+	resp, _ = get("/media/ump_podcast571.mp3", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	resp, _ = get("/media/ump_podcast571.mp3", map[string]string{"Range": "bytes=5000-"})
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+
+	resp, _ = get("/media/ump_podcast100.mp3", nil)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "http://archive.example.com/uwp/media/ump_podcast100.mp3", resp.Header.Get("Location"))
+
+	resp, _ = get("/media/missing.jpg", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = get("/media/..%2fevents.log", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = get("/media/.hidden", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	req, err := http.NewRequest("HEAD", ts.URL+"/media/ump_podcast571.mp3", http.NoBody)
+	require.NoError(t, err)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	fh, err := os.Open(filepath.Join(dir, "events.log"))
+	require.NoError(t, err)
+	defer fh.Close()
+	var evs []mediaEvent
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		var ev mediaEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+		assert.True(t, nowFn().Equal(ev.Time))
+		ev.Time = time.Time{}
+		evs = append(evs, ev)
+	}
+	ev := func(status int, rng string, size int64) mediaEvent {
+		return mediaEvent{IP: "1.2.3.4", UA: "Overcast/3.0", File: "ump_podcast571.mp3", Status: status, Range: rng,
+			Bytes: size, Complete: true}
+	}
+	assert.Equal(t, []mediaEvent{
+		ev(200, "", 1000),
+		ev(206, "bytes=10-19", 10),
+		ev(206, "bytes=10-19", 10),
+		ev(200, "bytes=10-19", 1000),
+		{IP: "1.2.3.4", UA: "Overcast/3.0", File: "ump_podcast100.mp3", Status: 302, Complete: true},
+	}, evs, "no events of 304, 416, 404 and HEAD")
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest("GET", "/media/a.mp3", http.NoBody)
+	r.RemoteAddr = "10.0.0.1:1234"
+	assert.Equal(t, "10.0.0.1", clientIP(r))
+	r.Header.Set("X-Forwarded-For", "2.2.2.2, 10.0.0.2")
+	assert.Equal(t, "2.2.2.2", clientIP(r))
+	r.Header.Set("X-Real-IP", "1.1.1.1")
+	assert.Equal(t, "1.1.1.1", clientIP(r))
+}
+
+// readerFromRecorder is ResponseRecorder with ReadFrom, as http server's response has
+type readerFromRecorder struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+func (r *readerFromRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.readFrom = true
+	return io.Copy(r.ResponseRecorder, src)
+}
+
+func TestCountingWriterReadFrom(t *testing.T) {
+	rec := &readerFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	cw := &countingWriter{ResponseWriter: rec, status: http.StatusOK}
+	n, err := io.Copy(cw, io.LimitReader(strings.NewReader("0123456789"), 6))
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), n)
+	assert.Equal(t, int64(6), cw.bytes)
+	assert.True(t, rec.readFrom, "ReadFrom of the response used, sendfile is possible")
+	assert.Equal(t, "012345", rec.Body.String())
+
+	plain := httptest.NewRecorder()
+	cw = &countingWriter{ResponseWriter: plain, status: http.StatusOK}
+	n, err = io.Copy(cw, strings.NewReader("0123456789"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), n)
+	assert.Equal(t, int64(10), cw.bytes)
+	assert.Equal(t, "0123456789", plain.Body.String())
+}
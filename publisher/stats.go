@@ -0,0 +1,8 @@
+package main
+
+// Stats groups statistics commands, results are written to var/stats served by nginx as /stats
+type Stats struct {
+	Downloads   StatsDownloads   `command:"downloads" description:"count episode downloads from nginx access logs"`
+	Subscribers StatsSubscribers `command:"subscribers" description:"estimate subscribers per app from feed fetches"`
+	Traffic     StatsTraffic     `command:"traffic" description:"collect network traffic of the interface and render charts"`
+}
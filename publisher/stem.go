@@ -0,0 +1,174 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// russian stemmer, implementation of snowball algorithm, see https://snowballstem.org/algorithms/russian/stemmer.html
+
+// stemEndings is a class of endings, Group1 endings must be preceded by "а" or "я" in RV
+type stemEndings struct {
+	Group1 []string
+	Group2 []string
+}
+
+var (
+	stemPerfectiveGerund = stemEndings{
+		Group1: []string{"в", "вши", "вшись"},
+		Group2: []string{"ив", "ивши", "ившись", "ыв", "ывши", "ывшись"},
+	}
+	stemAdjective = stemEndings{Group2: []string{"ее", "ие", "ые", "ое", "ими", "ыми", "ей", "ий", "ый", "ой", "ем", "им",
+		"ым", "ом", "его", "ого", "ему", "ому", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею"}}
+	stemParticiple = stemEndings{
+		Group1: []string{"ем", "нн", "вш", "ющ", "щ"},
+		Group2: []string{"ивш", "ывш", "ующ"},
+	}
+	stemReflexive = stemEndings{Group2: []string{"ся", "сь"}}
+	stemVerb      = stemEndings{
+		Group1: []string{"ла", "на", "ете", "йте", "ли", "й", "л", "ем", "н", "ло", "но", "ет", "ют", "ны", "ть", "ешь", "нно"},
+		Group2: []string{"ила", "ыла", "ена", "ейте", "уйте", "ите", "или", "ыли", "ей", "уй", "ил", "ыл", "им", "ым", "ен",
+			"ило", "ыло", "ено", "ят", "ует", "уют", "ит", "ыт", "ены", "ить", "ыть", "ишь", "ую", "ю"},
+	}
+	stemNoun = stemEndings{Group2: []string{"а", "ев", "ов", "ие", "ье", "е", "иями", "ями", "ами", "еи", "ии", "и", "ией",
+		"ей", "ой", "ий", "й", "иям", "ям", "ием", "ем", "ам", "ом", "о", "у", "ах", "иях", "ях", "ы", "ь", "ию", "ью", "ю",
+		"ия", "ья", "я"}}
+	stemSuperlative   = stemEndings{Group2: []string{"ейше", "ейш"}}
+	stemDerivational  = stemEndings{Group2: []string{"ость", "ост"}}
+	stemRussianVowels = "аеиоуыэюя"
+)
+
+// stopWords are common russian words not indexed, snowball list
+var stopWords = func() map[string]bool {
+	res := map[string]bool{}
+	for _, w := range strings.Fields(`и в во не что он на я с со как а то все она так его но да ты к у же вы за бы по
+		только ее мне было вот от меня еще нет о из ему теперь когда даже ну вдруг ли если уже или ни быть был него до вас
+		нибудь опять уж вам ведь там потом себя ничего ей может они тут где есть надо ней для мы тебя их чем была сам чтоб
+		без будто чего раз тоже себе под будет ж тогда кто этот того потому этого какой совсем ним здесь этом один почти
+		мой тем чтобы нее сейчас были куда зачем всех никогда можно при наконец два об другой хоть после над больше тот
+		через эти нас про всего них какая много разве три эту моя впрочем хорошо свою этой перед иногда лучше чуть том
+		нельзя такой им более всегда конечно всю между`) {
+		res[w] = true
+	}
+	return res
+}()
+
+// searchTokens splits text to lower case words, ё replaced by е, stop words and single letters skipped
+func searchTokens(text string) []string {
+	text = strings.ReplaceAll(strings.ToLower(text), "ё", "е")
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	res := make([]string, 0, len(words))
+	for _, w := range words {
+		if len([]rune(w)) < 2 || stopWords[w] {
+			continue
+		}
+		res = append(res, w)
+	}
+	return res
+}
+
+// stemRussian returns stem of the lower case word, non-russian words returned as is
+func stemRussian(word string) string {
+	w := []rune(strings.ReplaceAll(word, "ё", "е"))
+	rv, r2 := stemRegions(w)
+	if rv >= len(w) {
+		return string(w)
+	}
+
+	// step 1
+	if res, ok := stemRemove(w, rv, stemPerfectiveGerund); ok {
+		w = res
+	} else {
+		if res, ok := stemRemove(w, rv, stemReflexive); ok {
+			w = res
+		}
+		if res, ok := stemRemove(w, rv, stemAdjective); ok {
+			w = res
+			if res, ok := stemRemove(w, rv, stemParticiple); ok {
+				w = res
+			}
+		} else if res, ok := stemRemove(w, rv, stemVerb); ok {
+			w = res
+		} else if res, ok := stemRemove(w, rv, stemNoun); ok {
+			w = res
+		}
+	}
+
+	// step 2
+	if len(w) > rv && w[len(w)-1] == 'и' {
+		w = w[:len(w)-1]
+	}
+
+	// step 3
+	if r2 < len(w) {
+		if res, ok := stemRemove(w, r2, stemDerivational); ok {
+			w = res
+		}
+	}
+
+	// step 4
+	if res, ok := stemRemove(w, rv, stemSuperlative); ok {
+		w = res
+	}
+	switch {
+	case len(w)-2 >= rv && string(w[len(w)-2:]) == "нн":
+		w = w[:len(w)-1]
+	case len(w) > rv && w[len(w)-1] == 'ь':
+		w = w[:len(w)-1]
+	}
+	return string(w)
+}
+
+// stemRegions returns start of RV, the region after the first vowel, and R2, R1 of R1 where R1 is the region
+// after the first non-vowel following a vowel
+func stemRegions(w []rune) (rv, r2 int) {
+	isVowel := func(r rune) bool { return strings.ContainsRune(stemRussianVowels, r) }
+	rv, r1 := len(w), len(w)
+	r2 = len(w)
+	for i, r := range w {
+		if isVowel(r) {
+			rv = i + 1
+			break
+		}
+	}
+	for i := 1; i < len(w); i++ {
+		if !isVowel(w[i]) && isVowel(w[i-1]) {
+			r1 = i + 1
+			break
+		}
+	}
+	for i := r1 + 1; i < len(w); i++ {
+		if !isVowel(w[i]) && isVowel(w[i-1]) {
+			r2 = i + 1
+			break
+		}
+	}
+	return rv, r2
+}
+
+// stemRemove removes the longest ending of the class found in the region starting at pos.
+// Returns false if nothing found or the longest ending is of Group1 and not preceded by "а" or "я".
+func stemRemove(w []rune, pos int, endings stemEndings) ([]rune, bool) {
+	region := string(w[pos:])
+	best, group1 := "", false
+	for _, e := range endings.Group1 {
+		if strings.HasSuffix(region, e) && len(e) > len(best) {
+			best, group1 = e, true
+		}
+	}
+	for _, e := range endings.Group2 {
+		if strings.HasSuffix(region, e) && len(e) > len(best) {
+			best, group1 = e, false
+		}
+	}
+	if best == "" {
+		return w, false
+	}
+	n := len([]rune(best))
+	if group1 {
+		if len(w)-n-1 < pos || (w[len(w)-n-1] != 'а' && w[len(w)-n-1] != 'я') {
+			return w, false
+		}
+	}
+	return w[:len(w)-n], true
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStemRussian(t *testing.T) {
+	// expected stems from snowball russian sample vocabulary
+	tbl := map[string]string{
+		"вавиловка": "вавиловк", "вагнера": "вагнер", "важная": "важн", "важнейшие": "важн", "важности": "важност",
+		"важную": "важн", "вазах": "ваз", "валентина": "валентин", "валя": "вал", "вам": "вам", "ванну": "ван",
+		"варварство": "варварств", "вдохновенно": "вдохновен", "взглянули": "взглянул", "бежавший": "бежа",
+		"зимой": "зим", "зимы": "зим", "ёжик": "ежик", "go": "go", "2023": "2023", "мусорщики": "мусорщик",
+		"мусорщиков": "мусорщик",
+	}
+	for word, stem := range tbl {
+		assert.Equal(t, stem, stemRussian(word), word)
+	}
+}
+
+func TestSearchTokens(t *testing.T) {
+	assert.Equal(t, []string{"почему", "go", "rust", "ежики", "2023"},
+		searchTokens("Почему Go не Rust, и ЁЖИКИ в 2023?"))
+	assert.Empty(t, searchTokens("и в на - ."))
+}
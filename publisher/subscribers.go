@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// StatsSubscribers estimates subscribers per podcast app from feed fetches in nginx access logs
+type StatsSubscribers struct {
+	Logs       []string `long:"log" default:"/var/lib/docker/containers/*/*-json.log*" description:"docker json-file log files, globs allowed"`
+	Output     string   `long:"output" default:"/srv/podcast-uwp/var/stats" description:"stats directory"`
+	SkipIPs    []string `long:"skip-ip" description:"skip requests from ip, addresses of this host are skipped anyway"`
+	CountLocal bool     `long:"count-local" description:"don't skip requests from addresses of this host"`
+	Days       int      `long:"days" default:"90" description:"days in trend chart"`
+	Top        int      `long:"top" default:"6" description:"apps shown on the chart, besides total"`
+}
+
+const (
+	subscribersJSON = "subscribers.json"
+	subscribersHTML = "subscribers.html"
+	subscribersSVG  = "subscribers.svg"
+)
+
+// feedFetch is a feed request from the access log
+type feedFetch struct {
+	Time   time.Time
+	IP, UA string
+	Feed   string
+	App    string
+}
+
+// subscriberStats is the json stats file, history is kept between runs as logs are rotated
+type subscriberStats struct {
+	Updated time.Time                 `json:"updated"`
+	Days    map[string]map[string]int `json:"days"` // day in site time zone -> app -> subscribers
+}
+
+// uaRule maps user agent to podcast app, empty app means the request is not from a subscriber
+type uaRule struct {
+	App   string
+	Match *regexp.Regexp
+}
+
+// uaRules is the ordered table of known clients, the first match wins. Add new apps here,
+// more specific rules go before generic ones. Unmatched clients are counted as "other".
+var uaRules = []uaRule{
+	{App: "Apple Podcasts", Match: regexp.MustCompile(`(?i)^(podcasts|applecoremedia)/|^itms|apple ?podcasts|itunes/`)},
+	{App: "Overcast", Match: regexp.MustCompile(`(?i)overcast`)},
+	{App: "Pocket Casts", Match: regexp.MustCompile(`(?i)pocket ?casts`)},
+	{App: "Castro", Match: regexp.MustCompile(`(?i)castro`)},
+	{App: "Spotify", Match: regexp.MustCompile(`(?i)spotify`)},
+	{App: "Yandex Music", Match: regexp.MustCompile(`(?i)yandex\.?music|yandexmusic`)},
+	{App: "Google Podcasts", Match: regexp.MustCompile(`(?i)google-?podcast`)},
+	{App: "Podcast Addict", Match: regexp.MustCompile(`(?i)podcast ?addict`)},
+	{App: "AntennaPod", Match: regexp.MustCompile(`(?i)antennapod`)},
+	{App: "Castbox", Match: regexp.MustCompile(`(?i)castbox`)},
+	{App: "Player FM", Match: regexp.MustCompile(`(?i)player ?fm`)},
+	{App: "Podcast Republic", Match: regexp.MustCompile(`(?i)podcast ?republic`)},
+	{App: "Podcast Index", Match: regexp.MustCompile(`(?i)podcast ?index`)},
+	{App: "Feedly", Match: regexp.MustCompile(`(?i)feedly`)},
+	{App: "Inoreader", Match: regexp.MustCompile(`(?i)inoreader`)},
+	{App: "NewsBlur", Match: regexp.MustCompile(`(?i)newsblur`)},
+	{App: "The Old Reader", Match: regexp.MustCompile(`(?i)theoldreader`)},
+	{App: "Feedbin", Match: regexp.MustCompile(`(?i)feedbin`)},
+	{App: "Miniflux", Match: regexp.MustCompile(`(?i)miniflux`)},
+	{App: "Tiny Tiny RSS", Match: regexp.MustCompile(`(?i)tiny ?tiny ?rss`)},
+	{App: "", Match: reBotAgent}, // crawlers, monitoring and scripts
+}
+
+var (
+	// reFeedPath matches feeds on podcast.umputun.com and the feeds.rucast.net proxy paths, query ignored
+	reFeedPath = regexp.MustCompile(`^/(podcast\.rss|podcast-failback\.rss|archives\.rss|umputun|Umputun)(?:[?#].*)?$`)
+	// reSubscribers matches subscribers count reported by aggregators, i.e. "Feedly/1.0 (...; 16 subscribers; ...)"
+	reSubscribers = regexp.MustCompile(`(?i)(\d+) (subscribers|readers)`)
+)
+
+//go:embed stats-subscribers.tmpl
+var subscribersTmpl string
+
+// interfaceAddrs returns addresses of this host, replaced in tests
+var interfaceAddrs = net.InterfaceAddrs
+
+// statsSubscribersCmd parses logs, merges estimates with the previous stats and writes json, svg chart and html report.
+// Requests from this host are skipped by default, feeds.rucast.net proxy runs here and fetches podcast.rss
+// for its own subscribers, already counted by /umputun requests.
+func statsSubscribersCmd(req StatsSubscribers) error {
+	files, err := expandGlobs(req.Logs)
+	if err != nil {
+		return err
+	}
+	skip := append([]string{}, req.SkipIPs...)
+	if !req.CountLocal {
+		local, e := localIPs()
+		if e != nil {
+			return e
+		}
+		log.Printf("[DEBUG] skip requests from local addresses %v", local)
+		skip = append(skip, local...)
+	}
+	var fetches []feedFetch
+	err = readAccessLogs(files, func(rec accessRecord) {
+		if containsString(skip, rec.IP) {
+			return
+		}
+		if f, ok := feedFetchFromRecord(rec); ok {
+			fetches = append(fetches, f)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] %d feed requests in %d log files", len(fetches), len(files))
+
+	jsonFile := filepath.Join(req.Output, subscribersJSON)
+	stats := subscriberStats{}
+	if data, e := os.ReadFile(jsonFile); e == nil { //nolint:gosec
+		if e = json.Unmarshal(data, &stats); e != nil {
+			return fmt.Errorf("can't parse %s: %w", jsonFile, e)
+		}
+	}
+	stats = mergeSubscribers(stats, estimateSubscribers(fetches))
+	stats.Updated = nowFn()
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal subscriber stats: %w", err)
+	}
+	if err = os.MkdirAll(req.Output, 0o750); err != nil {
+		return fmt.Errorf("error creating dir %s: %w", req.Output, err)
+	}
+	if err = writeFileAtomic(jsonFile, data); err != nil {
+		return err
+	}
+	svg, html, err := subscribersReport(stats, req.Days, req.Top)
+	if err != nil {
+		return err
+	}
+	if err = writeFileAtomic(filepath.Join(req.Output, subscribersSVG), svg); err != nil {
+		return err
+	}
+	if err = writeFileAtomic(filepath.Join(req.Output, subscribersHTML), html); err != nil {
+		return err
+	}
+	log.Printf("[INFO] subscriber stats of %d days saved to %s", len(stats.Days), req.Output)
+	return nil
+}
+
+// localIPs returns ip addresses of all interfaces of this host
+func localIPs() ([]string, error) {
+	addrs, err := interfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("can't get local addresses: %w", err)
+	}
+	res := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok {
+			res = append(res, ipNet.IP.String())
+		}
+	}
+	return res, nil
+}
+
+// feedFetchFromRecord accepts successful GET of the feed, 304 is a fetch of unchanged feed.
+// feeds.rucast.net paths reported as podcast.rss, the proxy serves it.
+func feedFetchFromRecord(rec accessRecord) (feedFetch, bool) {
+	if rec.Method != "GET" || (rec.Status != 200 && rec.Status != 304) {
+		return feedFetch{}, false
+	}
+	m := reFeedPath.FindStringSubmatch(rec.Path)
+	if m == nil {
+		return feedFetch{}, false
+	}
+	app := classifyAgent(rec.UA)
+	if app == "" {
+		return feedFetch{}, false
+	}
+	feed := m[1]
+	if strings.EqualFold(feed, "umputun") || feed == "podcast-failback.rss" {
+		feed = "podcast.rss"
+	}
+	return feedFetch{Time: rec.Time, IP: rec.IP, UA: rec.UA, Feed: feed, App: app}, true
+}
+
+// classifyAgent returns app of the user agent by uaRules, empty for non-subscribers
+func classifyAgent(ua string) string {
+	for _, r := range uaRules {
+		if r.Match.MatchString(ua) {
+			return r.App
+		}
+	}
+	return "other"
+}
+
+// estimateSubscribers returns subscribers per day per app. Aggregators report subscribers count in user agent,
+// the max reported count of the day used for each fetcher, fetchers differ by user agent without the count,
+// i.e. by feed-id. Other clients counted as unique ip and user agent of the day, per feed.
+func estimateSubscribers(fetches []feedFetch) map[string]map[string]int {
+	type key struct{ day, app, client string }
+	counts := map[key]int{}
+	for _, f := range fetches {
+		k := key{day: f.Time.In(siteTZ).Format("2006-01-02"), app: f.App}
+		n := 1
+		if m := reSubscribers.FindStringSubmatch(f.UA); m != nil {
+			n, _ = strconv.Atoi(m[1]) // regex guarantees digits
+			k.client = f.Feed + "\x00" + reSubscribers.ReplaceAllString(f.UA, "")
+		} else {
+			k.client = f.Feed + "\x00" + f.IP + "\x00" + f.UA
+		}
+		if n > counts[k] {
+			counts[k] = n
+		}
+	}
+
+	res := map[string]map[string]int{}
+	for k, n := range counts {
+		if res[k.day] == nil {
+			res[k.day] = map[string]int{}
+		}
+		res[k.day][k.app] += n
+	}
+	return res
+}
+
+// mergeSubscribers adds estimates to stats, the bigger value of the same day and app is kept,
+// as the day is estimated again from logs on each run and older part of the day may be rotated out.
+func mergeSubscribers(stats subscriberStats, est map[string]map[string]int) subscriberStats {
+	if stats.Days == nil {
+		stats.Days = map[string]map[string]int{}
+	}
+	for day, apps := range est {
+		if stats.Days[day] == nil {
+			stats.Days[day] = map[string]int{}
+		}
+		for app, n := range apps {
+			if n > stats.Days[day][app] {
+				stats.Days[day][app] = n
+			}
+		}
+	}
+	return stats
+}
+
+// subscribersReport renders svg trend chart of total and top apps, and html page with the chart and apps table.
+// The current day is incomplete and excluded, the report ends on the previous day.
+func subscribersReport(stats subscriberStats, days, top int) (svg, html []byte, err error) {
+	type appRow struct {
+		App             string
+		Last, Avg, Peak int
+	}
+
+	end := stats.Updated.In(siteTZ).AddDate(0, 0, -1)
+	labels := make([]string, 0, days)
+	for i := days - 1; i >= 0; i-- {
+		labels = append(labels, end.AddDate(0, 0, -i).Format("2006-01-02"))
+	}
+
+	rows := []appRow{}
+	rowIdx := map[string]int{}
+	total := chartSeries{Name: "всего", Values: make([]float64, len(labels))}
+	for i, day := range labels {
+		for app, n := range stats.Days[day] {
+			if _, ok := rowIdx[app]; !ok {
+				rowIdx[app] = len(rows)
+				rows = append(rows, appRow{App: app})
+			}
+			r := &rows[rowIdx[app]]
+			r.Avg += n // sum for now
+			if n > r.Peak {
+				r.Peak = n
+			}
+			if i == len(labels)-1 {
+				r.Last = n
+			}
+			total.Values[i] += float64(n)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Avg != rows[j].Avg {
+			return rows[i].Avg > rows[j].Avg
+		}
+		return rows[i].App < rows[j].App
+	})
+
+	series := []chartSeries{total}
+	for i := range rows {
+		if i < top {
+			s := chartSeries{Name: rows[i].App, Values: make([]float64, len(labels))}
+			for j, day := range labels {
+				s.Values[j] = float64(stats.Days[day][rows[i].App])
+			}
+			series = append(series, s)
+		}
+		if len(labels) > 0 {
+			rows[i].Avg = (rows[i].Avg + len(labels)/2) / len(labels)
+		}
+	}
+	svg = svgLineChart("Подписчики по приложениям", labels, series, 900, 360)
+
+	tmpl, err := template.New("subscribers").Parse(subscribersTmpl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't parse subscribers template: %w", err)
+	}
+	lastTotal := 0
+	if len(total.Values) > 0 {
+		lastTotal = int(total.Values[len(total.Values)-1])
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		Updated   string
+		Days      int
+		Chart     string
+		LastTotal int
+		Rows      []appRow
+	}{Updated: stats.Updated.In(siteTZ).Format("2006-01-02 15:04:05 MST"), Days: days, Chart: subscribersSVG,
+		LastTotal: lastTotal, Rows: rows})
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't render subscribers report: %w", err)
+	}
+	return svg, buf.Bytes(), nil
+}
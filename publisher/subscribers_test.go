@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsSubscribersCmd(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2023, 4, 10, 12, 0, 0, 0, siteTZ) }
+	defer func() { nowFn = time.Now }()
+	interfaceAddrs = func() ([]net.Addr, error) {
+		return []net.Addr{&net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(8, 32)}}, nil
+	}
+	defer func() { interfaceAddrs = net.InterfaceAddrs }()
+
+	dir := t.TempDir()
+	logs := `1.1.1.1 - - [09/Apr/2023:10:00:00 -0500] "GET /podcast.rss HTTP/1.1" 200 5000 "-" "Overcast/1.0 Podcast Sync (12 subscribers; feed-id=123; +http://overcast.fm/)"
+1.1.1.2 - - [09/Apr/2023:11:00:00 -0500] "GET /podcast.rss HTTP/1.1" 304 0 "-" "Overcast/1.0 Podcast Sync (14 subscribers; feed-id=123; +http://overcast.fm/)"
+2.2.2.2 - - [09/Apr/2023:10:00:00 -0500] "GET /umputun HTTP/1.1" 200 5000 "-" "AntennaPod/3.0"
+2.2.2.2 - - [09/Apr/2023:12:00:00 -0500] "GET /podcast.rss HTTP/1.1" 200 5000 "-" "AntennaPod/3.0"
+10.0.0.1 - - [09/Apr/2023:10:00:00 -0500] "GET /podcast.rss HTTP/1.1" 200 5000 "-" "AntennaPod/3.0"
+3.3.3.3 - - [09/Apr/2023:10:00:00 -0500] "GET /archives.rss HTTP/1.1" 200 5000 "-" "Feedly/1.0 (+http://www.feedly.com/fetcher.html; 3 subscribers; like FeedFetcher-Google)"
+4.4.4.4 - - [09/Apr/2023:10:00:00 -0500] "GET /podcast.rss HTTP/1.1" 200 5000 "-" "Googlebot/2.1"
+5.5.5.5 - - [09/Apr/2023:10:00:00 -0500] "GET /media/ump_podcast571.mp3 HTTP/1.1" 200 5000 "-" "Overcast/1.0"
+6.6.6.6 - - [09/Apr/2023:10:00:00 -0500] "GET /podcast.rss HTTP/1.1" 200 5000 "-" "SomeReader/2.0"
+7.7.7.7 - - [09/Apr/2023:10:00:00 -0500] "GET /podcast.rss HTTP/1.1" 200 5000 "-" "Castro 2022"
+`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "abc-json.log"), []byte(logs), 0o600))
+
+	out := filepath.Join(t.TempDir(), "stats")
+	require.NoError(t, os.MkdirAll(out, 0o700))
+	prev := `{"days": {"2023-04-08": {"Overcast": 11}, "2023-04-09": {"Overcast": 20}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(out, subscribersJSON), []byte(prev), 0o600))
+
+	req := StatsSubscribers{Logs: []string{filepath.Join(dir, "*-json.log*")}, Output: out, SkipIPs: []string{"7.7.7.7"},
+		Days: 3, Top: 2}
+	require.NoError(t, statsSubscribersCmd(req))
+
+	data, err := os.ReadFile(filepath.Join(out, subscribersJSON))
+	require.NoError(t, err)
+	var stats subscriberStats
+	require.NoError(t, json.Unmarshal(data, &stats))
+	assert.Equal(t, map[string]map[string]int{
+		"2023-04-08": {"Overcast": 11},
+		"2023-04-09": {"Overcast": 20, "AntennaPod": 1, "Feedly": 3, "other": 1},
+	}, stats.Days)
+	assert.True(t, nowFn().Equal(stats.Updated))
+
+	html, err := os.ReadFile(filepath.Join(out, subscribersHTML))
+	require.NoError(t, err)
+	assert.Contains(t, string(html), `<img src="subscribers.svg" alt="подписчики">`)
+	assert.Contains(t, string(html), `<tr><td>Overcast</td><td class="num">20</td><td class="num">10</td><td class="num">20</td></tr>`)
+	assert.Contains(t, string(html), `<tr><th>всего</th><th class="num">25</th>`)
+
+	svg, err := os.ReadFile(filepath.Join(out, subscribersSVG))
+	require.NoError(t, err)
+	assert.Contains(t, string(svg), ">всего</text>")
+	assert.Contains(t, string(svg), ">Overcast</text>")
+	assert.Contains(t, string(svg), ">Feedly</text>")
+	assert.NotContains(t, string(svg), ">AntennaPod</text>", "only top 2 apps on the chart")
+
+	req.CountLocal = true
+	require.NoError(t, statsSubscribersCmd(req))
+	data, err = os.ReadFile(filepath.Join(out, subscribersJSON))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &stats))
+	assert.Equal(t, 2, stats.Days["2023-04-09"]["AntennaPod"], "request from local address counted")
+}
+
+func TestFeedFetchFromRecord(t *testing.T) {
+	ts := time.Date(2023, 4, 9, 15, 0, 0, 0, time.UTC)
+	tbl := []struct {
+		rec  accessRecord
+		ok   bool
+		feed string
+		app  string
+	}{
+		{accessRecord{Method: "GET", Path: "/podcast.rss", Status: 200, UA: "Podcasts/1650.20 CFNetwork/1333.0.4"}, true, "podcast.rss", "Apple Podcasts"},
+		{accessRecord{Method: "GET", Path: "/podcast.rss?format=xml", Status: 304, UA: "iTMS"}, true, "podcast.rss", "Apple Podcasts"},
+		{accessRecord{Method: "GET", Path: "/Umputun", Status: 200, UA: "Pocket Casts"}, true, "podcast.rss", "Pocket Casts"},
+		{accessRecord{Method: "GET", Path: "/podcast-failback.rss", Status: 200, UA: "Castro 2022"}, true, "podcast.rss", "Castro"},
+		{accessRecord{Method: "GET", Path: "/archives.rss", Status: 200, UA: "Inoreader/1.0 (+http://www.inoreader.com/feed-fetcher; 2 subscribers; )"}, true, "archives.rss", "Inoreader"},
+		{accessRecord{Method: "GET", Path: "/podcast.rss", Status: 200, UA: "FeedFetcher-Google"}, false, "", ""},
+		{accessRecord{Method: "GET", Path: "/podcast.rss", Status: 404, UA: "Overcast/1.0"}, false, "", ""},
+		{accessRecord{Method: "HEAD", Path: "/podcast.rss", Status: 200, UA: "Overcast/1.0"}, false, "", ""},
+		{accessRecord{Method: "GET", Path: "/podcast-archives-short-2.rss", Status: 200, UA: "Overcast/1.0"}, false, "", ""},
+		{accessRecord{Method: "GET", Path: "/podcast.rss", Status: 200, UA: "Mozilla/5.0"}, true, "podcast.rss", "other"},
+	}
+	for _, tt := range tbl {
+		tt.rec.Time, tt.rec.IP = ts, "1.1.1.1"
+		f, ok := feedFetchFromRecord(tt.rec)
+		assert.Equal(t, tt.ok, ok, tt.rec.UA)
+		if ok {
+			assert.Equal(t, feedFetch{Time: ts, IP: "1.1.1.1", UA: tt.rec.UA, Feed: tt.feed, App: tt.app}, f)
+		}
+	}
+}
+
+func TestEstimateSubscribers(t *testing.T) {
+	day := time.Date(2023, 4, 9, 10, 0, 0, 0, siteTZ)
+	fetches := []feedFetch{
+		// the same fetcher, max count of the day
+		{Time: day, IP: "1.1.1.1", UA: "Feedly/1.0 (7 subscribers)", Feed: "podcast.rss", App: "Feedly"},
+		{Time: day.Add(time.Hour), IP: "1.1.1.2", UA: "Feedly/1.0 (9 subscribers)", Feed: "podcast.rss", App: "Feedly"},
+		// another feed
+		{Time: day, IP: "1.1.1.1", UA: "Feedly/1.0 (2 subscribers)", Feed: "archives.rss", App: "Feedly"},
+		// another feed-id
+		{Time: day, IP: "1.1.1.1", UA: "Overcast/1.0 (5 subscribers; feed-id=1)", Feed: "podcast.rss", App: "Overcast"},
+		{Time: day, IP: "1.1.1.1", UA: "Overcast/1.0 (1 subscribers; feed-id=2)", Feed: "podcast.rss", App: "Overcast"},
+		// direct clients by ip and ua
+		{Time: day, IP: "2.2.2.2", UA: "AntennaPod/3.0", Feed: "podcast.rss", App: "AntennaPod"},
+		{Time: day.Add(time.Hour), IP: "2.2.2.2", UA: "AntennaPod/3.0", Feed: "podcast.rss", App: "AntennaPod"},
+		{Time: day, IP: "2.2.2.3", UA: "AntennaPod/3.0", Feed: "podcast.rss", App: "AntennaPod"},
+		// next day
+		{Time: day.AddDate(0, 0, 1), IP: "2.2.2.2", UA: "AntennaPod/3.0", Feed: "podcast.rss", App: "AntennaPod"},
+	}
+	assert.Equal(t, map[string]map[string]int{
+		"2023-04-09": {"Feedly": 11, "Overcast": 6, "AntennaPod": 2},
+		"2023-04-10": {"AntennaPod": 1},
+	}, estimateSubscribers(fetches))
+}
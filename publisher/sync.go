@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Sync copies missing and mismatched episodes between primary and archive hosts. Files are copied host to host
+// by rsync running on the source host, so it should be able to ssh to the destination one.
+type Sync struct {
+	PostsLocation   string `long:"location" env:"POSTS_LOCATION" default:"/Users/umputun/dev.umputun/podcast-uwp/hugo/content/posts" description:"posts location"`
+	Host            string `long:"host" default:"podcast.umputun.com" description:"primary remote host"`
+	User            string `long:"user" default:"umputun" description:"remote user"`
+	Location        string `long:"media-location" default:"/srv/podcast-uwp/var/media" description:"media location on primary host"`
+	DaysKeep        int    `long:"days-keep" default:"700" description:"days primary host keeps files"`
+	ArchiveHost     string `long:"archive-host" default:"archive.rucast.net" description:"archive host"`
+	ArchiveLocation string `long:"archive-location" default:"/data/archive/uwp/media/" description:"archive location"`
+	PrivateKeyPath  string `long:"key" default:"/Users/umputun/.ssh/id_rsa" description:"private key path"`
+	Workers         int    `long:"workers" default:"2" description:"number of parallel copies"`
+	BwLimit         int    `long:"bwlimit" default:"0" description:"total bandwidth limit in KiB/s, split between workers, no limit if 0"`
+	DryRun          bool   `long:"dry" description:"show planned copies only"`
+}
+
+// syncHost is a media location on the host
+type syncHost struct {
+	Name     string // primary or archive
+	Host     string
+	Location string
+}
+
+// syncTask is a file to copy from one host to another
+type syncTask struct {
+	Episode  int
+	File     string
+	From, To syncHost
+	Size     int64
+	Reason   string
+}
+
+// syncResult is a summary of the sync
+type syncResult struct {
+	Copied, Failed int
+	Bytes          int64
+	Errors         []string
+}
+
+// syncRunner runs command on the host and returns its output
+type syncRunner func(host, command string) (string, error)
+
+// syncCmd plans copies from the audit issues and runs them with rsync on the source hosts
+func syncCmd(req Sync) error {
+	posts, err := loadPosts(req.PostsLocation)
+	if err != nil {
+		return fmt.Errorf("error loading posts: %w", err)
+	}
+	sshConfig, err := makeSSHConfig(req.User, req.PrivateKeyPath)
+	if err != nil {
+		return err
+	}
+	primary := syncHost{Name: auditHostPrimary, Host: req.Host, Location: strings.TrimSuffix(req.Location, "/")}
+	archive := syncHost{Name: auditHostArchive, Host: req.ArchiveHost, Location: strings.TrimSuffix(req.ArchiveLocation, "/")}
+	primaryFiles, err := listRemoteMedia(sshConfig, primary.Host, primary.Location)
+	if err != nil {
+		return err
+	}
+	archiveFiles, err := listRemoteMedia(sshConfig, archive.Host, archive.Location)
+	if err != nil {
+		return err
+	}
+
+	issues := auditMedia(posts, primaryFiles, archiveFiles, nowFn(), req.DaysKeep)
+	tasks := planSync(issues, primary, archive, primaryFiles, archiveFiles)
+	for _, t := range tasks {
+		fmt.Printf("%s %s -> %s, %d bytes, %s\n", t.File, t.From.Name, t.To.Name, t.Size, t.Reason)
+	}
+	if req.DryRun || len(tasks) == 0 {
+		log.Printf("[INFO] %d files to copy", len(tasks))
+		return nil
+	}
+
+	run := func(host, command string) (string, error) {
+		var out bytes.Buffer
+		err := sshExec(sshConfig, host, command, &out)
+		return out.String(), err
+	}
+	st := time.Now()
+	res := runSync(tasks, req.User, req.Workers, req.BwLimit, run)
+	fmt.Printf("copied %d files, %d bytes in %v, failed %d\n", res.Copied, res.Bytes, time.Since(st).Round(time.Second), res.Failed)
+	for _, e := range res.Errors {
+		fmt.Printf("  %s\n", e)
+	}
+	if res.Failed > 0 {
+		return fmt.Errorf("%d of %d copies failed", res.Failed, len(tasks))
+	}
+	return nil
+}
+
+// planSync makes copy tasks for audit issues. Missing files are copied from the other host, on size mismatch
+// the bigger file is the source, the smaller one is likely a partial copy.
+func planSync(issues []auditIssue, primary, archive syncHost, primaryFiles, archiveFiles map[string]remoteFile) []syncTask {
+	res := []syncTask{}
+	planned := map[string]bool{}
+	for _, issue := range issues {
+		if planned[issue.File] {
+			continue
+		}
+		p, onPrimary := primaryFiles[issue.File]
+		a, onArchive := archiveFiles[issue.File]
+		task := syncTask{Episode: issue.Episode, File: issue.File, Reason: issue.Issue}
+		switch {
+		case issue.Issue == auditMissing && issue.Host == auditHostArchive && onPrimary,
+			issue.Issue == auditNotArchived:
+			task.From, task.To, task.Size = primary, archive, p.Size
+		case issue.Issue == auditMissing && issue.Host == auditHostPrimary && onArchive:
+			task.From, task.To, task.Size = archive, primary, a.Size
+		case issue.Issue == auditSizeMismatch && p.Size > a.Size:
+			task.From, task.To, task.Size = primary, archive, p.Size
+		case issue.Issue == auditSizeMismatch:
+			task.From, task.To, task.Size = archive, primary, a.Size
+		default:
+			continue
+		}
+		planned[issue.File] = true
+		res = append(res, task)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Episode > res[j].Episode })
+	return res
+}
+
+// runSync copies files with limited number of workers, each copy is verified by sha256 on both hosts
+func runSync(tasks []syncTask, user string, workers, bwLimit int, run syncRunner) syncResult {
+	if workers <= 0 {
+		workers = 1
+	}
+	perWorker := 0
+	if bwLimit > 0 {
+		perWorker = bwLimit / workers
+		if perWorker == 0 {
+			perWorker = 1
+		}
+	}
+
+	var res syncResult
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	ch := make(chan syncTask)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range ch {
+				err := syncFile(t, user, perWorker, run)
+				mu.Lock()
+				if err != nil {
+					res.Failed++
+					res.Errors = append(res.Errors, fmt.Sprintf("%s %s -> %s: %v", t.File, t.From.Name, t.To.Name, err))
+					log.Printf("[WARN] failed to copy %s: %v", t.File, err)
+				} else {
+					res.Copied++
+					res.Bytes += t.Size
+					log.Printf("[INFO] copied %s from %s to %s", t.File, t.From.Host, t.To.Host)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, t := range tasks {
+		ch <- t
+	}
+	close(ch)
+	wg.Wait()
+	sort.Strings(res.Errors)
+	return res
+}
+
+// syncFile runs rsync on the source host. Partial file is kept and resumed with --append-verify,
+// --times keeps source mtime. Destination host key must be in known_hosts of the source, ssh doesn't prompt
+// in batch mode and fails on unknown or changed key. Hashes of both copies compared after the copy.
+func syncFile(t syncTask, user string, bwLimit int, run syncRunner) error {
+	args := []string{"rsync", "--partial", "--append-verify", "--times"}
+	if bwLimit > 0 {
+		args = append(args, fmt.Sprintf("--bwlimit=%d", bwLimit))
+	}
+	args = append(args, "-e", "'ssh -o BatchMode=yes'", t.From.Location+"/"+t.File,
+		fmt.Sprintf("%s@%s:%s/", user, t.To.Host, t.To.Location))
+	if out, err := run(t.From.Host, strings.Join(args, " ")); err != nil {
+		return fmt.Errorf("rsync failed: %v %s", err, strings.TrimSpace(out))
+	}
+
+	hashes := make([]string, 0, 2)
+	for _, h := range []syncHost{t.From, t.To} {
+		out, err := run(h.Host, fmt.Sprintf("sha256sum -- %s/%s", h.Location, t.File))
+		if err != nil {
+			return fmt.Errorf("can't hash on %s: %v", h.Host, err)
+		}
+		fields := strings.Fields(out)
+		if len(fields) == 0 {
+			return fmt.Errorf("no hash from %s", h.Host)
+		}
+		hashes = append(hashes, fields[0])
+	}
+	if hashes[0] != hashes[1] {
+		return fmt.Errorf("sha256 mismatch, %s on %s, %s on %s", hashes[0], t.From.Name, hashes[1], t.To.Name)
+	}
+	return nil
+}
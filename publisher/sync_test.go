@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanSync(t *testing.T) {
+	now := time.Date(2023, 4, 10, 12, 0, 0, 0, siteTZ)
+	posts := []Post{
+		{Filename: "ump_podcast571", Number: 571, Date: now.AddDate(0, 0, -5)},
+		{Filename: "ump_podcast570", Number: 570, Date: now.AddDate(0, 0, -12)},
+		{Filename: "ump_podcast569", Number: 569, Date: now.AddDate(0, 0, -19)},
+		{Filename: "ump_podcast568", Number: 568, Date: now.AddDate(0, 0, -26)},
+		{Filename: "ump_podcast1", Number: 1, Date: now.AddDate(-10, 0, 0)},
+	}
+	old := now.AddDate(-3, 0, 0)
+	primaryFiles := map[string]remoteFile{
+		"ump_podcast571.mp3": {Size: 100, ModTime: now},
+		"ump_podcast570.mp3": {Size: 200, ModTime: now},
+		"ump_podcast568.mp3": {Size: 50, ModTime: now},
+		"ump_podcast300.mp3": {Size: 300, ModTime: old},
+	}
+	archiveFiles := map[string]remoteFile{
+		"ump_podcast570.mp3": {Size: 150},
+		"ump_podcast569.mp3": {Size: 190},
+		"ump_podcast568.mp3": {Size: 180},
+	}
+	primary := syncHost{Name: "primary", Host: "primary.example.com", Location: "/srv/media"}
+	archive := syncHost{Name: "archive", Host: "archive.example.com", Location: "/data/media"}
+
+	tasks := planSync(auditMedia(posts, primaryFiles, archiveFiles, now, 700), primary, archive, primaryFiles, archiveFiles)
+	assert.Equal(t, []syncTask{
+		{Episode: 571, File: "ump_podcast571.mp3", From: primary, To: archive, Size: 100, Reason: "missing"},
+		{Episode: 570, File: "ump_podcast570.mp3", From: primary, To: archive, Size: 200, Reason: "size mismatch"},
+		{Episode: 569, File: "ump_podcast569.mp3", From: archive, To: primary, Size: 190, Reason: "missing"},
+		{Episode: 568, File: "ump_podcast568.mp3", From: archive, To: primary, Size: 180, Reason: "size mismatch"},
+		{Episode: 300, File: "ump_podcast300.mp3", From: primary, To: archive, Size: 300, Reason: "past retention, not archived"},
+	}, tasks, "episode 1 is on neither host, nothing to copy")
+}
+
+func TestRunSync(t *testing.T) {
+	primary := syncHost{Name: "primary", Host: "primary.example.com", Location: "/srv/media"}
+	archive := syncHost{Name: "archive", Host: "archive.example.com", Location: "/data/media"}
+	var tasks []syncTask
+	for i := 1; i <= 6; i++ {
+		tasks = append(tasks, syncTask{Episode: i, File: fmt.Sprintf("ump_podcast%d.mp3", i), From: primary, To: archive, Size: 10})
+	}
+
+	var active, maxActive int32
+	var mu sync.Mutex
+	var commands []string
+	run := func(host, command string) (string, error) {
+		mu.Lock()
+		commands = append(commands, host+": "+command)
+		mu.Unlock()
+		if !strings.HasPrefix(command, "rsync") {
+			if strings.Contains(command, "ump_podcast5.mp3") && host == archive.Host {
+				return "bad  /data/media/ump_podcast5.mp3\n", nil
+			}
+			return "good  " + command + "\n", nil
+		}
+		n := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			m := atomic.LoadInt32(&maxActive)
+			if n <= m || atomic.CompareAndSwapInt32(&maxActive, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if strings.Contains(command, "ump_podcast3.mp3") {
+			return "rsync: connection unexpectedly closed", fmt.Errorf("exit status 12")
+		}
+		return "", nil
+	}
+
+	res := runSync(tasks, "umputun", 2, 1000, run)
+	assert.Equal(t, 4, res.Copied)
+	assert.Equal(t, 2, res.Failed)
+	assert.Equal(t, int64(40), res.Bytes)
+	assert.Equal(t, []string{
+		"ump_podcast3.mp3 primary -> archive: rsync failed: exit status 12 rsync: connection unexpectedly closed",
+		"ump_podcast5.mp3 primary -> archive: sha256 mismatch, good on primary, bad on archive",
+	}, res.Errors)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxActive), "bounded by workers")
+
+	assert.Contains(t, commands, "primary.example.com: rsync --partial --append-verify --times --bwlimit=500 "+
+		"-e 'ssh -o BatchMode=yes' /srv/media/ump_podcast1.mp3 umputun@archive.example.com:/data/media/")
+	assert.Contains(t, commands, "archive.example.com: sha256sum -- /data/media/ump_podcast1.mp3")
+	assert.Len(t, commands, 6+5*2, "no hashing after failed rsync")
+}
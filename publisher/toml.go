@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOML parses hugo front matter and config.toml. Nested tables are returned as map[string]interface{}
+// under their names, errors have line number of the problem as "line N: ...".
+func parseTOML(data string) (map[string]interface{}, error) {
+	res := map[string]interface{}{}
+	if _, err := toml.Decode(data, &res); err != nil {
+		var perr toml.ParseError
+		if !errors.As(err, &perr) {
+			return nil, err
+		}
+		line := perr.Position.Line
+		if line == 0 { // error at the end of input without trailing new line
+			line = strings.Count(data, "\n") + 1
+		}
+		// message is empty for some errors, cut it from the formatted one, "toml: line N (last key "k"): msg"
+		msg := perr.Message
+		if msg == "" {
+			prefix := fmt.Sprintf("toml: line %d", perr.Position.Line)
+			if perr.LastKey != "" {
+				prefix += fmt.Sprintf(" (last key %q)", perr.LastKey)
+			}
+			msg = strings.TrimPrefix(perr.Error(), prefix+": ")
+		}
+		if perr.LastKey != "" {
+			return nil, fmt.Errorf("line %d: key %q: %s", line, perr.LastKey, msg)
+		}
+		return nil, fmt.Errorf("line %d: %s", line, msg)
+	}
+	return res, nil
+}
+
+// tomlQuote makes basic toml string. Unlike strconv.Quote it keeps non-ascii text as is and escapes
+// control characters with \uXXXX only, toml has no \x, \a and \v escapes.
+func tomlQuote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&sb, `\u%04X`, r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// tomlBalanced checks if all open brackets outside of strings are closed, used by line level
+// front matter editing to skip continuation lines of multi-line arrays
+func tomlBalanced(s string) bool {
+	depth, inStr := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case inStr && c == '\\':
+			i++
+		case c == '"':
+			inStr = !inStr
+		case !inStr && c == '[':
+			depth++
+		case !inStr && c == ']':
+			depth--
+		}
+	}
+	return depth == 0
+}
+
+// tomlString returns string value for the key, empty if missing or not a string.
+// Unquoted toml dates are returned in the same form they are written in hugo front matter.
+func tomlString(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case time.Time:
+		switch v.Location().String() {
+		case "datetime-local":
+			return v.Format("2006-01-02T15:04:05")
+		case "date-local":
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	}
+	return ""
+}
+
+// tomlStrings returns list of strings for the key, accepts a single string as well
+func tomlStrings(m map[string]interface{}, key string) []string {
+	switch v := m[key].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		res := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+// tomlTable returns nested table for the key, empty map if missing
+func tomlTable(m map[string]interface{}, key string) map[string]interface{} {
+	if v, ok := m[key].(map[string]interface{}); ok {
+		return v
+	}
+	return map[string]interface{}{}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTOML(t *testing.T) {
+	data := `
+title = "UWP - Выпуск 5" # comment
+date = "2023-04-07T14:40:46"
+categories = ["podcast", "video"]
+draft = false
+weight = 10
+tags = [
+  "one",
+  "two # not a comment",
+]
+literal = 'c:\path'
+escaped = "quote \" and \u0416"
+
+description = """
+multi-line "description"
+with [brackets] = and # hash"""
+updated = 2023-04-07T14:40:46
+inline = {name = "x", size = 2}
+
+[params]
+  author = "Umputun"
+  [params.social]
+    twitter = "umputun"
+
+["with = sign"]
+  key = "value"
+
+[[chapters]]
+  title = "first"
+[[chapters]]
+  title = "second"
+`
+	res, err := parseTOML(data)
+	require.NoError(t, err)
+	assert.Equal(t, "UWP - Выпуск 5", res["title"])
+	assert.Equal(t, []interface{}{"podcast", "video"}, res["categories"])
+	assert.Equal(t, false, res["draft"])
+	assert.Equal(t, int64(10), res["weight"])
+	assert.Equal(t, []string{"one", "two # not a comment"}, tomlStrings(res, "tags"))
+	assert.Equal(t, `c:\path`, res["literal"])
+	assert.Equal(t, `quote " and Ж`, res["escaped"])
+	assert.Equal(t, "Umputun", tomlString(tomlTable(res, "params"), "author"))
+	assert.Equal(t, "umputun", tomlString(tomlTable(tomlTable(res, "params"), "social"), "twitter"))
+	assert.Equal(t, "multi-line \"description\"\nwith [brackets] = and # hash", res["description"])
+	assert.Equal(t, "2023-04-07T14:40:46", tomlString(res, "updated"))
+	assert.Equal(t, map[string]interface{}{"name": "x", "size": int64(2)}, res["inline"])
+	assert.Equal(t, "value", tomlString(tomlTable(res, "with = sign"), "key"))
+	assert.Equal(t, []map[string]interface{}{{"title": "first"}, {"title": "second"}}, res["chapters"])
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tbl := []struct {
+		data string
+		err  string
+	}{
+		{data: `title = "unterminated`, err: "line 1: key \"title\": unexpected EOF"},
+		{data: "a = 1\ntitle = \"unterminated\nb = 2\n", err: "line 2: key \"title\": strings cannot contain newlines"},
+		{data: "a = 1\nb\n", err: "line 3: expected '.' or '='"},
+		{data: "a = 1\na = 2", err: "line 2: key \"a\": Key 'a' has already been defined"},
+		{data: `a = ["x" "y"]`, err: "line 1: key \"a\": expected a comma"},
+		{data: `a = blah`, err: "line 1: key \"a\": expected value but found \"blah\""},
+	}
+	for _, tt := range tbl {
+		t.Run(tt.data, func(t *testing.T) {
+			_, err := parseTOML(tt.data)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestTOMLQuote(t *testing.T) {
+	tbl := []struct{ in, out string }{
+		{"Выпуск 5", `"Выпуск 5"`},
+		{`say "hi" \o/`, `"say \"hi\" \\o/"`},
+		{"a\nb\tc\r", `"a\nb\tc\r"`},
+		{"bell\a vt\v del\x7f", `"bell\u0007 vt\u000B del\u007F"`},
+		{"emoji 🎙", `"emoji 🎙"`},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.out, tomlQuote(tt.in), tt.in)
+		params, err := parseTOML("v = " + tomlQuote(tt.in))
+		require.NoError(t, err, tt.in)
+		assert.Equal(t, tt.in, params["v"], "round trip of %q", tt.in)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // sha1 is required by bittorrent protocol
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Torrent makes torrent files with archive web seed for episodes and zip bundles, magnet links are added to episode posts.
+// With upload new torrents are copied next to media and bundles on archive host and linked from archives-zip page.
+type Torrent struct {
+	HugoLocation  string   `long:"hugo" env:"HUGO_LOCATION" default:"/srv/podcast-uwp/hugo" description:"hugo site location"`
+	MediaLocation []string `long:"media" env:"MEDIA_LOCATION" env-delim:"," default:"/srv/podcast-uwp/var/media" description:"local media location(s)"`
+	ZipLocation   string   `long:"zip" default:"/srv/podcast-uwp/var/zip" description:"zip bundles directory, skipped if empty"`
+	WebSeedURL    string   `long:"web-seed" default:"https://archive.rucast.net/uwp/media/" description:"web seed url of media files and bundles"`
+	Output        string   `long:"output" default:"/srv/podcast-uwp/var/torrents" description:"torrent files directory"`
+	Trackers      []string `long:"tracker" description:"announce url(s), torrents rely on web seed and dht if not set"`
+	Numbers       string   `long:"num" description:"episode number or range, like 571 or 500-571, all episodes if not set"`
+	Force         bool     `long:"force" description:"remake existing torrents"`
+
+	Upload          bool   `long:"upload" description:"upload new torrents to archive host and link bundle torrents from archives-zip page"`
+	User            string `long:"user" default:"umputun" description:"remote user"`
+	ArchiveHost     string `long:"archive-host"  default:"archive.rucast.net" description:"archive host"`
+	ArchiveLocation string `long:"archive-location"  default:"/data/archive/uwp/media/" description:"archive location"`
+	PrivateKeyPath  string `long:"key"  default:"/Users/umputun/.ssh/id_rsa" description:"private key path"`
+}
+
+// reZipBundleURL matches link to zip bundle in archives-zip page, url and file name captured
+var reZipBundleURL = regexp.MustCompile(`\]\(([^)]*/(ump_podcast\d+-\d+\.zip))\)`)
+
+// torrentFile is a made torrent with its info hash
+type torrentFile struct {
+	Name     string // name of the shared file
+	Length   int64
+	InfoHash [20]byte
+	Data     []byte // bencoded metainfo
+}
+
+// torrentCmd makes torrents for episodes without magnet link and for new or rebuilt zip bundles, uploads made
+// torrents if requested
+func torrentCmd(req Torrent) error {
+	minNum, maxNum := 0, 0
+	if req.Numbers != "" {
+		var err error
+		if minNum, maxNum, err = parseNumRange(req.Numbers); err != nil {
+			return err
+		}
+	}
+	posts, err := loadPosts(filepath.Join(req.HugoLocation, "content", "posts"))
+	if err != nil {
+		return fmt.Errorf("error loading posts: %w", err)
+	}
+	if err = os.MkdirAll(req.Output, 0o750); err != nil {
+		return fmt.Errorf("error creating output dir %s: %w", req.Output, err)
+	}
+
+	made := []string{} // torrent files made in this run
+	for _, ep := range publishedEpisodes(posts, nowFn()) {
+		if maxNum > 0 && (ep.Number < minNum || ep.Number > maxNum) {
+			continue
+		}
+		name := ep.Filename + ".mp3"
+		if _, ok := ep.Params["magnet"]; ok && !req.Force {
+			if _, err = os.Stat(filepath.Join(req.Output, name+".torrent")); err == nil {
+				continue
+			}
+		}
+		src, cleanup, err := bundleMediaFile(name, req.MediaLocation, req.WebSeedURL, req.Output)
+		if err != nil {
+			return err
+		}
+		tf, err := writeTorrent(src, name, req, ep.Title)
+		cleanup()
+		if err != nil {
+			return err
+		}
+		if err = updatePostFrontMatter(ep.Path, "magnet", tf.Magnet(req.WebSeedURL, req.Trackers)); err != nil {
+			return err
+		}
+		made = append(made, filepath.Join(req.Output, name+".torrent"))
+	}
+	log.Printf("[INFO] %d episode torrents made", len(made))
+
+	bundleTorrents := []string{}
+	if req.ZipLocation != "" {
+		bundles, err := filepath.Glob(filepath.Join(req.ZipLocation, "ump_podcast*-*.zip"))
+		if err != nil {
+			return fmt.Errorf("error listing bundles in %s: %w", req.ZipLocation, err)
+		}
+		for _, file := range bundles {
+			name := filepath.Base(file)
+			if !req.Force && !newerFile(file, filepath.Join(req.Output, name+".torrent")) {
+				continue
+			}
+			if _, err = writeTorrent(file, name, req, ""); err != nil {
+				return err
+			}
+			bundleTorrents = append(bundleTorrents, name+".torrent")
+			made = append(made, filepath.Join(req.Output, name+".torrent"))
+		}
+		log.Printf("[INFO] %d bundle torrents made", len(bundleTorrents))
+	}
+
+	if !req.Upload || len(made) == 0 {
+		return nil
+	}
+	if err = uploadArchive(req.User, req.PrivateKeyPath, req.ArchiveHost, req.ArchiveLocation, made...); err != nil {
+		return err
+	}
+	log.Printf("[INFO] %d torrents uploaded to %s", len(made), req.ArchiveHost)
+	return linkZipTorrents(filepath.Join(req.HugoLocation, "content", "pages", "archives-zip.md"), bundleTorrents)
+}
+
+// newerFile checks if the file is newer than the derived one or the derived file is missing,
+// rebuilt bundle needs a new torrent
+func newerFile(file, derived string) bool {
+	dfi, err := os.Stat(derived)
+	if err != nil {
+		return true
+	}
+	fi, err := os.Stat(file)
+	return err == nil && fi.ModTime().After(dfi.ModTime())
+}
+
+// linkZipTorrents adds torrent link next to the bundle link in archives-zip page, torrent is in the same
+// location as the bundle. Bundles not in the page are skipped, page created by archive-zip command.
+func linkZipTorrents(pageFile string, torrents []string) error {
+	if len(torrents) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(pageFile) //nolint:gosec
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't read page %s: %w", pageFile, err)
+	}
+	lines := strings.Split(string(data), "\n")
+	count := 0
+	for i, line := range lines {
+		m := reZipBundleURL.FindStringSubmatch(line)
+		if m == nil || !strings.HasPrefix(line, "- ") || !containsString(torrents, m[2]+".torrent") ||
+			strings.Contains(line, m[2]+".torrent") {
+			continue
+		}
+		lines[i] = fmt.Sprintf("%s, [торрент](%s.torrent)", line, m[1])
+		count++
+	}
+	if count == 0 {
+		return nil
+	}
+	log.Printf("[INFO] %d bundle torrents linked in %s", count, pageFile)
+	return writeFileAtomic(pageFile, []byte(strings.Join(lines, "\n")))
+}
+
+// writeTorrent makes torrent for the file and saves it as name.torrent in output directory
+func writeTorrent(file, name string, req Torrent, comment string) (torrentFile, error) {
+	tf, err := makeTorrent(file, name, strings.TrimSuffix(req.WebSeedURL, "/")+"/"+name, req.Trackers, comment)
+	if err != nil {
+		return torrentFile{}, fmt.Errorf("error making torrent for %s: %w", file, err)
+	}
+	if err = writeFileAtomic(filepath.Join(req.Output, name+".torrent"), tf.Data); err != nil {
+		return torrentFile{}, err
+	}
+	log.Printf("[DEBUG] torrent %s.torrent, info hash %s", name, hex.EncodeToString(tf.InfoHash[:]))
+	return tf, nil
+}
+
+// makeTorrent makes single file torrent with the web seed (BEP-19), see https://www.bittorrent.org/beps/bep_0003.html.
+// Creation date is not set, so the same file always gives the same torrent.
+func makeTorrent(file, name, webSeed string, trackers []string, comment string) (torrentFile, error) {
+	fh, err := os.Open(file) //nolint:gosec
+	if err != nil {
+		return torrentFile{}, err
+	}
+	defer fh.Close() //nolint:errcheck // read only
+	fi, err := fh.Stat()
+	if err != nil {
+		return torrentFile{}, err
+	}
+
+	pieceLen := torrentPieceLength(fi.Size())
+	pieces, err := torrentPieces(fh, pieceLen)
+	if err != nil {
+		return torrentFile{}, err
+	}
+	info := map[string]interface{}{"length": fi.Size(), "name": name, "piece length": pieceLen, "pieces": pieces}
+	var infoData bytes.Buffer
+	if err = bencode(&infoData, info); err != nil {
+		return torrentFile{}, err
+	}
+
+	meta := map[string]interface{}{"info": info, "url-list": []interface{}{webSeed}, "created by": "uwp-publisher"}
+	if comment != "" {
+		meta["comment"] = comment
+	}
+	if len(trackers) > 0 {
+		meta["announce"] = trackers[0]
+		tiers := make([]interface{}, 0, len(trackers))
+		for _, t := range trackers {
+			tiers = append(tiers, []interface{}{t})
+		}
+		meta["announce-list"] = tiers
+	}
+	var data bytes.Buffer
+	if err = bencode(&data, meta); err != nil {
+		return torrentFile{}, err
+	}
+	return torrentFile{Name: name, Length: fi.Size(), InfoHash: sha1.Sum(infoData.Bytes()), Data: data.Bytes()}, nil //nolint:gosec
+}
+
+// Magnet returns magnet link with web seed and trackers
+func (tf torrentFile) Magnet(webSeedURL string, trackers []string) string {
+	res := fmt.Sprintf("magnet:?xt=urn:btih:%s&dn=%s&xl=%d", hex.EncodeToString(tf.InfoHash[:]), url.QueryEscape(tf.Name), tf.Length)
+	for _, t := range trackers {
+		res += "&tr=" + url.QueryEscape(t)
+	}
+	return res + "&ws=" + url.QueryEscape(strings.TrimSuffix(webSeedURL, "/")+"/"+tf.Name)
+}
+
+// torrentPieceLength returns power of two piece length, from 256KiB to 16MiB, keeping about 1000-2000 pieces
+func torrentPieceLength(size int64) int64 {
+	res := int64(256 * 1024)
+	for size/res > 2000 && res < 16*1024*1024 {
+		res *= 2
+	}
+	return res
+}
+
+// torrentPieces returns concatenated sha1 hashes of pieces
+func torrentPieces(r io.Reader, pieceLen int64) (string, error) {
+	var res bytes.Buffer
+	buf := make([]byte, pieceLen)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sum := sha1.Sum(buf[:n]) //nolint:gosec
+			res.Write(sum[:])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return res.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// bencode writes value encoded as bencode. Supported are integers, strings, lists and dictionaries with string keys,
+// dictionary keys are sorted as raw strings.
+func bencode(w *bytes.Buffer, v interface{}) error {
+	switch val := v.(type) {
+	case int:
+		fmt.Fprintf(w, "i%de", val)
+	case int64:
+		fmt.Fprintf(w, "i%de", val)
+	case string:
+		fmt.Fprintf(w, "%d:%s", len(val), val)
+	case []byte:
+		fmt.Fprintf(w, "%d:%s", len(val), val)
+	case []interface{}:
+		w.WriteByte('l')
+		for _, item := range val {
+			if err := bencode(w, item); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('e')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		w.WriteByte('d')
+		for _, k := range keys {
+			fmt.Fprintf(w, "%d:%s", len(k), k)
+			if err := bencode(w, val[k]); err != nil {
+				return err
+			}
+		}
+		w.WriteByte('e')
+	default:
+		return fmt.Errorf("unsupported bencode type %T", v)
+	}
+	return nil
+}
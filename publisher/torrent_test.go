@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTorrentCmd(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/media/ump_podcast570.mp3" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("remote mp3 570"))
+	}))
+	defer srv.Close()
+
+	hugo := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(hugo, "content"), 0o700))
+	require.NoError(t, os.Rename(copyTestPosts(t), filepath.Join(hugo, "content", "posts")))
+	media, zipDir := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(media, "ump_podcast571.mp3"), []byte("local mp3 571"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(zipDir, "ump_podcast1-10.zip"), []byte("zip 1-10"), 0o600))
+
+	req := Torrent{HugoLocation: hugo, MediaLocation: []string{media}, ZipLocation: zipDir, WebSeedURL: srv.URL + "/media/",
+		Output: filepath.Join(t.TempDir(), "torrents"), Trackers: []string{"udp://tracker.example.com:1337/announce"}}
+	require.NoError(t, torrentCmd(req))
+
+	files, err := filepath.Glob(filepath.Join(req.Output, "*"))
+	require.NoError(t, err)
+	require.Len(t, files, 3, "no downloaded files left")
+	data, err := os.ReadFile(filepath.Join(req.Output, "ump_podcast571.mp3.torrent"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "8:url-listl"+bencodeString(srv.URL+"/media/ump_podcast571.mp3")+"e")
+	assert.Contains(t, string(data), "8:announce"+bencodeString("udp://tracker.example.com:1337/announce"))
+	assert.Contains(t, string(data), "7:comment"+bencodeString("UWP - Выпуск 571"))
+	_, err = os.Stat(filepath.Join(req.Output, "ump_podcast1-10.zip.torrent"))
+	assert.NoError(t, err)
+
+	post, err := readPost(filepath.Join(hugo, "content", "posts", "podcast-571.md"))
+	require.NoError(t, err)
+	info := "d6:lengthi13e4:name18:ump_podcast571.mp312:piece lengthi262144e6:pieces20:" +
+		string(sha1Bytes("local mp3 571")) + "e"
+	hash := sha1Bytes(info)
+	assert.Equal(t, "magnet:?xt=urn:btih:"+hex.EncodeToString(hash)+"&dn=ump_podcast571.mp3&xl=13"+
+		"&tr=udp%3A%2F%2Ftracker.example.com%3A1337%2Fannounce&ws="+strings.ReplaceAll(
+		strings.ReplaceAll(srv.URL, ":", "%3A"), "/", "%2F")+"%2Fmedia%2Fump_podcast571.mp3", post.Params["magnet"])
+	post, err = readPost(filepath.Join(hugo, "content", "posts", "podcast-570.md"))
+	require.NoError(t, err)
+	assert.Contains(t, post.Params["magnet"], "&dn=ump_podcast570.mp3&xl=14&")
+
+	// torrents with magnet are not remade
+	require.NoError(t, os.Remove(filepath.Join(media, "ump_podcast571.mp3")))
+	srv.Close()
+	require.NoError(t, torrentCmd(req))
+
+	req.Force = true
+	assert.Error(t, torrentCmd(req))
+}
+
+func TestTorrentCmdUpload(t *testing.T) {
+	hugo := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(hugo, "content", "pages"), 0o700))
+	require.NoError(t, os.Rename(copyTestPosts(t), filepath.Join(hugo, "content", "posts")))
+	media, zipDir := t.TempDir(), t.TempDir()
+	for _, n := range []string{"570", "571"} {
+		require.NoError(t, os.WriteFile(filepath.Join(media, "ump_podcast"+n+".mp3"), []byte("mp3 "+n), 0o600))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(zipDir, "ump_podcast1-10.zip"), []byte("zip 1-10"), 0o600))
+	page := filepath.Join(hugo, "content", "pages", "archives-zip.md")
+	require.NoError(t, os.WriteFile(page, []byte("+++\ntitle = \"zip\"\n+++\n\n"+
+		"- [Выпуски с 1 по 10 одним файлом](http://archive.rucast.net/uwp/media/ump_podcast1-10.zip)\n"+
+		"- [Выпуски с 11 по 20 одним файлом](http://archive.rucast.net/uwp/media/ump_podcast11-20.zip)\n"), 0o600))
+
+	var uploaded []string
+	defer func(f func(string, string, string, string, ...string) error) { uploadArchive = f }(uploadArchive)
+	uploadArchive = func(user, key, host, location string, files ...string) error {
+		assert.Equal(t, "archive.rucast.net", host)
+		assert.Equal(t, "/data/archive/uwp/media/", location)
+		for _, f := range files {
+			uploaded = append(uploaded, filepath.Base(f))
+		}
+		return nil
+	}
+
+	req := Torrent{HugoLocation: hugo, MediaLocation: []string{media}, ZipLocation: zipDir,
+		WebSeedURL: "https://archive.rucast.net/uwp/media/", Output: filepath.Join(t.TempDir(), "torrents"), Upload: true,
+		ArchiveHost: "archive.rucast.net", ArchiveLocation: "/data/archive/uwp/media/"}
+	require.NoError(t, torrentCmd(req))
+	assert.Equal(t, []string{"ump_podcast571.mp3.torrent", "ump_podcast570.mp3.torrent", "ump_podcast1-10.zip.torrent"}, uploaded)
+	data, err := os.ReadFile(page) //nolint:gosec
+	require.NoError(t, err)
+	assert.Equal(t, "+++\ntitle = \"zip\"\n+++\n\n"+
+		"- [Выпуски с 1 по 10 одним файлом](http://archive.rucast.net/uwp/media/ump_podcast1-10.zip), "+
+		"[торрент](http://archive.rucast.net/uwp/media/ump_podcast1-10.zip.torrent)\n"+
+		"- [Выпуски с 11 по 20 одним файлом](http://archive.rucast.net/uwp/media/ump_podcast11-20.zip)\n", string(data))
+
+	// nothing new, nothing uploaded, page kept
+	uploaded = nil
+	require.NoError(t, torrentCmd(req))
+	assert.Empty(t, uploaded)
+
+	// rebuilt bundle gets a new torrent, linked once
+	future := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(zipDir, "ump_podcast1-10.zip"), future, future))
+	require.NoError(t, torrentCmd(req))
+	assert.Equal(t, []string{"ump_podcast1-10.zip.torrent"}, uploaded)
+	data2, err := os.ReadFile(page) //nolint:gosec
+	require.NoError(t, err)
+	assert.Equal(t, string(data), string(data2))
+}
+
+func TestMakeTorrent(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "ump_podcast1.mp3")
+	content := bytes.Repeat([]byte("0123456789abcdef"), 20000) // 320000 bytes, two pieces
+	require.NoError(t, os.WriteFile(file, content, 0o600))
+
+	tf, err := makeTorrent(file, "ump_podcast1.mp3", "https://archive.example.com/media/ump_podcast1.mp3", nil, "")
+	require.NoError(t, err)
+	pieces := string(sha1Bytes(string(content[:262144]))) + string(sha1Bytes(string(content[262144:])))
+	info := "d6:lengthi320000e4:name16:ump_podcast1.mp312:piece lengthi262144e6:pieces40:" + pieces + "e"
+	assert.Equal(t, "d10:created by13:uwp-publisher4:info"+info+
+		"8:url-listl50:https://archive.example.com/media/ump_podcast1.mp3ee", string(tf.Data))
+	assert.Equal(t, sha1Bytes(info), tf.InfoHash[:])
+	assert.Equal(t, int64(320000), tf.Length)
+
+	assert.Equal(t, "magnet:?xt=urn:btih:"+hex.EncodeToString(tf.InfoHash[:])+"&dn=ump_podcast1.mp3&xl=320000"+
+		"&ws=https%3A%2F%2Farchive.example.com%2Fmedia%2Fump_podcast1.mp3", tf.Magnet("https://archive.example.com/media/", nil))
+}
+
+func TestTorrentPieceLength(t *testing.T) {
+	tbl := []struct {
+		size int64
+		res  int64
+	}{
+		{0, 256 * 1024},
+		{100 * 1024 * 1024, 256 * 1024},
+		{600 * 1024 * 1024, 512 * 1024},
+		{100 * 1024 * 1024 * 1024, 16 * 1024 * 1024},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.res, torrentPieceLength(tt.size), tt.size)
+	}
+}
+
+func TestBencode(t *testing.T) {
+	var buf bytes.Buffer
+	err := bencode(&buf, map[string]interface{}{"b": []interface{}{1, int64(-2), "x"}, "a": []byte("spam"), "": "e"})
+	require.NoError(t, err)
+	assert.Equal(t, "d0:1:e1:a4:spam1:bli1ei-2e1:xee", buf.String())
+
+	assert.EqualError(t, bencode(&buf, 1.5), "unsupported bencode type float64")
+}
+
+func sha1Bytes(s string) []byte {
+	h := sha1.Sum([]byte(s)) //nolint:gosec
+	return h[:]
+}
+
+func bencodeString(s string) string {
+	var buf bytes.Buffer
+	_ = bencode(&buf, s)
+	return buf.String()
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// StatsTraffic samples network interface counters from /proc/net/dev and keeps hourly, daily and monthly rollups.
+// The rollups are stored in traffic.json of the output dir, which is also the json api of stats page.
+type StatsTraffic struct {
+	Interface  string        `long:"interface" default:"eth0" description:"network interface"`
+	ProcNetDev string        `long:"proc-net-dev" default:"/proc/net/dev" description:"interface counters file"`
+	Output     string        `long:"output" default:"/srv/podcast-uwp/var/stats" description:"stats directory"`
+	Interval   time.Duration `long:"interval" default:"1m" description:"sampling interval"`
+	Render     time.Duration `long:"render" default:"5m" description:"charts rendering interval"`
+	Once       bool          `long:"once" description:"take a single sample, render charts and exit"`
+}
+
+const (
+	trafficJSON       = "traffic.json"
+	trafficHoursSVG   = "traffic-hours.svg"
+	trafficDaysSVG    = "traffic-days.svg"
+	trafficMonthsSVG  = "traffic-months.svg"
+	trafficKeepHours  = 72
+	trafficKeepDays   = 62
+	trafficKeepMonths = 36
+)
+
+// trafficStore is rollups of the interface traffic with the last seen counters, periods in site time zone
+type trafficStore struct {
+	Interface string         `json:"interface"`
+	Updated   time.Time      `json:"updated"`
+	LastRx    uint64         `json:"last_rx"` // counters of the last sample, to make delta of the next one
+	LastTx    uint64         `json:"last_tx"`
+	TotalRx   uint64         `json:"total_rx"`
+	TotalTx   uint64         `json:"total_tx"`
+	Hours     []trafficPoint `json:"hours"`  // 2006-01-02T15
+	Days      []trafficPoint `json:"days"`   // 2006-01-02
+	Months    []trafficPoint `json:"months"` // 2006-01
+}
+
+// trafficPoint is received and transmitted bytes of the period
+type trafficPoint struct {
+	Period string `json:"period"`
+	Rx     uint64 `json:"rx"`
+	Tx     uint64 `json:"tx"`
+}
+
+// statsTrafficCmd samples counters every interval and renders charts every render interval, till SIGTERM or SIGINT
+func statsTrafficCmd(req StatsTraffic) error {
+	storeFile := filepath.Join(req.Output, trafficJSON)
+	store := trafficStore{Interface: req.Interface}
+	if data, err := os.ReadFile(storeFile); err == nil { //nolint:gosec
+		if err = json.Unmarshal(data, &store); err != nil {
+			return fmt.Errorf("can't parse %s: %w", storeFile, err)
+		}
+	}
+	if store.Interface != req.Interface {
+		log.Printf("[WARN] interface changed from %s to %s, counters reset", store.Interface, req.Interface)
+		store = trafficStore{Interface: req.Interface}
+	}
+
+	sample := func() error {
+		rx, tx, err := readInterfaceCounters(req.ProcNetDev, req.Interface)
+		if err != nil {
+			return err
+		}
+		store = addTrafficSample(store, nowFn(), rx, tx)
+		return saveTrafficStore(storeFile, store)
+	}
+	if err := sample(); err != nil {
+		return err
+	}
+	if err := renderTraffic(req.Output, store); err != nil {
+		return err
+	}
+	if req.Once {
+		return nil
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+	sampleTicker, renderTicker := time.NewTicker(req.Interval), time.NewTicker(req.Render)
+	defer sampleTicker.Stop()
+	defer renderTicker.Stop()
+	log.Printf("[INFO] sampling %s every %v to %s", req.Interface, req.Interval, storeFile)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sampleTicker.C:
+			if err := sample(); err != nil {
+				log.Printf("[WARN] %v", err)
+			}
+		case <-renderTicker.C:
+			if err := renderTraffic(req.Output, store); err != nil {
+				log.Printf("[WARN] %v", err)
+			}
+		}
+	}
+}
+
+// readInterfaceCounters returns received and transmitted bytes of the interface from /proc/net/dev
+func readInterfaceCounters(file, iface string) (rx, tx uint64, err error) {
+	fh, err := os.Open(file) //nolint:gosec
+	if err != nil {
+		return 0, 0, fmt.Errorf("error opening %s: %w", file, err)
+	}
+	defer fh.Close() //nolint:errcheck
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		name, counters, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || strings.TrimSpace(name) != iface {
+			continue
+		}
+		// receive: bytes packets errs drop fifo frame compressed multicast, transmit: bytes ...
+		fields := strings.Fields(counters)
+		if len(fields) < 9 {
+			return 0, 0, fmt.Errorf("unexpected counters of %s: %q", iface, counters)
+		}
+		if rx, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid rx bytes of %s: %w", iface, err)
+		}
+		if tx, err = strconv.ParseUint(fields[8], 10, 64); err != nil {
+			return 0, 0, fmt.Errorf("invalid tx bytes of %s: %w", iface, err)
+		}
+		return rx, tx, nil
+	}
+	if err = scanner.Err(); err != nil {
+		return 0, 0, fmt.Errorf("error reading %s: %w", file, err)
+	}
+	return 0, 0, fmt.Errorf("interface %s not found in %s", iface, file)
+}
+
+// addTrafficSample adds counters delta since the last sample to the periods of ts. Counters lower than the last ones
+// mean the host rebooted and counters started from zero, so the whole value is the delta.
+// The first sample only sets the last counters.
+func addTrafficSample(store trafficStore, ts time.Time, rx, tx uint64) trafficStore {
+	if store.Updated.IsZero() {
+		store.LastRx, store.LastTx, store.Updated = rx, tx, ts
+		return store
+	}
+	dRx, dTx := rx, tx
+	if rx >= store.LastRx && tx >= store.LastTx {
+		dRx, dTx = rx-store.LastRx, tx-store.LastTx
+	}
+	store.LastRx, store.LastTx, store.Updated = rx, tx, ts
+	store.TotalRx += dRx
+	store.TotalTx += dTx
+
+	t := ts.In(siteTZ)
+	store.Hours = addTrafficPoint(store.Hours, t.Format("2006-01-02T15"), dRx, dTx, trafficKeepHours)
+	store.Days = addTrafficPoint(store.Days, t.Format("2006-01-02"), dRx, dTx, trafficKeepDays)
+	store.Months = addTrafficPoint(store.Months, t.Format("2006-01"), dRx, dTx, trafficKeepMonths)
+	return store
+}
+
+// addTrafficPoint adds bytes to the last point if it is of the same period, starts a new one otherwise.
+// Only the last keep points retained.
+func addTrafficPoint(points []trafficPoint, period string, rx, tx uint64, keep int) []trafficPoint {
+	if n := len(points); n > 0 && points[n-1].Period == period {
+		points[n-1].Rx += rx
+		points[n-1].Tx += tx
+		return points
+	}
+	points = append(points, trafficPoint{Period: period, Rx: rx, Tx: tx})
+	if len(points) > keep {
+		points = append([]trafficPoint{}, points[len(points)-keep:]...)
+	}
+	return points
+}
+
+func saveTrafficStore(file string, store trafficStore) error {
+	data, err := json.MarshalIndent(store, "", "  ")
+	if err != nil {
+		return fmt.Errorf("can't marshal traffic store: %w", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return fmt.Errorf("error creating dir %s: %w", filepath.Dir(file), err)
+	}
+	return writeFileAtomic(file, data)
+}
+
+// renderTraffic writes svg charts of the last 24 hours, 30 days and 12 months
+func renderTraffic(dir string, store trafficStore) error {
+	charts := []struct {
+		file, title string
+		points      []trafficPoint
+		last        int
+		label       func(period string) string
+	}{
+		{trafficHoursSVG, "Трафик по часам", store.Hours, 24, func(p string) string { return p[len(p)-2:] }},
+		{trafficDaysSVG, "Трафик по дням", store.Days, 30, func(p string) string { return p[len(p)-5:] }},
+		{trafficMonthsSVG, "Трафик по месяцам", store.Months, 12, func(p string) string { return p }},
+	}
+	for _, c := range charts {
+		points := c.points
+		if len(points) > c.last {
+			points = points[len(points)-c.last:]
+		}
+		labels := make([]string, len(points))
+		rx := chartSeries{Name: "rx", Values: make([]float64, len(points))}
+		tx := chartSeries{Name: "tx", Values: make([]float64, len(points))}
+		for i, p := range points {
+			labels[i] = c.label(p.Period)
+			rx.Values[i], tx.Values[i] = float64(p.Rx), float64(p.Tx)
+		}
+		svg := svgBarChart(c.title+", "+store.Interface+", байт", labels, []chartSeries{rx, tx}, 900, 300)
+		if err := writeFileAtomic(filepath.Join(dir, c.file), svg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
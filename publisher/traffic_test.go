@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testProcNetDev = `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:  123456     100    0    0    0     0          0         0   123456     100    0    0    0     0       0          0
+  eth0: 1000 2000    0    0    0     0          0         0 5000 3000    0    0    0     0       0          0
+`
+
+func TestStatsTrafficCmd(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2023, 4, 10, 12, 30, 0, 0, siteTZ) }
+	defer func() { nowFn = time.Now }()
+
+	dir := t.TempDir()
+	procFile := filepath.Join(dir, "dev")
+	require.NoError(t, os.WriteFile(procFile, []byte(testProcNetDev), 0o600))
+	out := filepath.Join(dir, "stats")
+	req := StatsTraffic{Interface: "eth0", ProcNetDev: procFile, Output: out, Once: true}
+
+	require.NoError(t, statsTrafficCmd(req))
+	nowFn = func() time.Time { return time.Date(2023, 4, 10, 12, 31, 0, 0, siteTZ) }
+	require.NoError(t, os.WriteFile(procFile, []byte(testProcNetDev[:len(testProcNetDev)-len("\n")]+"\n"+
+		"  eth1: 1 1 0 0 0 0 0 0 1 1 0 0 0 0 0 0\n"), 0o600))
+	require.NoError(t, statsTrafficCmd(req), "counters unchanged")
+
+	data, err := os.ReadFile(filepath.Join(out, trafficJSON))
+	require.NoError(t, err)
+	var store trafficStore
+	require.NoError(t, json.Unmarshal(data, &store))
+	assert.Equal(t, "eth0", store.Interface)
+	assert.Equal(t, uint64(1000), store.LastRx)
+	assert.Equal(t, uint64(5000), store.LastTx)
+	assert.Equal(t, []trafficPoint{{Period: "2023-04-10T12"}}, store.Hours)
+	assert.True(t, nowFn().Equal(store.Updated))
+
+	for _, f := range []string{trafficHoursSVG, trafficDaysSVG, trafficMonthsSVG} {
+		svg, e := os.ReadFile(filepath.Join(out, f))
+		require.NoError(t, e)
+		assert.Contains(t, string(svg), "eth0, байт</text>")
+	}
+
+	req.Interface = "wlan0"
+	assert.EqualError(t, statsTrafficCmd(req), "interface wlan0 not found in "+procFile)
+}
+
+func TestReadInterfaceCounters(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dev")
+	require.NoError(t, os.WriteFile(file, []byte(testProcNetDev), 0o600))
+	rx, tx, err := readInterfaceCounters(file, "eth0")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1000), rx)
+	assert.Equal(t, uint64(5000), tx)
+
+	rx, tx, err = readInterfaceCounters(file, "lo")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(123456), rx)
+	assert.Equal(t, uint64(123456), tx)
+
+	_, _, err = readInterfaceCounters(filepath.Join(t.TempDir(), "none"), "eth0")
+	assert.Error(t, err)
+}
+
+func TestAddTrafficSample(t *testing.T) {
+	ts := time.Date(2023, 4, 30, 23, 50, 0, 0, siteTZ)
+	store := addTrafficSample(trafficStore{Interface: "eth0"}, ts, 1000, 2000)
+	assert.Empty(t, store.Hours, "first sample sets counters only")
+
+	store = addTrafficSample(store, ts.Add(5*time.Minute), 1500, 2100)
+	store = addTrafficSample(store, ts.Add(9*time.Minute), 1600, 2200)
+	// next hour, day and month
+	store = addTrafficSample(store, ts.Add(15*time.Minute), 2000, 3000)
+	// reboot, counters from zero
+	store = addTrafficSample(store, ts.Add(20*time.Minute), 50, 70)
+
+	assert.Equal(t, []trafficPoint{{Period: "2023-04-30T23", Rx: 600, Tx: 200}, {Period: "2023-05-01T00", Rx: 450, Tx: 870}}, store.Hours)
+	assert.Equal(t, []trafficPoint{{Period: "2023-04-30", Rx: 600, Tx: 200}, {Period: "2023-05-01", Rx: 450, Tx: 870}}, store.Days)
+	assert.Equal(t, []trafficPoint{{Period: "2023-04", Rx: 600, Tx: 200}, {Period: "2023-05", Rx: 450, Tx: 870}}, store.Months)
+	assert.Equal(t, uint64(1050), store.TotalRx)
+	assert.Equal(t, uint64(1070), store.TotalTx)
+	assert.Equal(t, uint64(50), store.LastRx)
+}
+
+func TestAddTrafficPoint(t *testing.T) {
+	var points []trafficPoint
+	for _, p := range []string{"a", "a", "b", "c", "d"} {
+		points = addTrafficPoint(points, p, 1, 2, 3)
+	}
+	assert.Equal(t, []trafficPoint{{Period: "b", Rx: 1, Tx: 2}, {Period: "c", Rx: 1, Tx: 2}, {Period: "d", Rx: 1, Tx: 2}}, points)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Transcript converts episode transcript between srt and webvtt, validates it and records both in the post
+type Transcript struct {
+	Episode       int         `short:"e" long:"episode" required:"true" description:"episode number"`
+	File          string      `short:"f" long:"file" required:"true" description:"transcript file, srt or vtt"`
+	PostsLocation string      `long:"location" env:"POSTS_LOCATION" default:"/Users/umputun/dev.umputun/podcast-uwp/hugo/content/posts" description:"posts location"`
+	Output        string      `short:"o" long:"output" env:"MEDIA_LOCATION" default:"/srv/podcast-uwp/var/media" description:"local media location, transcripts written there before upload"`
+	MediaURL      string      `long:"media-url" default:"https://podcast.umputun.com/media/" description:"media url, transcripts uploaded next to mp3"`
+	Upload        MediaUpload `group:"upload options"`
+}
+
+// transcriptCue is a single timed text of the transcript
+type transcriptCue struct {
+	Start, End time.Duration
+	Text       string
+}
+
+// transcriptCmd parses transcript, writes it in both formats to media location, uploads them next to mp3 and
+// records urls in the post. The post is not changed if upload failed.
+func transcriptCmd(req Transcript) error {
+	post, err := findEpisodePost(req.PostsLocation, req.Episode)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(req.File) //nolint:gosec
+	if err != nil {
+		return fmt.Errorf("error reading transcript %s: %w", req.File, err)
+	}
+
+	var cues []transcriptCue
+	switch ext := strings.ToLower(filepath.Ext(req.File)); ext {
+	case ".srt":
+		cues, err = parseSRT(string(data))
+	case ".vtt":
+		cues, err = parseVTT(string(data))
+	default:
+		return fmt.Errorf("unsupported transcript format %q, srt or vtt expected", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing transcript %s: %w", req.File, err)
+	}
+	if err = validateCues(cues); err != nil {
+		return fmt.Errorf("invalid transcript %s: %w", req.File, err)
+	}
+	log.Printf("[INFO] %d cues in %s", len(cues), req.File)
+
+	if err = os.MkdirAll(req.Output, 0o750); err != nil {
+		return fmt.Errorf("error creating dir %s: %w", req.Output, err)
+	}
+	urls, files := []string{}, []string{}
+	for _, f := range []struct{ ext, body string }{{".srt", formatSRT(cues)}, {".vtt", formatVTT(cues)}} {
+		name := post.Filename + f.ext
+		if err = writeFileAtomic(filepath.Join(req.Output, name), []byte(f.body)); err != nil {
+			return err
+		}
+		files = append(files, filepath.Join(req.Output, name))
+		urls = append(urls, strings.TrimSuffix(req.MediaURL, "/")+"/"+name)
+	}
+	if err = uploadMedia(req.Upload, files...); err != nil {
+		return fmt.Errorf("transcripts not uploaded, post not changed: %w", err)
+	}
+	return updatePostFrontMatter(post.Path, "transcripts", urls)
+}
+
+// parseSRT parses SubRip subtitles, cues separated by empty lines with optional numeric index
+func parseSRT(data string) ([]transcriptCue, error) {
+	return parseCues(data, ",")
+}
+
+// parseVTT parses WebVTT, header and NOTE/STYLE blocks are skipped
+func parseVTT(data string) ([]transcriptCue, error) {
+	data = strings.TrimPrefix(strings.ReplaceAll(data, "\r\n", "\n"), "\ufeff")
+	if !strings.HasPrefix(data, "WEBVTT") {
+		return nil, fmt.Errorf("missing WEBVTT header")
+	}
+	return parseCues(data, ".")
+}
+
+// parseCues parses blocks of "start --> end" line followed by text. Blocks without timing line are ignored,
+// those are vtt header, notes and styles.
+func parseCues(data, msSep string) ([]transcriptCue, error) {
+	data = strings.TrimPrefix(strings.ReplaceAll(data, "\r\n", "\n"), "\ufeff")
+	var res []transcriptCue
+	for _, block := range strings.Split(data, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		for i, line := range lines {
+			if !strings.Contains(line, "-->") {
+				continue
+			}
+			parts := strings.Fields(line) // vtt allows cue settings after the end time
+			if len(parts) < 3 || parts[1] != "-->" {
+				return nil, fmt.Errorf("invalid timing line %q", line)
+			}
+			start, err := parseCueTime(parts[0], msSep)
+			if err != nil {
+				return nil, err
+			}
+			end, err := parseCueTime(parts[2], msSep)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, transcriptCue{Start: start, End: end, Text: strings.Join(lines[i+1:], "\n")})
+			break
+		}
+	}
+	return res, nil
+}
+
+// parseCueTime parses [HH:]MM:SS,mmm (srt) or [HH:]MM:SS.mmm (vtt)
+func parseCueTime(s, msSep string) (time.Duration, error) {
+	secPart, msPart, ok := strings.Cut(s, msSep)
+	if !ok || len(msPart) != 3 {
+		return 0, fmt.Errorf("invalid cue time %q", s)
+	}
+	ms, err := strconv.Atoi(msPart)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cue time %q: %w", s, err)
+	}
+	d, err := parseTimestamp(secPart)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cue time %q: %w", s, err)
+	}
+	return d + time.Duration(ms)*time.Millisecond, nil
+}
+
+// validateCues checks cues are ordered, not overlapping and have positive duration and text
+func validateCues(cues []transcriptCue) error {
+	if len(cues) == 0 {
+		return fmt.Errorf("no cues found")
+	}
+	for i, c := range cues {
+		if c.End <= c.Start {
+			return fmt.Errorf("cue %d: end %s is not after start %s", i+1, formatCueTime(c.End, "."), formatCueTime(c.Start, "."))
+		}
+		if strings.TrimSpace(c.Text) == "" {
+			return fmt.Errorf("cue %d: empty text", i+1)
+		}
+		if i > 0 && c.Start < cues[i-1].End {
+			return fmt.Errorf("cue %d: starts at %s, before the end of previous cue %s", i+1,
+				formatCueTime(c.Start, "."), formatCueTime(cues[i-1].End, "."))
+		}
+	}
+	return nil
+}
+
+func formatSRT(cues []transcriptCue) string {
+	var sb strings.Builder
+	for i, c := range cues {
+		sb.WriteString(fmt.Sprintf("%d\n%s --> %s\n%s\n\n", i+1, formatCueTime(c.Start, ","), formatCueTime(c.End, ","), c.Text))
+	}
+	return sb.String()
+}
+
+func formatVTT(cues []transcriptCue) string {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n\n")
+	for _, c := range cues {
+		sb.WriteString(fmt.Sprintf("%s --> %s\n%s\n\n", formatCueTime(c.Start, "."), formatCueTime(c.End, "."), c.Text))
+	}
+	return sb.String()
+}
+
+func formatCueTime(d time.Duration, msSep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, (ms/60000)%60, (ms/1000)%60, msSep, ms%1000)
+}
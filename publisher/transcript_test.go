@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTranscripts(t *testing.T) {
+	srt := "1\r\n00:00:01,500 --> 00:00:04,000\r\nПривет\r\n\r\n2\r\n00:00:04,000 --> 00:01:02,250\r\nЭто подкаст\r\nUWP\r\n"
+	cues, err := parseSRT(srt)
+	require.NoError(t, err)
+	exp := []transcriptCue{
+		{Start: 1500 * time.Millisecond, End: 4 * time.Second, Text: "Привет"},
+		{Start: 4 * time.Second, End: 62250 * time.Millisecond, Text: "Это подкаст\nUWP"},
+	}
+	assert.Equal(t, exp, cues)
+	require.NoError(t, validateCues(cues))
+
+	vtt := formatVTT(cues)
+	assert.Equal(t, "WEBVTT\n\n00:00:01.500 --> 00:00:04.000\nПривет\n\n00:00:04.000 --> 00:01:02.250\nЭто подкаст\nUWP\n\n", vtt)
+	cues, err = parseVTT("WEBVTT - uwp\n\nNOTE some note\n\nintro\n00:01.500 --> 00:04.000 align:start\nПривет\n\n" +
+		"00:00:04.000 --> 00:01:02.250\nЭто подкаст\nUWP\n")
+	require.NoError(t, err)
+	assert.Equal(t, exp, cues)
+	assert.Equal(t, "1\n00:00:01,500 --> 00:00:04,000\nПривет\n\n2\n00:00:04,000 --> 00:01:02,250\nЭто подкаст\nUWP\n\n",
+		formatSRT(cues))
+
+	_, err = parseVTT("00:00:01.000 --> 00:00:02.000\ntext\n")
+	assert.EqualError(t, err, "missing WEBVTT header")
+	_, err = parseSRT("1\n00:00:01.000 --> 00:00:02,000\ntext\n")
+	assert.EqualError(t, err, `invalid cue time "00:00:01.000"`)
+}
+
+func TestValidateCues(t *testing.T) {
+	assert.EqualError(t, validateCues(nil), "no cues found")
+	assert.EqualError(t, validateCues([]transcriptCue{{Start: 2 * time.Second, End: time.Second, Text: "a"}}),
+		"cue 1: end 00:00:01.000 is not after start 00:00:02.000")
+	assert.EqualError(t, validateCues([]transcriptCue{{Start: 0, End: time.Second, Text: " "}}), "cue 1: empty text")
+	assert.EqualError(t, validateCues([]transcriptCue{{Start: 0, End: 2 * time.Second, Text: "a"},
+		{Start: time.Second, End: 3 * time.Second, Text: "b"}}),
+		"cue 2: starts at 00:00:01.000, before the end of previous cue 00:00:02.000")
+}
+
+func TestTranscriptCmd(t *testing.T) {
+	postsDir, outDir := copyTestPosts(t), t.TempDir()
+	srtFile := filepath.Join(t.TempDir(), "uwp571.srt")
+	require.NoError(t, os.WriteFile(srtFile, []byte("1\n00:00:01,000 --> 00:00:02,000\nПривет\n"), 0o600))
+
+	var uploaded []string
+	uploadErr := errors.New("scp failed")
+	defer func(f func(MediaUpload, ...string) error) { uploadMedia = f }(uploadMedia)
+	uploadMedia = func(_ MediaUpload, files ...string) error {
+		if uploadErr != nil {
+			return uploadErr
+		}
+		uploaded = append(uploaded, files...)
+		return nil
+	}
+
+	req := Transcript{Episode: 571, File: srtFile, PostsLocation: postsDir, Output: outDir,
+		MediaURL: "https://podcast.umputun.com/media/"}
+	assert.EqualError(t, transcriptCmd(req), "transcripts not uploaded, post not changed: scp failed")
+	post, err := readPost(filepath.Join(postsDir, "podcast-571.md"))
+	require.NoError(t, err)
+	assert.Empty(t, tomlStrings(post.Params, "transcripts"))
+
+	uploadErr = nil
+	require.NoError(t, transcriptCmd(req))
+	assert.Equal(t, []string{filepath.Join(outDir, "ump_podcast571.srt"), filepath.Join(outDir, "ump_podcast571.vtt")}, uploaded)
+	assert.FileExists(t, filepath.Join(outDir, "ump_podcast571.srt"))
+	vtt, err := os.ReadFile(filepath.Join(outDir, "ump_podcast571.vtt"))
+	require.NoError(t, err)
+	assert.Equal(t, "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nПривет\n\n", string(vtt))
+
+	post, err = readPost(filepath.Join(postsDir, "podcast-571.md"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"https://podcast.umputun.com/media/ump_podcast571.srt",
+		"https://podcast.umputun.com/media/ump_podcast571.vtt"}, tomlStrings(post.Params, "transcripts"))
+
+	site, err := loadSiteConfig("testdata/hugo/config.toml")
+	require.NoError(t, err)
+	item := makeFeedItem(site, feedSpec{MediaURL: "https://podcast.umputun.com/media/"}, post, mediaInfo{})
+	assert.Equal(t, []rssMediaRef{
+		{URL: "https://podcast.umputun.com/media/ump_podcast571.srt", Type: "application/srt", Language: "ru"},
+		{URL: "https://podcast.umputun.com/media/ump_podcast571.vtt", Type: "text/vtt", Language: "ru"},
+	}, item.PodcastTranscript)
+
+	req.File = "testdata/hugo/config.toml"
+	assert.EqualError(t, transcriptCmd(req), `unsupported transcript format ".toml", srt or vtt expected`)
+}
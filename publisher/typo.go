@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Typo checks or fixes russian typography of posts body, front matter, code, urls and html tags are not changed
+type Typo struct {
+	PostsLocation string   `long:"location" env:"POSTS_LOCATION" default:"/Users/umputun/dev.umputun/podcast-uwp/hugo/content/posts" description:"posts location"`
+	Files         []string `short:"f" long:"file" description:"post file(s), all posts in location if not set"`
+	Fix           bool     `long:"fix" description:"fix posts in place, only report problems otherwise"`
+}
+
+// typoRule is a named typography fix applied to the line with protected parts masked
+type typoRule struct {
+	Name  string
+	Apply func(line string) string
+}
+
+const nbsp = "\u00a0"
+
+var (
+	// reTypoProtected matches parts of the line left as is: list marker, inline code, shortcodes, code-like
+	// html elements, html tags, markdown link targets and bare urls
+	reTypoProtected = regexp.MustCompile(`^\s*(?:[-*+]|\d+\.)\s+|` + "`[^`]*`" + `|\{\{[<%].*?[%>]\}\}|<(?:code|pre|script|style)[^>]*>.*?</(?:code|pre|script|style)>` +
+		`|<[^>]+>|\]\([^)]*\)|https?://[^\s)<>"]+`)
+	reTypoMask     = regexp.MustCompile(`\x{E000}(\d+)\x{E001}`)
+	reTypoDash     = regexp.MustCompile(`(\S)[ \t\x{00a0}]+(?:--?|–|—)[ \t]+`)
+	reTypoEllipsis = regexp.MustCompile(`\.\.\.`)
+	reTypoPunct    = regexp.MustCompile(`(\S)[ \t]+([,.;:!?])([^)(\-]|$)`)
+)
+
+var typoRules = []typoRule{
+	{Name: "ellipsis", Apply: func(s string) string { return reTypoEllipsis.ReplaceAllString(s, "…") }},
+	{Name: "space before punctuation", Apply: func(s string) string { return reTypoPunct.ReplaceAllString(s, "$1$2$3") }},
+	{Name: "dash", Apply: func(s string) string { return reTypoDash.ReplaceAllString(s, "$1"+nbsp+"— ") }},
+	{Name: "quotes", Apply: typoQuotes},
+}
+
+// typoCmd checks posts and prints file:line issues, or fixes them with --fix
+func typoCmd(req Typo) error {
+	files := req.Files
+	if len(files) == 0 {
+		var err error
+		if files, err = filepath.Glob(filepath.Join(req.PostsLocation, "*.md")); err != nil {
+			return fmt.Errorf("error listing posts in %s: %w", req.PostsLocation, err)
+		}
+	}
+
+	issues, err := typoFiles(files, req.Fix)
+	if err != nil {
+		return err
+	}
+	if req.Fix {
+		log.Printf("[INFO] %d typography issues fixed in %d files", len(issues), len(files))
+		return nil
+	}
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if len(issues) > 0 {
+		return fmt.Errorf("%d typography issues found", len(issues))
+	}
+	return nil
+}
+
+// typoFiles checks files and returns found issues, with fix changed files are rewritten
+func typoFiles(files []string, fix bool) ([]lintIssue, error) {
+	var res []lintIssue
+	for _, file := range files {
+		data, err := os.ReadFile(file) //nolint:gosec
+		if err != nil {
+			return nil, fmt.Errorf("error reading post %s: %w", file, err)
+		}
+		fixed, issues := typoContent(string(data))
+		for i := range issues {
+			issues[i].File = file
+		}
+		res = append(res, issues...)
+		if !fix || fixed == string(data) {
+			continue
+		}
+		if err = writeFileAtomic(file, []byte(fixed)); err != nil {
+			return nil, err
+		}
+		log.Printf("[DEBUG] typography fixed in %s, %d lines", file, len(issues))
+	}
+	return res, nil
+}
+
+// typoContent fixes typography of the post body. Front matter, fenced and indented code blocks are skipped.
+// Returns fixed content and an issue for each changed line.
+func typoContent(content string) (string, []lintIssue) {
+	var issues []lintIssue
+	lines := strings.Split(content, "\n")
+	inFrontMatter, inBody, inCode := false, false, false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case !inBody && !inFrontMatter && trimmed == "":
+			continue // blank lines before front matter
+		case !inBody && trimmed == "+++":
+			inFrontMatter = !inFrontMatter
+			inBody = !inFrontMatter
+			continue
+		case inFrontMatter:
+			continue
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			inCode = !inCode
+			continue
+		case inCode, strings.HasPrefix(line, "\t"), strings.HasPrefix(line, "    ") && !reMdList.MatchString(line):
+			continue
+		}
+
+		fixed, rules := typoLine(line)
+		if len(rules) == 0 {
+			continue
+		}
+		lines[i] = fixed
+		issues = append(issues, lintIssue{Line: i + 1, Msg: "typography: " + strings.Join(rules, ", ")})
+	}
+	return strings.Join(lines, "\n"), issues
+}
+
+// typoLine applies rules to the line with protected parts masked, returns fixed line and names of applied rules
+func typoLine(line string) (string, []string) {
+	var protected []string
+	masked := reTypoProtected.ReplaceAllStringFunc(line, func(s string) string {
+		protected = append(protected, s)
+		return fmt.Sprintf("\uE000%d\uE001", len(protected)-1)
+	})
+
+	var applied []string
+	for _, r := range typoRules {
+		if res := r.Apply(masked); res != masked {
+			applied = append(applied, r.Name)
+			masked = res
+		}
+	}
+	if len(applied) == 0 {
+		return line, nil
+	}
+	return reTypoMask.ReplaceAllStringFunc(masked, func(s string) string {
+		n, _ := strconv.Atoi(reTypoMask.FindStringSubmatch(s)[1]) // regex guarantees digits
+		return protected[n]
+	}), applied
+}
+
+// typoQuotes replaces straight double quotes with «ёлочки», quote after space or opening bracket is opening one
+func typoQuotes(s string) string {
+	if !strings.Contains(s, `"`) {
+		return s
+	}
+	runes := []rune(s)
+	var sb strings.Builder
+	for i, r := range runes {
+		if r != '"' {
+			sb.WriteRune(r)
+			continue
+		}
+		if i == 0 || unicode.IsSpace(runes[i-1]) || strings.ContainsRune("([{«—", runes[i-1]) {
+			sb.WriteRune('«')
+			continue
+		}
+		sb.WriteRune('»')
+	}
+	return sb.String()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypoLine(t *testing.T) {
+	tbl := []struct {
+		line, res string
+		rules     []string
+	}{
+		{`Он сказал "привет" - и ушел...`, "Он сказал «привет»\u00a0— и ушел…", []string{"ellipsis", "dash", "quotes"}},
+		{"Ну и что , спросите вы ?", "Ну и что, спросите вы?", []string{"space before punctuation"}},
+		{"Смайлик не трогаем :) и ;-) тоже", "Смайлик не трогаем :) и ;-) тоже", nil},
+		{"- Вопросы и ответы", "- Вопросы и ответы", nil},
+		{"- .", "- .", nil},
+		{"1. пункт -- тире", "1. пункт\u00a0— тире", []string{"dash"}},
+		{"Уже\u00a0— правильно", "Уже\u00a0— правильно", nil},
+		{`<audio src="https://podcast.umputun.com/media/ump_podcast1.mp3" preload="none"></audio>`,
+			`<audio src="https://podcast.umputun.com/media/ump_podcast1.mp3" preload="none"></audio>`, nil},
+		{`Ссылка "[на сайт](https://example.com/a--b?x="1")" и ` + "`code \"x\" ...`",
+			`Ссылка «[на сайт](https://example.com/a--b?x="1")» и ` + "`code \"x\" ...`", []string{"quotes"}},
+		{`Голый url https://example.com/a...b "тут"`, `Голый url https://example.com/a...b «тут»`, []string{"quotes"}},
+		{`{{< youtube id="abc" >}} ...`, `{{< youtube id="abc" >}} …`, []string{"ellipsis"}},
+	}
+	for i, tt := range tbl {
+		res, rules := typoLine(tt.line)
+		assert.Equal(t, tt.res, res, "case %d", i)
+		assert.Equal(t, tt.rules, rules, "case %d", i)
+		again, rules := typoLine(res)
+		assert.Equal(t, res, again, "case %d, idempotent", i)
+		assert.Empty(t, rules, "case %d, idempotent", i)
+	}
+}
+
+func TestTypoCmd(t *testing.T) {
+	dir := copyTestPosts(t)
+	file := filepath.Join(dir, "typo.md")
+	require.NoError(t, os.WriteFile(file, []byte(`+++
+title = "Пост - с кавычками..."
+date = "2023-04-01T14:10:05"
++++
+
+Текст - с "кавычками"...
+
+`+"```"+`
+код - "как есть"...
+`+"```"+`
+
+    отступ - тоже код...
+- пункт , список
+`), 0o600))
+
+	err := typoCmd(Typo{Files: []string{file}})
+	assert.EqualError(t, err, "2 typography issues found")
+	issues, err := typoFiles([]string{file}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []lintIssue{
+		{File: file, Line: 6, Msg: "typography: ellipsis, dash, quotes"},
+		{File: file, Line: 13, Msg: "typography: space before punctuation"},
+	}, issues)
+
+	require.NoError(t, typoCmd(Typo{PostsLocation: dir, Fix: true}))
+	data, err := os.ReadFile(file) //nolint:gosec
+	require.NoError(t, err)
+	assert.Equal(t, `+++
+title = "Пост - с кавычками..."
+date = "2023-04-01T14:10:05"
++++
+
+Текст`+"\u00a0— с «кавычками»…"+`
+
+`+"```"+`
+код - "как есть"...
+`+"```"+`
+
+    отступ - тоже код...
+- пункт, список
+`, string(data))
+
+	assert.NoError(t, typoCmd(Typo{PostsLocation: dir}), "all fixed, test posts are clean")
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	_ "image/jpeg" // artwork can be jpeg
+	_ "image/png"  // or png
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// ValidateFeed checks generated rss feed against Apple and Podcast Index requirements
+type ValidateFeed struct {
+	Args struct {
+		Feed string `positional-arg-name:"file|url" description:"feed file or url"`
+	} `positional-args:"yes" required:"yes"`
+	Offline bool `long:"offline" description:"skip checks requiring network, i.e. artwork size"`
+}
+
+// feedReport is a result of feed validation
+type feedReport struct {
+	Errors   []string
+	Warnings []string
+}
+
+func (r *feedReport) errorf(format string, args ...interface{}) {
+	r.Errors = append(r.Errors, fmt.Sprintf(format, args...))
+}
+
+func (r *feedReport) warnf(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// artwork size limits required by Apple
+const (
+	minArtworkSize = 1400
+	maxArtworkSize = 3000
+)
+
+// knownAudioTypes are enclosure types accepted by podcast directories
+var knownAudioTypes = map[string]bool{"audio/mpeg": true, "audio/x-m4a": true, "audio/mp4": true,
+	"audio/aac": true, "audio/ogg": true, "audio/opus": true}
+
+// htmlTextElements contain html text, any child element there is unescaped html
+var htmlTextElements = map[string]bool{"description": true, "summary": true, "encoded": true}
+
+// validateFeedCmd validates feed and fails if any error found
+func validateFeedCmd(req ValidateFeed) error {
+	log.Printf("[INFO] validate feed %s", req.Args.Feed)
+	data, err := loadFeed(req.Args.Feed)
+	if err != nil {
+		return err
+	}
+
+	artworkFn := fetchArtworkSize
+	if req.Offline {
+		artworkFn = nil
+	}
+	rep := validateFeed(data, artworkFn)
+	for _, w := range rep.Warnings {
+		log.Printf("[WARN] %s", w)
+	}
+	for _, e := range rep.Errors {
+		log.Printf("[ERROR] %s", e)
+	}
+	if len(rep.Errors) > 0 {
+		return fmt.Errorf("feed %s is invalid, %d errors", req.Args.Feed, len(rep.Errors))
+	}
+	log.Printf("[INFO] feed %s is valid, %d warnings", req.Args.Feed, len(rep.Warnings))
+	return nil
+}
+
+// validateFeed checks xml syntax, html outside of cdata and feed structure.
+// artworkFn gets artwork dimensions, the check is skipped if nil.
+func validateFeed(data []byte, artworkFn func(url string) (w, h int, err error)) feedReport {
+	rep := feedReport{}
+	if !validateFeedSyntax(data, &rep) {
+		return rep // no point to check structure of broken xml
+	}
+
+	feed, err := parseFeed(data)
+	if err != nil {
+		rep.errorf("%v", err)
+		return rep
+	}
+	ch := feed.Channel
+
+	required := map[string]string{"title": ch.Title, "link": ch.Link, "description": ch.Description,
+		"language": ch.Language, "itunes:author": ch.ItunesAuthor, "itunes:explicit": ch.ItunesExplicit}
+	for _, name := range []string{"title", "link", "description", "language", "itunes:author", "itunes:explicit"} {
+		if strings.TrimSpace(required[name]) == "" {
+			rep.errorf("channel: missing %s", name)
+		}
+	}
+	if len(ch.ItunesCategory) == 0 {
+		rep.errorf("channel: missing itunes:category")
+	}
+	if ch.PodcastGUID == "" {
+		rep.warnf("channel: missing podcast:guid")
+	}
+	if len(ch.Items) == 0 {
+		rep.errorf("channel: no items")
+	}
+
+	validateArtwork(ch, artworkFn, &rep)
+
+	guids := map[string]int{}
+	for i, it := range ch.Items {
+		validateFeedItem(i+1, it, &rep)
+		if it.GUID.Value == "" {
+			continue
+		}
+		if prev, ok := guids[it.GUID.Value]; ok {
+			rep.errorf("item %d: duplicate guid %q, same as item %d", i+1, it.GUID.Value, prev)
+			continue
+		}
+		guids[it.GUID.Value] = i + 1
+	}
+	return rep
+}
+
+// validateFeedSyntax walks through xml tokens to catch syntax errors and html elements in text fields
+// not wrapped in cdata. Returns false if xml is not well-formed.
+func validateFeedSyntax(data []byte, rep *feedReport) bool {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if strings.EqualFold(charset, "utf-8") {
+			return input, nil
+		}
+		return nil, fmt.Errorf("unsupported charset %s", charset)
+	}
+
+	var stack []string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil {
+			rep.errorf("malformed xml: %v", err)
+			return false
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if len(stack) > 0 && htmlTextElements[stack[len(stack)-1]] {
+				line, _ := dec.InputPos()
+				rep.errorf("line %d: unescaped html <%s> in %s, should be in cdata", line, t.Name.Local, stack[len(stack)-1])
+			}
+			stack = append(stack, t.Name.Local)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// validateArtwork checks channel artwork url and, if artworkFn defined, dimensions
+func validateArtwork(ch feedDocChannel, artworkFn func(url string) (w, h int, err error), rep *feedReport) {
+	artwork := ch.ItunesImage.Href
+	if artwork == "" {
+		rep.errorf("channel: missing itunes:image")
+		return
+	}
+	if u, err := url.Parse(artwork); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		rep.errorf("channel: invalid artwork url %q", artwork)
+		return
+	}
+	if ext := strings.ToLower(artwork[strings.LastIndex(artwork, ".")+1:]); ext != "jpg" && ext != "jpeg" && ext != "png" {
+		rep.warnf("channel: artwork %q is not jpg or png", artwork)
+	}
+	if ch.Image.URL != "" && ch.Image.URL != artwork {
+		rep.warnf("channel: image url %q differs from itunes:image %q", ch.Image.URL, artwork)
+	}
+	if artworkFn == nil {
+		return
+	}
+
+	w, h, err := artworkFn(artwork)
+	switch {
+	case err != nil:
+		rep.errorf("channel: can't get artwork %s: %v", artwork, err)
+	case w != h:
+		rep.errorf("channel: artwork must be square, got %dx%d", w, h)
+	case w < minArtworkSize || w > maxArtworkSize:
+		rep.errorf("channel: artwork must be from %dx%[1]d to %dx%[2]d, got %dx%d", minArtworkSize, maxArtworkSize, w, h)
+	}
+}
+
+func validateFeedItem(num int, it feedDocItem, rep *feedReport) {
+	if strings.TrimSpace(it.Title) == "" {
+		rep.errorf("item %d: missing title", num)
+	}
+	if strings.TrimSpace(it.GUID.Value) == "" {
+		rep.errorf("item %d: missing guid", num)
+	}
+
+	pubDate := strings.TrimSpace(it.PubDate)
+	if _, err := parseFeedDate(pubDate); err != nil {
+		rep.errorf("item %d: invalid pubDate %q, not rfc 2822", num, pubDate)
+	} else if zone := pubDate[strings.LastIndex(pubDate, " ")+1:]; zone[0] != '+' && zone[0] != '-' {
+		rep.warnf("item %d: pubDate %q uses named time zone, numeric offset preferred", num, pubDate)
+	}
+
+	switch len(it.Enclosures) {
+	case 0:
+		rep.errorf("item %d: missing enclosure", num)
+	case 1:
+	default:
+		rep.errorf("item %d: multiple enclosures", num)
+	}
+	for _, enc := range it.Enclosures {
+		if enc.URL == "" {
+			rep.errorf("item %d: enclosure without url", num)
+		}
+		if enc.Type == "" {
+			rep.errorf("item %d: enclosure without type", num)
+		} else if !knownAudioTypes[enc.Type] {
+			rep.errorf("item %d: invalid enclosure type %q", num, enc.Type)
+		}
+		if n, err := strconv.ParseInt(enc.Length, 10, 64); err != nil || n <= 0 {
+			rep.errorf("item %d: invalid enclosure length %q", num, enc.Length)
+		}
+	}
+
+	if it.ItunesDuration == "" {
+		rep.warnf("item %d: missing itunes:duration", num)
+	}
+}
+
+// fetchArtworkSize downloads image and returns its dimensions
+func fetchArtworkSize(imgURL string) (w, h int, err error) {
+	client := http.Client{Timeout: time.Second * 30}
+	resp, err := client.Get(imgURL)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close() //nolint:gosec
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	cfg, _, err := image.DecodeConfig(resp.Body)
+	if err != nil {
+		return 0, 0, fmt.Errorf("can't decode image: %w", err)
+	}
+	return cfg.Width, cfg.Height, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateFeed(t *testing.T) {
+	artworkFn := func(url string) (w, h int, err error) { return 1400, 1400, nil }
+
+	t.Run("generated feed is valid", func(t *testing.T) {
+		nowFn = func() time.Time { return time.Date(2023, 4, 7, 14, 40, 46, 0, time.UTC) }
+		defer func() { nowFn = time.Now }()
+		outDir := t.TempDir()
+		cacheFile := filepath.Join(t.TempDir(), "media.json")
+		require.NoError(t, os.WriteFile(cacheFile, []byte(`{"ump_podcast570.mp3":{"size":12345,"duration":3600000000000},
+			"ump_podcast571.mp3":{"size":123456,"duration":3600000000000}}`), 0o600))
+		require.NoError(t, feedCmd(Feed{HugoLocation: "testdata/hugo", Output: outDir, MediaCache: cacheFile,
+			MediaURL: "https://podcast.umputun.com/media/", Size: 20}))
+
+		data, err := os.ReadFile(filepath.Join(outDir, "podcast.rss"))
+		require.NoError(t, err)
+		rep := validateFeed(data, artworkFn)
+		assert.Empty(t, rep.Errors)
+		assert.Empty(t, rep.Warnings)
+	})
+
+	t.Run("broken xml", func(t *testing.T) {
+		rep := validateFeed([]byte("<rss><channel><title>a &nbsp; b</title></channel></rss>"), artworkFn)
+		require.Len(t, rep.Errors, 1)
+		assert.Contains(t, rep.Errors[0], "malformed xml: XML syntax error on line 1: invalid character entity &nbsp;")
+	})
+
+	t.Run("invalid items", func(t *testing.T) {
+		feed := `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+<channel>
+<title>UWP</title><link>https://podcast.umputun.com/</link><description>подкаст</description><language>ru</language>
+<itunes:author>Umputun</itunes:author><itunes:explicit>false</itunes:explicit>
+<itunes:image href="https://podcast.umputun.com/cover.jpg"/>
+<item><title>UWP - Выпуск 1</title><guid>1</guid><pubDate>Sat, 01 Apr 2023 14:10:05 EST</pubDate>
+	<description><p>html</p></description>
+	<enclosure url="https://podcast.umputun.com/media/ump_podcast1.mp3" length="" type="audio/mp3"/></item>
+<item><title>UWP - Выпуск 2</title><guid>1</guid><pubDate>2023-04-08</pubDate></item>
+</channel>
+</rss>`
+		rep := validateFeed([]byte(feed), func(url string) (w, h int, err error) { return 600, 600, nil })
+		assert.Equal(t, []string{
+			"line 8: unescaped html <p> in description, should be in cdata",
+			"channel: missing itunes:category",
+			"channel: artwork must be from 1400x1400 to 3000x3000, got 600x600",
+			`item 1: invalid enclosure type "audio/mp3"`,
+			`item 1: invalid enclosure length ""`,
+			`item 2: invalid pubDate "2023-04-08", not rfc 2822`,
+			"item 2: missing enclosure",
+			`item 2: duplicate guid "1", same as item 1`,
+		}, rep.Errors)
+		assert.Equal(t, []string{
+			"channel: missing podcast:guid",
+			`item 1: pubDate "Sat, 01 Apr 2023 14:10:05 EST" uses named time zone, numeric offset preferred`,
+			"item 1: missing itunes:duration",
+			"item 2: missing itunes:duration",
+		}, rep.Warnings)
+	})
+}
+
+func TestValidateFeedCmd(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "podcast.rss")
+	require.NoError(t, os.WriteFile(file, []byte("<rss><channel></channel></rss>"), 0o600))
+	req := ValidateFeed{Offline: true}
+	req.Args.Feed = file
+	err := validateFeedCmd(req)
+	assert.EqualError(t, err, fmt.Sprintf("feed %s is invalid, 9 errors", file))
+}
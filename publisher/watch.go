@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/go-pkgz/lgr"
+)
+
+// Watch polls the site repo remote and accepts github push webhook, pulls changes and rebuilds the site.
+// Builds are serialized by the lock file and bursts of pushes coalesced into a single build.
+type Watch struct {
+	Repo       string        `long:"repo" default:"/srv/podcast-uwp" description:"site git repo"`
+	Remote     string        `long:"remote" default:"origin" description:"git remote"`
+	Branch     string        `long:"branch" default:"master" description:"git branch"`
+	Interval   time.Duration `long:"interval" default:"10s" description:"remote polling interval"`
+	MaxBackoff time.Duration `long:"max-backoff" default:"5m" description:"max polling interval on failures"`
+	Coalesce   time.Duration `long:"coalesce" default:"5s" description:"wait for more pushes before the build"`
+	BuildCmd   string        `long:"build-cmd" default:"uwp-publisher build" description:"build command, runs in repo"`
+	Lock       string        `long:"lock" default:"/srv/podcast-uwp/var/build.lock" description:"build lock file"`
+	Listen     string        `long:"listen" default:"127.0.0.1:8091" description:"listen address of webhook, status and healthz"`
+	Secret     string        `long:"secret" env:"WEBHOOK_SECRET" description:"github webhook secret, webhook disabled if empty"`
+	LogsDir    string        `long:"logs-dir" default:"/srv/podcast-uwp/var/watch" description:"build logs directory"`
+	Logs       int           `long:"logs" default:"20" description:"build logs to keep"`
+	Stale      time.Duration `long:"stale" default:"10m" description:"healthz fails if no successful poll within"`
+}
+
+// cmdRunner runs shell command in dir and returns its combined output
+type cmdRunner func(ctx context.Context, dir, command string) (string, error)
+
+// watcher is the state of watch daemon, shared by poller, builder and http handlers
+type watcher struct {
+	Watch
+	run     cmdRunner
+	trigger chan struct{} // one pending build at most, more triggers coalesced into it
+
+	mu    sync.Mutex
+	state watchState
+}
+
+// watchState is reported by /status
+type watchState struct {
+	Started    time.Time  `json:"started"`
+	LastPoll   time.Time  `json:"last_poll"`
+	LastPollOK time.Time  `json:"last_poll_ok"`
+	PollError  string     `json:"poll_error,omitempty"`
+	Failures   int        `json:"failures"`
+	Head       string     `json:"head"`
+	Target     string     `json:"target,omitempty"` // remote commit the pending or the last build triggered for
+	Building   bool       `json:"building"`
+	Pending    int        `json:"pending"` // triggers waiting for the build
+	Builds     []buildLog `json:"builds"`  // newest first
+}
+
+// buildLog is a result of the build with its output
+type buildLog struct {
+	Started  time.Time `json:"started"`
+	Duration string    `json:"duration"`
+	Triggers int       `json:"triggers"` // coalesced triggers
+	Commit   string    `json:"commit"`
+	Error    string    `json:"error,omitempty"`
+	Output   string    `json:"output"`
+}
+
+// watchCmd runs poller, builder and http server till SIGTERM or SIGINT
+func watchCmd(req Watch) error {
+	if err := os.MkdirAll(req.LogsDir, 0o750); err != nil {
+		return fmt.Errorf("error creating dir %s: %w", req.LogsDir, err)
+	}
+	w := newWatcher(req, shellRunner)
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	srv := &http.Server{Addr: req.Listen, Handler: w.routes(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, done := context.WithTimeout(context.Background(), 10*time.Second)
+		defer done()
+		if e := srv.Shutdown(shutdownCtx); e != nil {
+			log.Printf("[WARN] watch server shutdown: %v", e)
+		}
+	}()
+	go func() {
+		log.Printf("[INFO] watch server on %s, webhook enabled: %v", req.Listen, req.Secret != "")
+		if e := srv.ListenAndServe(); e != nil && !errors.Is(e, http.ErrServerClosed) {
+			log.Printf("[WARN] watch server failed: %v", e)
+			cancel()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.buildLoop(ctx)
+	}()
+	w.pollLoop(ctx)
+	wg.Wait()
+	return nil
+}
+
+func newWatcher(req Watch, run cmdRunner) *watcher {
+	return &watcher{Watch: req, run: run, trigger: make(chan struct{}, 1), state: watchState{Started: nowFn()}}
+}
+
+// shellRunner runs command with sh -c. Commands run by watch hold the build lock, build command is told so by env.
+func shellRunner(ctx context.Context, dir, command string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command) //nolint:gosec
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), buildLockEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// pollLoop polls the remote every interval, the interval doubled on each failure up to max backoff
+func (w *watcher) pollLoop(ctx context.Context) {
+	for {
+		failures := 0
+		if err := w.poll(ctx); err != nil {
+			log.Printf("[WARN] poll failed: %v", err)
+			w.mu.Lock()
+			failures = w.state.Failures
+			w.mu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoffDelay(w.Interval, w.MaxBackoff, failures)):
+		}
+	}
+}
+
+// backoffDelay returns interval doubled for each failure, limited by maxDelay
+func backoffDelay(interval, maxDelay time.Duration, failures int) time.Duration {
+	d := interval
+	for i := 0; i < failures && d < maxDelay; i++ {
+		d *= 2
+	}
+	if d > maxDelay {
+		return maxDelay
+	}
+	return d
+}
+
+// poll fetches the remote and requests build if the remote branch differs from the local head
+// and no build requested for it yet, so failed build of the same commit is not repeated on each poll
+func (w *watcher) poll(ctx context.Context) error {
+	local, remote, err := w.fetch(ctx)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state.LastPoll = nowFn()
+	if err != nil {
+		w.state.Failures++
+		w.state.PollError = err.Error()
+		return err
+	}
+	w.state.Failures, w.state.PollError, w.state.LastPollOK, w.state.Head = 0, "", w.state.LastPoll, local
+	if local != remote && remote != w.state.Target {
+		log.Printf("[INFO] remote %s/%s changed to %s", w.Remote, w.Branch, shortCommit(remote))
+		w.state.Target = remote
+		w.requestBuildLocked()
+	}
+	return nil
+}
+
+// fetch returns local head and remote branch commits after git fetch
+func (w *watcher) fetch(ctx context.Context) (local, remote string, err error) {
+	if out, e := w.run(ctx, w.Repo, fmt.Sprintf("git fetch %s %s", w.Remote, w.Branch)); e != nil {
+		return "", "", fmt.Errorf("git fetch: %v %s", e, strings.TrimSpace(out))
+	}
+	out, err := w.run(ctx, w.Repo, "git rev-parse HEAD "+w.Remote+"/"+w.Branch)
+	if err != nil {
+		return "", "", fmt.Errorf("git rev-parse: %v %s", err, strings.TrimSpace(out))
+	}
+	commits := strings.Fields(out)
+	if len(commits) != 2 {
+		return "", "", fmt.Errorf("unexpected git rev-parse output %q", out)
+	}
+	return commits[0], commits[1], nil
+}
+
+// requestBuild adds a trigger, it is dropped if the build is already pending
+func (w *watcher) requestBuild() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.requestBuildLocked()
+}
+
+func (w *watcher) requestBuildLocked() {
+	w.state.Pending++
+	select {
+	case w.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// buildLoop runs builds one by one. After the trigger it waits for coalesce duration,
+// so the burst of pushes ends up in a single build.
+func (w *watcher) buildLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.trigger:
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.Coalesce):
+		}
+		select {
+		case <-w.trigger: // triggered during coalesce wait, covered by this build
+		default:
+		}
+		w.build(ctx)
+	}
+}
+
+// build pulls the remote branch and runs build command under the lock, keeps the log
+func (w *watcher) build(ctx context.Context) {
+	w.mu.Lock()
+	bl := buildLog{Started: nowFn(), Triggers: w.state.Pending}
+	w.state.Pending, w.state.Building = 0, true
+	w.mu.Unlock()
+
+	var out bytes.Buffer
+	err := func() error {
+		unlock, err := acquireLock(w.Lock)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		steps := []string{
+			fmt.Sprintf("git fetch %s %s", w.Remote, w.Branch),
+			fmt.Sprintf("git merge --ff-only %s/%s", w.Remote, w.Branch),
+			w.BuildCmd,
+		}
+		for _, step := range steps {
+			fmt.Fprintf(&out, "$ %s\n", step)
+			res, e := w.run(ctx, w.Repo, step)
+			out.WriteString(res)
+			if e != nil {
+				return fmt.Errorf("%s: %w", step, e)
+			}
+		}
+		return nil
+	}()
+	if head, e := w.run(ctx, w.Repo, "git rev-parse HEAD"); e == nil {
+		bl.Commit = strings.TrimSpace(head)
+	}
+	bl.Duration = time.Since(bl.Started).Round(time.Millisecond).String()
+	bl.Output = out.String()
+	if err != nil {
+		bl.Error = err.Error()
+		log.Printf("[WARN] build of %s failed: %v", shortCommit(bl.Commit), err)
+	} else {
+		log.Printf("[INFO] build of %s completed in %s", shortCommit(bl.Commit), bl.Duration)
+	}
+	if e := w.saveLog(bl); e != nil {
+		log.Printf("[WARN] can't save build log: %v", e)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state.Building = false
+	if bl.Commit != "" {
+		w.state.Head = bl.Commit
+	}
+	w.state.Builds = append([]buildLog{bl}, w.state.Builds...)
+	if len(w.state.Builds) > w.Logs {
+		w.state.Builds = w.state.Builds[:w.Logs]
+	}
+}
+
+// saveLog writes build log file and removes the old ones, only the last Logs are kept
+func (w *watcher) saveLog(bl buildLog) error {
+	status := "ok"
+	if bl.Error != "" {
+		status = "failed"
+	}
+	name := fmt.Sprintf("build-%s-%s-%s.log", bl.Started.Format("20060102-150405"), shortCommit(bl.Commit), status)
+	data := fmt.Sprintf("started: %s\nduration: %s\ncommit: %s\ntriggers: %d\nerror: %s\n\n%s",
+		bl.Started.Format(time.RFC3339), bl.Duration, bl.Commit, bl.Triggers, bl.Error, bl.Output)
+	if err := writeFileAtomic(filepath.Join(w.LogsDir, name), []byte(data)); err != nil {
+		return err
+	}
+	logs, err := filepath.Glob(filepath.Join(w.LogsDir, "build-*.log"))
+	if err != nil {
+		return fmt.Errorf("can't list build logs: %w", err)
+	}
+	sort.Strings(logs)
+	for i := 0; i < len(logs)-w.Logs; i++ {
+		if err = os.Remove(logs[i]); err != nil {
+			return fmt.Errorf("can't remove old build log: %w", err)
+		}
+	}
+	return nil
+}
+
+// acquireLock takes exclusive lock of the file, waits for other builds to release it
+func acquireLock(file string) (unlock func(), err error) {
+	if err = os.MkdirAll(filepath.Dir(file), 0o750); err != nil {
+		return nil, fmt.Errorf("error creating dir %s: %w", filepath.Dir(file), err)
+	}
+	fh, err := os.OpenFile(file, os.O_CREATE|os.O_RDWR, 0o600) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("can't open lock %s: %w", file, err)
+	}
+	if err = syscall.Flock(int(fh.Fd()), syscall.LOCK_EX); err != nil {
+		_ = fh.Close()
+		return nil, fmt.Errorf("can't lock %s: %w", file, err)
+	}
+	return func() {
+		_ = syscall.Flock(int(fh.Fd()), syscall.LOCK_UN)
+		_ = fh.Close()
+	}, nil
+}
+
+func (w *watcher) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook", w.webhookHandler)
+	mux.HandleFunc("/status", w.statusHandler)
+	mux.HandleFunc("/healthz", w.healthzHandler)
+	return mux
+}
+
+// webhookHandler accepts github push to the watched branch, signed by X-Hub-Signature-256 with the secret
+func (w *watcher) webhookHandler(rw http.ResponseWriter, r *http.Request) {
+	if w.Secret == "" {
+		http.NotFound(rw, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 10*1024*1024))
+	if err != nil {
+		http.Error(rw, "can't read body", http.StatusBadRequest)
+		return
+	}
+	if !validSignature(w.Secret, body, r.Header.Get("X-Hub-Signature-256")) {
+		log.Printf("[WARN] webhook with invalid signature from %s", clientIP(r))
+		http.Error(rw, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Header.Get("X-GitHub-Event") {
+	case "ping":
+		_, _ = rw.Write([]byte("pong"))
+		return
+	case "push":
+	default:
+		http.Error(rw, "event ignored", http.StatusAccepted)
+		return
+	}
+	var push struct {
+		Ref   string `json:"ref"`
+		After string `json:"after"`
+	}
+	if err = json.Unmarshal(body, &push); err != nil {
+		http.Error(rw, "can't parse push", http.StatusBadRequest)
+		return
+	}
+	if push.Ref != "refs/heads/"+w.Branch {
+		http.Error(rw, "branch ignored", http.StatusAccepted)
+		return
+	}
+	log.Printf("[INFO] webhook push of %s", shortCommit(push.After))
+	w.mu.Lock()
+	w.state.Target = push.After
+	w.requestBuildLocked()
+	w.mu.Unlock()
+	rw.WriteHeader(http.StatusAccepted)
+	_, _ = rw.Write([]byte("build requested"))
+}
+
+// validSignature checks github "sha256=<hex hmac>" signature of the body
+func validSignature(secret string, body []byte, signature string) bool {
+	sig, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// statusHandler returns watch state with the last build logs as json
+func (w *watcher) statusHandler(rw http.ResponseWriter, _ *http.Request) {
+	w.mu.Lock()
+	data, err := json.MarshalIndent(w.state, "", "  ")
+	w.mu.Unlock()
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, _ = rw.Write(data)
+}
+
+// healthzHandler fails if there was no successful poll within stale duration, since start for the first poll
+func (w *watcher) healthzHandler(rw http.ResponseWriter, _ *http.Request) {
+	w.mu.Lock()
+	last := w.state.LastPollOK
+	if last.IsZero() {
+		last = w.state.Started
+	}
+	pollErr := w.state.PollError
+	w.mu.Unlock()
+	if nowFn().Sub(last) > w.Stale {
+		http.Error(rw, fmt.Sprintf("no successful poll since %s: %s", last.Format(time.RFC3339), pollErr),
+			http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = rw.Write([]byte("ok"))
+}
+
+// shortCommit returns abbreviated commit hash
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRepo is a cmdRunner emulating git of the site repo
+type fakeRepo struct {
+	mu       sync.Mutex
+	local    string
+	remote   string
+	fetchErr error
+	buildErr error
+	builds   int
+	commands []string
+}
+
+func (f *fakeRepo) run(_ context.Context, _, command string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, command)
+	switch {
+	case strings.HasPrefix(command, "git fetch"):
+		if f.fetchErr != nil {
+			return "fatal: unable to access", f.fetchErr
+		}
+		return "", nil
+	case command == "git rev-parse HEAD origin/master":
+		return f.local + "\n" + f.remote + "\n", nil
+	case command == "git rev-parse HEAD":
+		return f.local + "\n", nil
+	case strings.HasPrefix(command, "git merge"):
+		f.local = f.remote
+		return "Fast-forward\n", nil
+	case command == "make site":
+		f.builds++
+		return "site built\n", f.buildErr
+	}
+	return "", errors.New("unexpected command " + command)
+}
+
+func testWatch(t *testing.T) Watch {
+	dir := t.TempDir()
+	return Watch{Repo: dir, Remote: "origin", Branch: "master", Interval: time.Second, MaxBackoff: 8 * time.Second,
+		Coalesce: 50 * time.Millisecond, BuildCmd: "make site", Lock: filepath.Join(dir, "build.lock"),
+		Secret: "secret", LogsDir: filepath.Join(dir, "logs"), Logs: 2, Stale: time.Minute}
+}
+
+func TestWatcherPollAndBuild(t *testing.T) {
+	repo := &fakeRepo{local: "aaaaaaaaaa", remote: "bbbbbbbbbb"}
+	req := testWatch(t)
+	require.NoError(t, os.MkdirAll(req.LogsDir, 0o700))
+	w := newWatcher(req, repo.run)
+	ctx := context.Background()
+
+	require.NoError(t, w.poll(ctx))
+	require.NoError(t, w.poll(ctx), "the same remote commit requested once")
+	assert.Equal(t, 1, w.state.Pending)
+	assert.Len(t, w.trigger, 1)
+
+	<-w.trigger
+	w.build(ctx)
+	assert.Equal(t, 1, repo.builds)
+	require.Len(t, w.state.Builds, 1)
+	bl := w.state.Builds[0]
+	assert.Equal(t, "bbbbbbbbbb", bl.Commit)
+	assert.Empty(t, bl.Error)
+	assert.Equal(t, 1, bl.Triggers)
+	assert.Equal(t, "$ git fetch origin master\n$ git merge --ff-only origin/master\nFast-forward\n$ make site\nsite built\n", bl.Output)
+	assert.Equal(t, "bbbbbbbbbb", w.state.Head)
+	assert.Equal(t, 0, w.state.Pending)
+
+	require.NoError(t, w.poll(ctx))
+	assert.Empty(t, w.trigger, "up to date")
+
+	repo.remote, repo.buildErr = "cccccccccc", errors.New("exit status 1")
+	require.NoError(t, w.poll(ctx))
+	<-w.trigger
+	w.build(ctx)
+	assert.Equal(t, "make site: exit status 1", w.state.Builds[0].Error)
+	repo.remote = "dddddddddd"
+	require.NoError(t, w.poll(ctx))
+	<-w.trigger
+	w.build(ctx)
+	assert.Len(t, w.state.Builds, 2, "only last logs kept")
+
+	logs, err := filepath.Glob(filepath.Join(req.LogsDir, "build-*.log"))
+	require.NoError(t, err)
+	assert.Len(t, logs, 2)
+	var failed bool
+	for _, l := range logs {
+		failed = failed || strings.HasSuffix(l, "-ccccccc-failed.log") || strings.HasSuffix(l, "-ddddddd-failed.log")
+	}
+	assert.True(t, failed)
+
+	repo.fetchErr = errors.New("exit status 128")
+	assert.Error(t, w.poll(ctx))
+	assert.Error(t, w.poll(ctx))
+	assert.Equal(t, 2, w.state.Failures)
+	assert.Contains(t, w.state.PollError, "git fetch: exit status 128 fatal: unable to access")
+}
+
+func TestWatcherBuildLoopCoalesces(t *testing.T) {
+	repo := &fakeRepo{local: "aaaaaaaaaa", remote: "bbbbbbbbbb"}
+	req := testWatch(t)
+	require.NoError(t, os.MkdirAll(req.LogsDir, 0o700))
+	w := newWatcher(req, repo.run)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.buildLoop(ctx)
+		close(done)
+	}()
+
+	for i := 0; i < 5; i++ {
+		w.requestBuild()
+		time.Sleep(5 * time.Millisecond)
+	}
+	require.Eventually(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return len(w.state.Builds) == 1 && !w.state.Building
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	assert.Equal(t, 1, repo.builds, "burst of triggers built once")
+	assert.Equal(t, 5, w.state.Builds[0].Triggers)
+}
+
+func TestBackoffDelay(t *testing.T) {
+	assert.Equal(t, 10*time.Second, backoffDelay(10*time.Second, 5*time.Minute, 0))
+	assert.Equal(t, 20*time.Second, backoffDelay(10*time.Second, 5*time.Minute, 1))
+	assert.Equal(t, 160*time.Second, backoffDelay(10*time.Second, 5*time.Minute, 4))
+	assert.Equal(t, 5*time.Minute, backoffDelay(10*time.Second, 5*time.Minute, 5))
+	assert.Equal(t, 5*time.Minute, backoffDelay(10*time.Second, 5*time.Minute, 100))
+}
+
+func TestWatcherWebhook(t *testing.T) {
+	w := newWatcher(testWatch(t), (&fakeRepo{}).run)
+	ts := httptest.NewServer(w.routes())
+	defer ts.Close()
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	post := func(event, body, signature string) int {
+		req, err := http.NewRequest("POST", ts.URL+"/webhook", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("X-GitHub-Event", event)
+		req.Header.Set("X-Hub-Signature-256", signature)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	push := `{"ref": "refs/heads/master", "after": "cccccccccc"}`
+	assert.Equal(t, http.StatusUnauthorized, post("push", push, sign(push+" ")))
+	assert.Equal(t, http.StatusUnauthorized, post("push", push, ""))
+	assert.Empty(t, w.trigger)
+
+	assert.Equal(t, http.StatusOK, post("ping", "{}", sign("{}")))
+	other := `{"ref": "refs/heads/dev", "after": "dddddddddd"}`
+	assert.Equal(t, http.StatusAccepted, post("push", other, sign(other)))
+	assert.Empty(t, w.trigger, "other branch ignored")
+
+	assert.Equal(t, http.StatusAccepted, post("push", push, sign(push)))
+	assert.Equal(t, http.StatusAccepted, post("push", push, sign(push)))
+	assert.Len(t, w.trigger, 1)
+	assert.Equal(t, 2, w.state.Pending)
+	assert.Equal(t, "cccccccccc", w.state.Target)
+
+	w.Secret = ""
+	assert.Equal(t, http.StatusNotFound, post("push", push, sign(push)))
+}
+
+func TestWatcherStatusAndHealthz(t *testing.T) {
+	nowFn = func() time.Time { return time.Date(2023, 4, 10, 12, 0, 0, 0, siteTZ) }
+	defer func() { nowFn = time.Now }()
+	w := newWatcher(testWatch(t), (&fakeRepo{}).run)
+	w.state.Builds = []buildLog{{Commit: "bbbbbbbbbb", Output: "site built"}}
+
+	rec := httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/status", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var state watchState
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &state))
+	assert.Equal(t, "site built", state.Builds[0].Output)
+
+	rec = httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code, "just started")
+
+	nowFn = func() time.Time { return time.Date(2023, 4, 10, 12, 30, 0, 0, siteTZ) }
+	w.state.PollError = "git fetch: exit status 128"
+	rec = httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", http.NoBody))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), "git fetch: exit status 128")
+
+	w.state.LastPollOK = nowFn().Add(-time.Minute / 2)
+	rec = httptest.NewRecorder()
+	w.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", http.NoBody))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAcquireLock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sub", "build.lock")
+	unlock, err := acquireLock(file)
+	require.NoError(t, err)
+
+	locked := make(chan struct{})
+	go func() {
+		unlock2, e := acquireLock(file)
+		assert.NoError(t, e)
+		close(locked)
+		unlock2()
+	}()
+	select {
+	case <-locked:
+		t.Fatal("lock taken twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("lock not released")
+	}
+}
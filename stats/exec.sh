@@ -2,15 +2,15 @@
 
 echo "activate stats updater"
 cp -fv /index.html /stats/index.html
-/usr/sbin/vnstatd -n &
 
-while :
-do
-    echo "$(date) update stats"
-    /usr/bin/vnstati  -s -i eth0 -o /stats/vnstat.png
-    /usr/bin/vnstati -h -c 15 -i eth0  -o /stats/vnstat_h.png
-    /usr/bin/vnstati -m -i eth0 -o /stats/vnstat_m.png
-    /usr/bin/vnstati -d -i eth0 -o /stats/vnstat_d.png
-    /usr/bin/vnstati -t -i eth0 -o /stats/vnstat_t.png
-    sleep 5m
-done
+# downloads and subscribers are parsed from docker logs of nginx and serve-media events,
+# both keep history in /stats and only add new days, so hourly run is enough
+(
+    while true; do
+        /usr/local/bin/uwp-publisher stats downloads --events="/stats/media-events.log*" --output=/stats
+        /usr/local/bin/uwp-publisher stats subscribers --output=/stats
+        sleep 3600
+    done
+) &
+
+exec /usr/local/bin/uwp-publisher stats traffic --interface=eth0 --output=/stats